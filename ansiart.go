@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --- ANSI Art Export ---
+//
+// Snapshots also go out as .ans files, the format of the BBS art scene: the
+// rendered text with its color escapes, in code page 437 with CRLF line
+// ends, followed by a SAUCE record. SAUCE is a 128 byte trailer (after an
+// EOF byte, so DOS `type` stops before it) that tells viewers like
+// PabloDraw and ansilove the title, author, size and font, so the art is
+// laid out at the right width instead of wrapped at 80 columns.
+//
+// Truecolor escapes (38;2) are what the color mode renders. Older viewers
+// and terminals only know the xterm 256-color palette (38;5), so that can
+// be picked instead.
+
+type ansiColors int
+
+const (
+	ansiTruecolor ansiColors = iota
+	ansi256
+)
+
+func parseANSIColors(s string) (ansiColors, error) {
+	switch strings.ToLower(s) {
+	case "", "truecolor", "24bit":
+		return ansiTruecolor, nil
+	case "256":
+		return ansi256, nil
+	}
+	return ansiTruecolor, fmt.Errorf("unknown ansi_colors %q (have: truecolor, 256)", s)
+}
+
+// sauce is the metadata that goes in the SAUCE record.
+type sauce struct {
+	title  string
+	author string
+	group  string
+	date   time.Time
+	width  int
+	height int
+	font   string
+}
+
+const (
+	sauceSize     = 128
+	sauceEOF      = 0x1a
+	sauceDataChar = 1 // DataType: character based
+	sauceFileANSI = 1 // FileType: ANSi
+	sauceFont     = "IBM VGA"
+	// TFlags: 8 pixel wide letters, square pixels. Without the aspect bits
+	// viewers stretch the art to the 4:3 of a DOS screen.
+	sauceFlags = 1<<1 | 2<<3
+)
+
+// ansFile turns rendered text into a .ans file, SAUCE record included.
+func ansFile(text string, colors ansiColors, meta sauce) []byte {
+	text = strings.TrimSuffix(text, "\n")
+	if meta.width == 0 {
+		meta.width = lipgloss.Width(text)
+	}
+	if meta.height == 0 {
+		meta.height = strings.Count(text, "\n") + 1
+	}
+	if colors == ansi256 {
+		text = toANSI256(text)
+	}
+
+	var b bytes.Buffer
+	for _, line := range strings.Split(text, "\n") {
+		b.Write(toCP437(line))
+		b.WriteString("\r\n")
+	}
+	b.WriteString("\x1b[0m")
+	size := b.Len()
+	b.WriteByte(sauceEOF)
+	b.Write(sauceRecord(meta, size))
+	return b.Bytes()
+}
+
+// sauceRecord builds the record for a file of size bytes (not counting the
+// EOF byte and the record itself).
+func sauceRecord(s sauce, size int) []byte {
+	rec := make([]byte, 0, sauceSize)
+	field := func(v string, n int, pad byte) {
+		v = string(toCP437(v))
+		if len(v) > n {
+			v = v[:n]
+		}
+		rec = append(rec, v...)
+		rec = append(rec, bytes.Repeat([]byte{pad}, n-len(v))...)
+	}
+	le16 := func(v int) { rec = binary.LittleEndian.AppendUint16(rec, uint16(v)) }
+
+	font := s.font
+	if font == "" {
+		font = sauceFont
+	}
+	date := s.date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	rec = append(rec, "SAUCE00"...)
+	field(s.title, 35, ' ')
+	field(s.author, 20, ' ')
+	field(s.group, 20, ' ')
+	field(date.Format("20060102"), 8, ' ')
+	rec = binary.LittleEndian.AppendUint32(rec, uint32(size))
+	rec = append(rec, sauceDataChar, sauceFileANSI)
+	le16(s.width)
+	le16(s.height)
+	le16(0)
+	le16(0)
+	rec = append(rec, 0, sauceFlags) // no comment block
+	field(font, 22, 0)
+	return rec
+}
+
+var truecolorSGR = regexp.MustCompile(`\x1b\[([34])8;2;(\d+);(\d+);(\d+)m`)
+
+// toANSI256 rewrites truecolor escapes to the nearest xterm 256 color.
+func toANSI256(text string) string {
+	return truecolorSGR.ReplaceAllStringFunc(text, func(sgr string) string {
+		m := truecolorSGR.FindStringSubmatch(sgr)
+		var c [3]int
+		for i := range c {
+			c[i], _ = strconv.Atoi(m[i+2])
+		}
+		return fmt.Sprintf("\x1b[%s8;5;%dm", m[1], xterm256(c[0], c[1], c[2]))
+	})
+}
+
+// xterm256 picks the closest color from the 6x6x6 cube (16-231) or the
+// gray ramp (232-255). The 16 system colors are left out since terminals
+// disagree on what they look like.
+func xterm256(r, g, b int) int {
+	levels := [6]int{0, 95, 135, 175, 215, 255}
+	nearest := func(v int) int {
+		best := 0
+		for i, l := range levels {
+			if abs(v-l) < abs(v-levels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	dist := func(r2, g2, b2 int) int {
+		return (r-r2)*(r-r2) + (g-g2)*(g-g2) + (b-b2)*(b-b2)
+	}
+
+	cr, cg, cb := nearest(r), nearest(g), nearest(b)
+	cube := 16 + 36*cr + 6*cg + cb
+	cubeDist := dist(levels[cr], levels[cg], levels[cb])
+
+	gray := min(max((r+g+b)/3-3, 0)/10, 23)
+	v := 8 + 10*gray
+	if dist(v, v, v) < cubeDist {
+		return 232 + gray
+	}
+	return cube
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// cp437 maps the non-ASCII characters the renderers use to code page 437.
+var cp437 = map[rune]byte{
+	'█': 0xdb, '▓': 0xb2, '▒': 0xb1, '░': 0xb0,
+	'▀': 0xdf, '▄': 0xdc, '▌': 0xdd, '▐': 0xde,
+	'·': 0xfa, '•': 0xf9,
+}
+
+func toCP437(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch b, ok := cp437[r]; {
+		case r < 0x80:
+			out = append(out, byte(r))
+		case ok:
+			out = append(out, b)
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
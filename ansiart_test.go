@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestANSFileSAUCE(t *testing.T) {
+	art := "\x1b[38;2;255;0;0m██\x1b[0m\n\x1b[38;2;0;0;255m██\x1b[0m\n"
+	date := time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)
+	data := ansFile(art, ansiTruecolor, sauce{title: "atlas_cam_1", author: "fez", date: date})
+
+	if len(data) < sauceSize+1 {
+		t.Fatalf("file is only %d bytes", len(data))
+	}
+	rec := data[len(data)-sauceSize:]
+	body := data[:len(data)-sauceSize-1]
+	if data[len(body)] != sauceEOF {
+		t.Error("no EOF byte before the SAUCE record")
+	}
+
+	str := func(off, n int) string { return strings.TrimRight(string(rec[off:off+n]), " \x00") }
+	u16 := func(off int) int { return int(binary.LittleEndian.Uint16(rec[off:])) }
+	if got := string(rec[:7]); got != "SAUCE00" {
+		t.Errorf("id = %q", got)
+	}
+	for _, c := range []struct{ name, got, want string }{
+		{"title", str(7, 35), "atlas_cam_1"},
+		{"author", str(42, 20), "fez"},
+		{"date", str(82, 8), "20240309"},
+		{"font", str(106, 22), sauceFont},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s = %q, want %q", c.name, c.got, c.want)
+		}
+	}
+	if size := binary.LittleEndian.Uint32(rec[90:]); int(size) != len(body) {
+		t.Errorf("file size = %d, want %d", size, len(body))
+	}
+	if rec[94] != sauceDataChar || rec[95] != sauceFileANSI {
+		t.Errorf("type = %d/%d, want character/ANSi", rec[94], rec[95])
+	}
+	if w, h := u16(96), u16(98); w != 2 || h != 2 {
+		t.Errorf("size = %dx%d, want 2x2", w, h)
+	}
+
+	// Blocks in code page 437, lines ending in CRLF.
+	want := "\x1b[38;2;255;0;0m\xdb\xdb\x1b[0m\r\n\x1b[38;2;0;0;255m\xdb\xdb\x1b[0m\r\n\x1b[0m"
+	if !bytes.Equal(body, []byte(want)) {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestANSI256(t *testing.T) {
+	got := toANSI256("\x1b[38;2;255;0;0mA\x1b[48;2;128;128;128mB\x1b[0m")
+	want := "\x1b[38;5;196mA\x1b[48;5;244mB\x1b[0m"
+	if got != want {
+		t.Errorf("toANSI256 = %q, want %q", got, want)
+	}
+
+	for _, c := range []struct{ r, g, b, want int }{
+		{0, 0, 0, 16},
+		{255, 255, 255, 231},
+		{0, 0, 255, 21},
+		{95, 135, 175, 67},
+		{8, 8, 8, 232},
+		{238, 238, 238, 255},
+	} {
+		if got := xterm256(c.r, c.g, c.b); got != c.want {
+			t.Errorf("xterm256(%d, %d, %d) = %d, want %d", c.r, c.g, c.b, got, c.want)
+		}
+	}
+}
+
+func TestParseANSIColors(t *testing.T) {
+	if c, err := parseANSIColors("256"); err != nil || c != ansi256 {
+		t.Errorf("parseANSIColors(256) = %v, %v", c, err)
+	}
+	if c, err := parseANSIColors(""); err != nil || c != ansiTruecolor {
+		t.Errorf("parseANSIColors(\"\") = %v, %v", c, err)
+	}
+	if _, err := parseANSIColors("16"); err == nil {
+		t.Error("parseANSIColors accepted 16")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+)
+
+// --- APNG Recording ---
+//
+// Animated PNG is plain PNG plus three chunks: acTL (frame count, loops)
+// before the image data, and an fcTL (size, offset, delay) ahead of each
+// frame. The first frame's pixels go in the usual IDAT chunks so non-APNG
+// viewers still show it; the rest go in fdAT chunks, which are IDAT with a
+// sequence number in front. Each frame is run through image/png and its
+// IDAT data lifted out. The frame count isn't known until the end, so acTL
+// is written with 0 frames and patched on close.
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// pngChunks splits an encoded PNG into its chunks.
+func pngChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("png: bad signature")
+	}
+	data = data[len(pngSignature):]
+	var chunks []pngChunk
+	for len(data) >= 12 {
+		n := int(binary.BigEndian.Uint32(data))
+		if len(data) < 12+n {
+			return nil, errors.New("png: truncated chunk")
+		}
+		chunks = append(chunks, pngChunk{typ: string(data[4:8]), data: data[8 : 8+n]})
+		data = data[12+n:]
+	}
+	return chunks, nil
+}
+
+type apngSink struct {
+	f      *os.File
+	n      int64
+	canvas image.Rectangle
+	frames uint32
+	seq    uint32 // fcTL and fdAT share one sequence
+	actlAt int64  // file offset of the acTL chunk
+	enc    png.Encoder
+	buf    bytes.Buffer
+	err    error
+}
+
+func newAPNGSink(path string) (*apngSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &apngSink{f: f, enc: png.Encoder{CompressionLevel: png.BestSpeed}}, nil
+}
+
+func (s *apngSink) writeFrame(img image.Image, delay int) error {
+	if s.err != nil {
+		return s.err
+	}
+	first := s.canvas.Empty()
+	if first {
+		s.canvas = image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+
+	s.buf.Reset()
+	if err := s.enc.Encode(&s.buf, opaqueFrame(img, s.canvas)); err != nil {
+		return err
+	}
+	chunks, err := pngChunks(s.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if first {
+		s.write(pngSignature)
+		s.writeChunk(chunks[0].typ, chunks[0].data) // IHDR
+		s.actlAt = s.n
+		s.writeChunk("acTL", make([]byte, 8))
+	}
+
+	fctl := make([]byte, 26)
+	binary.BigEndian.PutUint32(fctl[0:], s.seq)
+	binary.BigEndian.PutUint32(fctl[4:], uint32(s.canvas.Dx()))
+	binary.BigEndian.PutUint32(fctl[8:], uint32(s.canvas.Dy()))
+	// x and y offsets stay 0: every frame covers the canvas.
+	binary.BigEndian.PutUint16(fctl[20:], uint16(delay))
+	binary.BigEndian.PutUint16(fctl[22:], 100)
+	// dispose_op and blend_op stay 0: none, source.
+	s.seq++
+	s.writeChunk("fcTL", fctl)
+
+	for _, c := range chunks {
+		if c.typ != "IDAT" {
+			continue
+		}
+		if first {
+			s.writeChunk("IDAT", c.data)
+			continue
+		}
+		fdat := make([]byte, 4+len(c.data))
+		binary.BigEndian.PutUint32(fdat, s.seq)
+		copy(fdat[4:], c.data)
+		s.seq++
+		s.writeChunk("fdAT", fdat)
+	}
+	s.frames++
+	return s.err
+}
+
+// opaqueFrame draws img onto a black canvas-sized image, so every frame
+// has the same size and encodes with the same (opaque RGB) color type.
+func opaqueFrame(img image.Image, canvas image.Rectangle) *image.RGBA {
+	out := image.NewRGBA(canvas)
+	draw.Draw(out, canvas, image.Black, image.Point{}, draw.Src)
+	draw.Draw(out, canvas, img, img.Bounds().Min, draw.Over)
+	return out
+}
+
+func (s *apngSink) write(p []byte) {
+	if s.err != nil {
+		return
+	}
+	n, err := s.f.Write(p)
+	s.n += int64(n)
+	s.err = err
+}
+
+func (s *apngSink) writeChunk(typ string, data []byte) {
+	s.write(pngChunkBytes(typ, data))
+}
+
+func pngChunkBytes(typ string, data []byte) []byte {
+	b := make([]byte, 8+len(data)+4)
+	binary.BigEndian.PutUint32(b, uint32(len(data)))
+	copy(b[4:], typ)
+	copy(b[8:], data)
+	binary.BigEndian.PutUint32(b[8+len(data):], crc32.ChecksumIEEE(b[4:8+len(data)]))
+	return b
+}
+
+func (s *apngSink) size() int64 {
+	return s.n
+}
+
+func (s *apngSink) close() error {
+	if s.frames > 0 {
+		s.writeChunk("IEND", nil)
+		actl := make([]byte, 8)
+		binary.BigEndian.PutUint32(actl, s.frames)
+		// num_plays stays 0: loop forever.
+		if s.err == nil {
+			_, s.err = s.f.WriteAt(pngChunkBytes("acTL", actl), s.actlAt)
+		}
+	}
+	if err := s.f.Close(); s.err == nil {
+		s.err = err
+	}
+	if s.err != nil {
+		return fmt.Errorf("apng: %w", s.err)
+	}
+	return nil
+}
+
+func (s *apngSink) summary() string {
+	return ""
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordFrames records the ball pattern in color mode, 100ms apart.
+func recordFrames(t *testing.T, format recordingFormat, path string, n int) []image.Image {
+	t.Helper()
+	rec, err := startRecording(path, format, RecordingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newFakeReader(drawBall)
+	var frames []image.Image
+	for i := 0; i < n; i++ {
+		img := readFrame(t, r)
+		frames = append(frames, img)
+		rec.add(recFrame{img: img, at: time.Unix(0, 0).Add(time.Duration(i) * 100 * time.Millisecond), mode: ModeColor})
+	}
+	msg := string(rec.stop()().(statusMsg))
+	if want := "Saved " + format.String(); !strings.HasPrefix(msg, want) {
+		t.Fatalf("stop returned %q, want %q...", msg, want)
+	}
+	return frames
+}
+
+// apngFrames pulls each frame of an APNG back out as a standalone PNG and
+// decodes it, checking the animation chunks along the way.
+func apngFrames(t *testing.T, data []byte) ([]image.Image, []uint16) {
+	t.Helper()
+	chunks, err := pngChunks(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunks[0].typ != "IHDR" || chunks[1].typ != "acTL" {
+		t.Fatalf("chunks start %s, %s; want IHDR, acTL", chunks[0].typ, chunks[1].typ)
+	}
+	ihdr := chunks[0]
+	numFrames := binary.BigEndian.Uint32(chunks[1].data)
+
+	var frames [][]byte
+	var delays []uint16
+	seq := uint32(0)
+	for _, c := range chunks[2:] {
+		switch c.typ {
+		case "fcTL", "fdAT":
+			if got := binary.BigEndian.Uint32(c.data); got != seq {
+				t.Fatalf("%s has sequence %d, want %d", c.typ, got, seq)
+			}
+			seq++
+		}
+		switch c.typ {
+		case "fcTL":
+			frames = append(frames, nil)
+			delays = append(delays, binary.BigEndian.Uint16(c.data[20:]))
+			if den := binary.BigEndian.Uint16(c.data[22:]); den != 100 {
+				t.Errorf("delay denominator %d, want 100", den)
+			}
+		case "IDAT":
+			if len(frames) != 1 {
+				t.Fatalf("IDAT in frame %d, want only the first", len(frames)-1)
+			}
+			frames[0] = append(frames[0], c.data...)
+		case "fdAT":
+			frames[len(frames)-1] = append(frames[len(frames)-1], c.data[4:]...)
+		}
+	}
+	if int(numFrames) != len(frames) {
+		t.Errorf("acTL says %d frames, found %d", numFrames, len(frames))
+	}
+
+	var imgs []image.Image
+	for _, idat := range frames {
+		var buf bytes.Buffer
+		buf.Write(pngSignature)
+		buf.Write(pngChunkBytes("IHDR", ihdr.data))
+		buf.Write(pngChunkBytes("IDAT", idat))
+		buf.Write(pngChunkBytes("IEND", nil))
+		img, err := png.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imgs = append(imgs, img)
+	}
+	return imgs, delays
+}
+
+func TestAPNGRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.png")
+	want := recordFrames(t, recordAPNG, path, 4)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Plain PNG decoders see the first frame.
+	still, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sameImage(still, want[0]); err != nil {
+		t.Errorf("default image: %v", err)
+	}
+
+	got, delays := apngFrames(t, data)
+	if len(got) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if err := sameImage(got[i], want[i]); err != nil {
+			t.Errorf("frame %d: %v", i, err)
+		}
+		if delays[i] != 10 {
+			t.Errorf("frame %d delay = %d, want 10", i, delays[i])
+		}
+	}
+}
+
+func TestPNGSequenceRecording(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "clip")
+	want := recordFrames(t, recordPNGSequence, dir, 3)
+
+	for i := range want {
+		f, err := os.Open(filepath.Join(dir, fmt.Sprintf("frame_%06d.png", i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sameImage(img, want[i]); err != nil {
+			t.Errorf("frame %d: %v", i, err)
+		}
+	}
+
+	list, err := os.ReadFile(filepath.Join(dir, "frames.ffconcat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "frames.ffconcat", list)
+}
+
+func TestEmptyPNGSequenceIsRemoved(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "clip")
+	rec, err := startRecording(dir, recordPNGSequence, RecordingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.stop()()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("empty recording left its directory behind")
+	}
+}
+
+func TestRecordingFormatKey(t *testing.T) {
+	m := testModel()
+	for _, want := range []recordingFormat{recordAPNG, recordPNGSequence, recordAVI, recordAsciicast, recordHTML, recordGIF} {
+		m, _ = send(t, m, keyPress("g"))
+		if m.recFormat != want {
+			t.Fatalf("recFormat = %v, want %v", m.recFormat, want)
+		}
+	}
+	if _, err := parseRecordingFormat("webm"); err == nil {
+		t.Error("parseRecordingFormat accepted webm")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --- Asciicast Recording ---
+//
+// The text modes are text, so record them as text: an asciicast v2 file is
+// a JSON header line followed by one [time, "o", data] line per chunk of
+// terminal output. Each frame is written as cursor-home plus a full redraw,
+// with the color mode's SGR sequences left in. `asciinema play clip.cast`
+// plays it back, and asciinema-player embeds it on a web page.
+//
+// The terminal size in the header comes from the first frame. Lines are
+// cleared to the end as they're drawn, so a narrower later frame doesn't
+// leave bits of the previous one behind.
+
+const (
+	castHideCursor = "\x1b[?25l"
+	castClear      = "\x1b[2J"
+	castHome       = "\x1b[H"
+	castEraseLine  = "\x1b[K"
+	castEraseBelow = "\x1b[J"
+)
+
+type castHeader struct {
+	Version   int    `json:"version"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Timestamp int64  `json:"timestamp"`
+	Title     string `json:"title,omitempty"`
+}
+
+type asciicastSink struct {
+	f       *os.File
+	w       *bufio.Writer
+	n       int64
+	start   time.Time
+	elapsed int // 1/100 s up to the current frame
+	frames  int
+	width   int
+	height  int
+	err     error
+}
+
+func newAsciicastSink(path string) (*asciicastSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &asciicastSink{f: f, start: time.Now()}
+	s.w = bufio.NewWriter(&countingWriter{w: f, n: &s.n})
+	return s, nil
+}
+
+func (s *asciicastSink) writeText(text string, delay int) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.frames == 0 {
+		s.width = lipgloss.Width(text)
+		s.height = strings.Count(strings.TrimSuffix(text, "\n"), "\n") + 1
+		s.writeLine(castHeader{
+			Version:   2,
+			Width:     s.width,
+			Height:    s.height,
+			Timestamp: s.start.Unix(),
+			Title:     "Atlas Cam",
+		})
+	}
+	out := terminalFrame(text, s.frames == 0)
+	if s.frames == 0 {
+		out = castHideCursor + out
+	}
+	s.writeEvent(s.elapsed, out)
+	s.elapsed += delay
+	s.frames++
+	return s.err
+}
+
+// writeEvent writes an output event at t (in 1/100 s).
+func (s *asciicastSink) writeEvent(t int, data string) {
+	s.writeLine([]any{float64(t) / 100, "o", data})
+}
+
+func (s *asciicastSink) writeLine(v any) {
+	if s.err != nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.w.Write(b)
+	_, s.err = s.w.WriteString("\n")
+}
+
+func (s *asciicastSink) size() int64 {
+	return s.n + int64(s.w.Buffered())
+}
+
+func (s *asciicastSink) close() error {
+	if s.frames > 0 {
+		// Players stop at the last event, so give the last frame its time.
+		s.writeEvent(s.elapsed, "")
+	}
+	if err := s.w.Flush(); s.err == nil {
+		s.err = err
+	}
+	if err := s.f.Close(); s.err == nil {
+		s.err = err
+	}
+	return s.err
+}
+
+func (s *asciicastSink) summary() string {
+	return fmt.Sprintf("%dx%d", s.width, s.height)
+}
+
+// terminalFrame is the output that redraws the screen with text, clearing
+// it first for the first frame. `atlas.cam serve` streams frames the same
+// way.
+func terminalFrame(text string, first bool) string {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	out := castHome
+	if first {
+		out = castClear + castHome
+	}
+	return out + strings.Join(lines, castEraseLine+"\r\n") + castEraseLine + castEraseBelow
+}
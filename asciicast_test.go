@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordCast records n ball frames in mode, 100ms apart, and returns the
+// header and events.
+func recordCast(t *testing.T, mode Mode, n int) (castHeader, [][]any) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "clip.cast")
+	rec, err := startRecording(path, recordAsciicast, RecordingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newFakeReader(drawBall)
+	for i := 0; i < n; i++ {
+		at := time.Unix(0, 0).Add(time.Duration(i) * 100 * time.Millisecond)
+		rec.add(recFrame{img: readFrame(t, r), at: at, mode: mode, width: 40, height: 16})
+	}
+	if msg := string(rec.stop()().(statusMsg)); !strings.HasPrefix(msg, "Saved asciicast") {
+		t.Fatalf("stop returned %q", msg)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	var hdr castHeader
+	var events [][]any
+	for sc.Scan() {
+		if hdr.Version == 0 {
+			if err := json.Unmarshal(sc.Bytes(), &hdr); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		var ev []any
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+	return hdr, events
+}
+
+func TestAsciicastRecording(t *testing.T) {
+	hdr, events := recordCast(t, ModeASCII, 3)
+	// The art is fitted inside 40x12, keeping the frame's aspect ratio.
+	if hdr.Version != 2 || hdr.Width < 1 || hdr.Width > 40 || hdr.Height != 12 {
+		t.Errorf("header = %+v, want version 2, at most 40x12", hdr)
+	}
+	if len(events) != 4 {
+		t.Fatalf("%d events, want 3 frames and an end marker", len(events))
+	}
+	for i, ev := range events {
+		if want := float64(i) / 10; ev[0] != want || ev[1] != "o" {
+			t.Errorf("event %d = [%v %v], want [%v o]", i, ev[0], ev[1], want)
+		}
+	}
+
+	first := events[0][2].(string)
+	if !strings.HasPrefix(first, castHideCursor+castClear+castHome) {
+		t.Errorf("first frame starts %q, want a clear screen", first[:12])
+	}
+	second := events[1][2].(string)
+	if !strings.HasPrefix(second, castHome) || strings.Contains(second, castClear) {
+		t.Errorf("later frames should redraw from home without clearing")
+	}
+	if strings.Contains(second, "\x1b[38;") {
+		t.Error("ASCII frame has color sequences")
+	}
+	if n := strings.Count(second, "\r\n"); n != hdr.Height-1 {
+		t.Errorf("frame has %d line breaks, want %d", n, hdr.Height-1)
+	}
+	if events[3][2] != "" {
+		t.Errorf("end marker = %q, want empty", events[3][2])
+	}
+}
+
+func TestAsciicastKeepsColor(t *testing.T) {
+	_, events := recordCast(t, ModeColor, 2)
+	frame := events[0][2].(string)
+	if !strings.Contains(frame, "\x1b[38;2;") || !strings.Contains(frame, "█") {
+		t.Error("color frame lost its SGR sequences")
+	}
+}
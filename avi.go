@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+)
+
+// --- AVI Recording ---
+//
+// Motion-JPEG in an AVI 1.0 (RIFF) container: every frame is a standalone
+// JPEG in a "00dc" chunk, followed by an idx1 index at the end. Practically
+// every player and editor opens it, and it needs nothing beyond image/jpeg.
+//
+// AVI runs at a constant rate, so variable capture timing is mapped onto a
+// fixed timebase: a frame that should stay up for several ticks is followed
+// by empty "00dc" chunks, which players treat as "repeat the last frame".
+// The header is written up front with zero counts and rewritten on close.
+// Sizes are 32-bit, so a file stops growing at aviMaxSize.
+
+const (
+	aviDefaultRate = 30
+	aviJPEGQuality = 85
+	aviHeaderSize  = 224 // RIFF, hdrl with avih/strl/strh/strf, LIST movi
+	aviMaxSize     = math.MaxUint32 - 1<<20
+
+	aviKeyframe = 0x10 // AVIIF_KEYFRAME
+	aviHasIndex = 0x10 // AVIF_HASINDEX
+)
+
+var errAVITooLarge = errors.New("avi: reached the 4 GB AVI size limit")
+
+type aviIndexEntry struct {
+	flags  uint32
+	offset uint32 // from the "movi" fourcc
+	size   uint32
+}
+
+type aviSink struct {
+	f        *os.File
+	n        int64
+	canvas   image.Rectangle
+	rate     int
+	index    []aviIndexEntry
+	elapsed  int // 1/100 s of recording written so far
+	maxChunk uint32
+	buf      bytes.Buffer
+	err      error
+}
+
+// newAVISink records at fps, or aviDefaultRate if fps is 0.
+func newAVISink(path string, fps float64) (*aviSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	rate := int(math.Round(fps))
+	if rate <= 0 {
+		rate = aviDefaultRate
+	}
+	return &aviSink{f: f, rate: rate}, nil
+}
+
+func (s *aviSink) writeFrame(img image.Image, delay int) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.canvas.Empty() {
+		s.canvas = image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy())
+		s.write(s.header())
+	}
+
+	s.buf.Reset()
+	if err := jpeg.Encode(&s.buf, opaqueFrame(img, s.canvas), &jpeg.Options{Quality: aviJPEGQuality}); err != nil {
+		return err
+	}
+	if s.n+int64(s.buf.Len())+int64(16*len(s.index)) > aviMaxSize {
+		return errAVITooLarge
+	}
+	s.writeChunk(aviKeyframe, s.buf.Bytes())
+
+	// Pad out to the frame's share of the timebase, rounding on the running
+	// total so the clip length doesn't drift.
+	written := len(s.index)
+	s.elapsed += delay
+	ticks := int(math.Round(float64(s.elapsed) * float64(s.rate) / 100))
+	for i := written; i < ticks; i++ {
+		s.writeChunk(0, nil)
+	}
+	return s.err
+}
+
+func (s *aviSink) writeChunk(flags uint32, data []byte) {
+	s.index = append(s.index, aviIndexEntry{
+		flags:  flags,
+		offset: uint32(s.n - (aviHeaderSize - 4)),
+		size:   uint32(len(data)),
+	})
+	s.maxChunk = max(s.maxChunk, uint32(len(data)))
+
+	hdr := make([]byte, 8)
+	copy(hdr, "00dc")
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(len(data)))
+	s.write(hdr)
+	s.write(data)
+	if len(data)%2 == 1 {
+		s.write([]byte{0}) // chunks are word aligned
+	}
+}
+
+func (s *aviSink) write(p []byte) {
+	if s.err != nil {
+		return
+	}
+	n, err := s.f.Write(p)
+	s.n += int64(n)
+	s.err = err
+}
+
+// header builds everything up to the first frame chunk. Before close the
+// frame counts and sizes in it are still zero.
+func (s *aviSink) header() []byte {
+	var b bytes.Buffer
+	le := func(v ...any) {
+		for _, x := range v {
+			binary.Write(&b, binary.LittleEndian, x)
+		}
+	}
+	w, h := uint32(s.canvas.Dx()), uint32(s.canvas.Dy())
+	frames := uint32(len(s.index))
+	moviSize := uint32(0)
+	riffSize := uint32(0)
+	if s.n > aviHeaderSize {
+		// movi runs from its fourcc to here; idx1 comes after it.
+		moviSize = uint32(s.n - (aviHeaderSize - 4))
+		riffSize = uint32(s.n + 8 + 16*int64(len(s.index)) - 8)
+	}
+
+	b.WriteString("RIFF")
+	le(riffSize)
+	b.WriteString("AVI ")
+
+	b.WriteString("LIST")
+	le(uint32(192))
+	b.WriteString("hdrl")
+	b.WriteString("avih")
+	le(uint32(56))
+	le(uint32(1000000/s.rate), s.maxChunk*uint32(s.rate), uint32(0), uint32(aviHasIndex))
+	le(frames, uint32(0), uint32(1), s.maxChunk, w, h)
+	le([4]uint32{})
+
+	b.WriteString("LIST")
+	le(uint32(116))
+	b.WriteString("strl")
+	b.WriteString("strh")
+	le(uint32(56))
+	b.WriteString("vids")
+	b.WriteString("MJPG")
+	le(uint32(0), uint16(0), uint16(0), uint32(0))
+	le(uint32(1), uint32(s.rate), uint32(0), frames, s.maxChunk)
+	le(uint32(math.MaxUint32), uint32(0)) // default quality, variable sample size
+	le(int16(0), int16(0), int16(w), int16(h))
+	b.WriteString("strf")
+	le(uint32(40))
+	le(uint32(40), int32(w), int32(h), uint16(1), uint16(24))
+	b.WriteString("MJPG")
+	le(w*h*3, int32(0), int32(0), uint32(0), uint32(0))
+
+	b.WriteString("LIST")
+	le(moviSize)
+	b.WriteString("movi")
+	return b.Bytes()
+}
+
+func (s *aviSink) size() int64 {
+	return s.n
+}
+
+func (s *aviSink) close() error {
+	if len(s.index) > 0 && s.err == nil {
+		idx := make([]byte, 8+16*len(s.index))
+		copy(idx, "idx1")
+		binary.LittleEndian.PutUint32(idx[4:], uint32(16*len(s.index)))
+		for i, e := range s.index {
+			p := idx[8+16*i:]
+			copy(p, "00dc")
+			binary.LittleEndian.PutUint32(p[4:], e.flags)
+			binary.LittleEndian.PutUint32(p[8:], e.offset)
+			binary.LittleEndian.PutUint32(p[12:], e.size)
+		}
+		hdr := s.header() // sizes as of the end of movi
+		s.write(idx)
+		if s.err == nil {
+			_, s.err = s.f.WriteAt(hdr, 0)
+		}
+	}
+	if err := s.f.Close(); s.err == nil {
+		s.err = err
+	}
+	if s.err != nil {
+		return fmt.Errorf("avi: %w", s.err)
+	}
+	return nil
+}
+
+func (s *aviSink) summary() string {
+	return fmt.Sprintf("%d fps", s.rate)
+}
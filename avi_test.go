@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type riffChunk struct {
+	id   string
+	data []byte
+}
+
+// riffChunks splits a run of RIFF chunks, skipping pad bytes.
+func riffChunks(t *testing.T, data []byte) []riffChunk {
+	t.Helper()
+	var chunks []riffChunk
+	for len(data) >= 8 {
+		n := int(binary.LittleEndian.Uint32(data[4:]))
+		if len(data) < 8+n {
+			t.Fatalf("chunk %q truncated", data[:4])
+		}
+		chunks = append(chunks, riffChunk{id: string(data[:4]), data: data[8 : 8+n]})
+		data = data[8+n+n%2:]
+	}
+	return chunks
+}
+
+func TestAVIRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.avi")
+	want := recordFrames(t, recordAVI, path, 4)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:4]) != "RIFF" || string(data[8:12]) != "AVI " {
+		t.Fatalf("bad RIFF header %q", data[:12])
+	}
+	if n := binary.LittleEndian.Uint32(data[4:]); int(n) != len(data)-8 {
+		t.Errorf("RIFF size = %d, want %d", n, len(data)-8)
+	}
+
+	top := riffChunks(t, data[12:])
+	if len(top) != 3 || top[0].id != "LIST" || top[1].id != "LIST" || top[2].id != "idx1" {
+		t.Fatalf("unexpected layout %v", top)
+	}
+	hdrl, movi := top[0].data, top[1].data
+	avih := hdrl[12:]
+	totalFrames := binary.LittleEndian.Uint32(avih[16:])
+	width := binary.LittleEndian.Uint32(avih[32:])
+	height := binary.LittleEndian.Uint32(avih[36:])
+	strh := hdrl[4+64+12+8:]
+	if rate := binary.LittleEndian.Uint32(strh[24:]); rate != aviDefaultRate {
+		t.Errorf("strh rate = %d, want %d", rate, aviDefaultRate)
+	}
+	if length := binary.LittleEndian.Uint32(strh[32:]); length != totalFrames {
+		t.Errorf("strh length = %d, avih frames = %d", length, totalFrames)
+	}
+
+	// 100ms frames at 30 fps take 3 ticks each: one picture, two repeats.
+	if string(movi[:4]) != "movi" {
+		t.Fatalf("second LIST is %q", movi[:4])
+	}
+	chunks := riffChunks(t, movi[4:])
+	if len(chunks) != 12 || int(totalFrames) != len(chunks) {
+		t.Fatalf("%d chunks, %d frames in header, want 12", len(chunks), totalFrames)
+	}
+	if n := len(top[2].data) / 16; n != len(chunks) {
+		t.Errorf("idx1 has %d entries, want %d", n, len(chunks))
+	}
+	for i, c := range chunks {
+		if c.id != "00dc" {
+			t.Fatalf("chunk %d is %q", i, c.id)
+		}
+		if empty := len(c.data) == 0; empty != (i%3 != 0) {
+			t.Errorf("chunk %d has %d bytes", i, len(c.data))
+		}
+		entry := top[2].data[16*i:]
+		offset := binary.LittleEndian.Uint32(entry[8:])
+		if got := movi[offset+8 : int(offset)+8+len(c.data)]; !bytes.Equal(got, c.data) {
+			t.Errorf("idx1 entry %d points at the wrong data", i)
+		}
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(chunks[0].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := renderRecFrame(recFrame{img: want[0], mode: ModeColor})
+	if img.Bounds().Dx() != rendered.Bounds().Dx() || img.Bounds().Dy() != rendered.Bounds().Dy() {
+		t.Errorf("frame is %v, want %v", img.Bounds(), rendered.Bounds())
+	}
+	if int(width) != img.Bounds().Dx() || int(height) != img.Bounds().Dy() {
+		t.Errorf("avih size = %dx%d, want %v", width, height, img.Bounds())
+	}
+}
+
+func TestRawFrameRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.avi")
+	rec, err := startRecording(path, recordAVI, RecordingConfig{RawFrames: true, FPS: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newFakeReader(drawBall)
+	src := readFrame(t, r)
+	for i := 0; i < 3; i++ {
+		rec.add(recFrame{img: src, at: time.Unix(0, 0).Add(time.Duration(i) * 100 * time.Millisecond), mode: ModeColor})
+	}
+	msg := string(rec.stop()().(statusMsg))
+	if !strings.HasPrefix(msg, "Saved AVI") || !strings.Contains(msg, "10 fps") {
+		t.Fatalf("stop returned %q", msg)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := riffChunks(t, data[12:])
+	chunks := riffChunks(t, top[1].data[4:])
+	if len(chunks) != 3 {
+		t.Fatalf("%d chunks at 10 fps, want 3", len(chunks))
+	}
+	img, err := jpeg.Decode(bytes.NewReader(chunks[0].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Size() != src.Bounds().Size() {
+		t.Errorf("raw frame is %v, want camera size %v", img.Bounds(), src.Bounds())
+	}
+}
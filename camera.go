@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pion/mediadevices"
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+// --- Camera Negotiation ---
+//
+// mediadevices picks a mode for us but never says which one, so we run the
+// same fitness search ourselves over the drivers' advertised modes and then
+// ask for the winner exactly. That way the status bar shows what we really
+// got, not what we hoped for.
+
+var frameFormats = []frame.Format{
+	frame.FormatMJPEG, frame.FormatYUYV, frame.FormatYUY2, frame.FormatUYVY,
+	frame.FormatI420, frame.FormatNV12, frame.FormatNV21, frame.FormatI444,
+	frame.FormatRGBA,
+}
+
+func parseFrameFormat(s string) (frame.Format, error) {
+	for _, f := range frameFormats {
+		if strings.EqualFold(s, string(f)) {
+			return f, nil
+		}
+	}
+	names := make([]string, len(frameFormats))
+	for i, f := range frameFormats {
+		names[i] = string(f)
+	}
+	return "", fmt.Errorf("unknown pixel format %q (have: %s)", s, strings.Join(names, ", "))
+}
+
+// constraints turns the requested settings into ideal (not exact)
+// constraints, so a camera that can't do 1080p still opens at its best.
+func (c CameraConfig) constraints() prop.MediaConstraints {
+	var mc prop.MediaConstraints
+	if c.Width > 0 {
+		mc.Width = prop.Int(c.Width)
+	}
+	if c.Height > 0 {
+		mc.Height = prop.Int(c.Height)
+	}
+	if c.FrameRate > 0 {
+		mc.FrameRate = prop.Float(float32(c.FrameRate))
+	}
+	if f, err := parseFrameFormat(c.Format); err == nil {
+		mc.FrameFormat = prop.FrameFormat(f)
+	}
+	return mc
+}
+
+func formatMode(v prop.Video) string {
+	s := fmt.Sprintf("%dx%d %s", v.Width, v.Height, v.FrameFormat)
+	if v.FrameRate > 0 {
+		s += fmt.Sprintf(" @%sfps", strings.TrimSuffix(fmt.Sprintf("%.2f", v.FrameRate), ".00"))
+	}
+	return s
+}
+
+var cameraFilter = driver.FilterAnd(driver.FilterVideoRecorder(), driver.FilterDeviceType(driver.Camera))
+
+func cameraDrivers(deviceID string) []driver.Driver {
+	all := driver.GetManager().Query(cameraFilter)
+
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	// A rescan swaps every driver for a new one. The one we're streaming
+	// from stands in for its replacement while it's open, and an ID from
+	// before the scan still finds the device by its label.
+	open := make(map[string]driver.Driver)
+	for _, d := range heldDrivers {
+		if d.Status() != driver.StateClosed {
+			open[d.Info().Label] = d
+		}
+	}
+	label := ""
+	if d, ok := heldDrivers[deviceID]; ok {
+		label = d.Info().Label
+	}
+
+	var drivers []driver.Driver
+	for _, d := range all {
+		if h, ok := open[d.Info().Label]; ok {
+			d = h
+		}
+		if deviceID == "" || d.ID() == deviceID || d.Info().Label == label {
+			drivers = append(drivers, d)
+		}
+	}
+	return drivers
+}
+
+var (
+	heldMu      sync.Mutex
+	heldDrivers = make(map[string]driver.Driver) // by ID
+)
+
+// holdDriver remembers d as the driver a stream was opened on, so rescans
+// don't hand out a second driver for the same device.
+func holdDriver(d driver.Driver) {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	for id, h := range heldDrivers {
+		if h.Status() == driver.StateClosed && h.Info().Label == d.Info().Label {
+			delete(heldDrivers, id)
+		}
+	}
+	heldDrivers[d.ID()] = d
+}
+
+// deviceModes lists the modes a driver advertises, largest first. Drivers
+// that aren't open get opened just long enough to ask.
+func deviceModes(d driver.Driver) ([]prop.Video, error) {
+	if d.Status() == driver.StateClosed {
+		if err := d.Open(); err != nil {
+			return nil, err
+		}
+		defer d.Close()
+	}
+
+	seen := make(map[prop.Video]bool)
+	var modes []prop.Video
+	for _, p := range d.Properties() {
+		v := prop.Video{Width: p.Width, Height: p.Height, FrameRate: p.FrameRate, FrameFormat: p.FrameFormat}
+		if !seen[v] {
+			seen[v] = true
+			modes = append(modes, v)
+		}
+	}
+
+	sort.Slice(modes, func(i, j int) bool {
+		a, b := modes[i], modes[j]
+		if a.Width*a.Height != b.Width*b.Height {
+			return a.Width*a.Height > b.Width*b.Height
+		}
+		if a.FrameRate != b.FrameRate {
+			return a.FrameRate > b.FrameRate
+		}
+		return a.FrameFormat < b.FrameFormat
+	})
+	return modes, nil
+}
+
+var errNoCamera = errors.New("no camera supports the requested mode")
+
+// negotiateCamera finds the device and mode closest to want. deviceID may
+// be empty to consider every camera.
+func negotiateCamera(deviceID string, want CameraConfig) (driver.Driver, prop.Video, error) {
+	mc := want.constraints()
+
+	var best driver.Driver
+	var bestMode prop.Video
+	bestDist := math.Inf(1)
+	for _, d := range cameraDrivers(deviceID) {
+		modes, err := deviceModes(d)
+		if err != nil {
+			continue
+		}
+		for _, v := range modes {
+			dist, ok := mc.FitnessDistance(prop.Media{Video: v})
+			if !ok {
+				continue
+			}
+			dist -= float64(d.Info().Priority)
+			if dist < bestDist {
+				best, bestMode, bestDist = d, v, dist
+			}
+		}
+	}
+
+	if best == nil {
+		return nil, prop.Video{}, errNoCamera
+	}
+	return best, bestMode, nil
+}
+
+// openCamera opens deviceID (or the best camera, if empty) in the mode that
+// best matches want.
+func openCamera(deviceID string, want CameraConfig) (cameraReadyMsg, error) {
+	d, mode, err := negotiateCamera(deviceID, want)
+
+	s, gumErr := mediadevices.GetUserMedia(mediadevices.MediaStreamConstraints{
+		Video: func(c *mediadevices.MediaTrackConstraints) {
+			if err != nil {
+				// Nothing advertised modes (some drivers don't), so fall
+				// back to letting mediadevices pick.
+				if deviceID != "" {
+					c.DeviceID = prop.String(deviceID)
+				}
+				c.MediaConstraints = want.constraints()
+				return
+			}
+			c.DeviceID = prop.StringExact(d.ID())
+			c.Width = prop.IntExact(mode.Width)
+			c.Height = prop.IntExact(mode.Height)
+			c.FrameFormat = prop.FrameFormatExact(mode.FrameFormat)
+			if mode.FrameRate > 0 {
+				c.FrameRate = prop.FloatExact(mode.FrameRate)
+			}
+		},
+	})
+	if gumErr != nil {
+		return cameraReadyMsg{}, gumErr
+	}
+
+	if len(s.GetVideoTracks()) == 0 {
+		for _, t := range s.GetTracks() {
+			t.Close()
+		}
+		return cameraReadyMsg{}, fmt.Errorf("no video tracks found")
+	}
+
+	track := s.GetVideoTracks()[0]
+	videoTrack := track.(*mediadevices.VideoTrack)
+
+	msg := cameraReadyMsg{stream: s, reader: videoTrack.NewReader(false)}
+	if err == nil {
+		holdDriver(d)
+		msg.deviceID = d.ID()
+		msg.driverID = d.Info().Label
+		msg.source = videoSource{kind: sourceCamera, label: d.Info().Label}.key()
+		msg.format = formatMode(mode)
+	}
+	return msg, nil
+}
+
+// --- Mode Picker ---
+
+type cameraModesMsg struct {
+	deviceID string
+	modes    []prop.Video
+	err      error
+}
+
+func queryModesCmd(deviceID string) tea.Cmd {
+	return func() tea.Msg {
+		drivers := cameraDrivers(deviceID)
+		if len(drivers) == 0 {
+			return cameraModesMsg{deviceID: deviceID, err: fmt.Errorf("camera %s not found", deviceID)}
+		}
+		modes, err := deviceModes(drivers[0])
+		return cameraModesMsg{deviceID: deviceID, modes: modes, err: err}
+	}
+}
+
+// withMode returns c asking for exactly the mode v.
+func (c CameraConfig) withMode(v prop.Video) CameraConfig {
+	c.Width = v.Width
+	c.Height = v.Height
+	c.FrameRate = float64(v.FrameRate)
+	c.Format = string(v.FrameFormat)
+	return c
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+func TestParseFrameFormat(t *testing.T) {
+	if f, err := parseFrameFormat("mjpeg"); err != nil || f != frame.FormatMJPEG {
+		t.Errorf("parseFrameFormat(mjpeg) = %v, %v", f, err)
+	}
+	if _, err := parseFrameFormat("h264"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestCameraConstraintsPreferClosestMode(t *testing.T) {
+	want := CameraConfig{Width: 1280, Height: 720, FrameRate: 30, Format: "MJPEG"}
+	mc := want.constraints()
+
+	modes := []prop.Video{
+		{Width: 640, Height: 480, FrameRate: 30, FrameFormat: frame.FormatYUYV},
+		{Width: 1280, Height: 720, FrameRate: 10, FrameFormat: frame.FormatYUYV},
+		{Width: 1280, Height: 720, FrameRate: 30, FrameFormat: frame.FormatMJPEG},
+		{Width: 1920, Height: 1080, FrameRate: 30, FrameFormat: frame.FormatMJPEG},
+	}
+	best, bestDist := -1, 0.0
+	for i, v := range modes {
+		dist, ok := mc.FitnessDistance(prop.Media{Video: v})
+		if ok && (best < 0 || dist < bestDist) {
+			best, bestDist = i, dist
+		}
+	}
+	if best != 2 {
+		t.Errorf("best mode = %s, want %s", formatMode(modes[best]), formatMode(modes[2]))
+	}
+}
+
+func TestFormatMode(t *testing.T) {
+	tests := []struct {
+		v    prop.Video
+		want string
+	}{
+		{prop.Video{Width: 1280, Height: 720, FrameRate: 30, FrameFormat: frame.FormatMJPEG}, "1280x720 MJPEG @30fps"},
+		{prop.Video{Width: 640, Height: 480, FrameRate: 7.5, FrameFormat: frame.FormatYUYV}, "640x480 YUYV @7.50fps"},
+		{prop.Video{Width: 320, Height: 240, FrameFormat: frame.FormatI420}, "320x240 I420"},
+	}
+	for _, tt := range tests {
+		if got := formatMode(tt.v); got != tt.want {
+			t.Errorf("formatMode = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestCameraConfigMerge(t *testing.T) {
+	base := CameraConfig{Width: 640, Height: 480, Format: "YUYV"}
+	got := base.merge(CameraConfig{Width: 1280, FrameRate: 15})
+	want := CameraConfig{Width: 1280, Height: 480, FrameRate: 15, Format: "YUYV"}
+	if got != want {
+		t.Errorf("merge = %+v, want %+v", got, want)
+	}
+}
+
+func TestCameraModePicker(t *testing.T) {
+	m := testModel()
+	m.activeID = "cam0"
+	m.format = "640x480 YUYV @30fps"
+
+	modes := []prop.Video{
+		{Width: 1280, Height: 720, FrameRate: 30, FrameFormat: frame.FormatMJPEG},
+		{Width: 640, Height: 480, FrameRate: 30, FrameFormat: frame.FormatYUYV},
+	}
+	m, _ = send(t, m, cameraModesMsg{deviceID: "cam0", modes: modes})
+	if m.picker == nil {
+		t.Fatal("picker not opened")
+	}
+	if m.picker.active != 1 || m.picker.cursor != 1 {
+		t.Errorf("active = %d, cursor = %d, want the current mode (1)", m.picker.active, m.picker.cursor)
+	}
+
+	// Keys go to the picker while it's open, not to the main bindings.
+	m, _ = send(t, m, keyPress("k"))
+	m, _ = send(t, m, keyPress("m"))
+	if m.mode != ModeASCII {
+		t.Error("'m' changed the render mode while the picker was open")
+	}
+
+	gen := m.readerGen
+	m, cmd := send(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.picker != nil || cmd == nil {
+		t.Fatal("choosing an entry should close the picker and reopen the camera")
+	}
+	if m.cfg.Camera != (CameraConfig{Width: 1280, Height: 720, FrameRate: 30, Format: "MJPEG"}) {
+		t.Errorf("requested mode = %+v", m.cfg.Camera)
+	}
+	if m.readerGen == gen {
+		t.Error("old read loop was not orphaned before reopening the device")
+	}
+}
+
+func TestCameraModePickerNeedsLocalCamera(t *testing.T) {
+	m := testModel()
+	m, cmd := send(t, m, keyPress("o"))
+	if cmd != nil || m.picker != nil {
+		t.Error("format picker should not open without a local camera")
+	}
+}
+
+func TestStaleReadsAreDropped(t *testing.T) {
+	m := testModel()
+	m.readerGen = 2
+	m, _ = send(t, m, readMsg{gen: 1, msg: errorMsg(errNetCamClosed)})
+	if m.err != nil {
+		t.Errorf("error from a replaced reader was not ignored: %v", m.err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --- Clipboard ---
+//
+// Copies go to the terminal as an OSC 52 escape sequence, which it turns
+// into a clipboard write, so they work over SSH too. The sequence goes out
+// with the view, ahead of its first line, so it's the renderer that writes
+// it and it can't land in the middle of a frame. It stays there for
+// osc52Hold, long enough to be flushed; the first line doesn't change in
+// the meantime, so it's only sent once. Terminals known to ignore OSC 52
+// get wl-copy or xclip instead when we're running locally and one is
+// installed.
+
+// osc52Hold is how long a sequence stays in the view.
+const osc52Hold = time.Second
+
+type clipboardTool struct {
+	name    string
+	args    []string
+	display string // the variable saying its display server is there
+}
+
+var clipboardTools = []clipboardTool{
+	{name: "wl-copy", display: "WAYLAND_DISPLAY"},
+	{name: "xclip", args: []string{"-selection", "clipboard"}, display: "DISPLAY"},
+}
+
+// osc52Sequence wraps text for the terminal, passed through tmux or screen
+// when we're inside one.
+func osc52Sequence(text string, getenv func(string) string) string {
+	seq := osc52.New(text)
+	switch {
+	case getenv("TMUX") != "":
+		seq = seq.Tmux()
+	case strings.HasPrefix(getenv("TERM"), "screen"):
+		seq = seq.Screen()
+	}
+	return seq.String()
+}
+
+// isRemote reports whether we're in an SSH session, where a local
+// clipboard tool would copy to the wrong machine.
+func isRemote(getenv func(string) string) bool {
+	return getenv("SSH_CONNECTION") != "" || getenv("SSH_TTY") != ""
+}
+
+// osc52Ignored reports whether we're in a terminal known to drop OSC 52:
+// the VTE ones (GNOME Terminal, Tilix, ...), Konsole, Apple's Terminal and
+// the Linux console.
+func osc52Ignored(getenv func(string) string) bool {
+	return getenv("VTE_VERSION") != "" || getenv("KONSOLE_VERSION") != "" ||
+		getenv("TERM_PROGRAM") == "Apple_Terminal" || getenv("TERM") == "linux"
+}
+
+// findClipboardTool picks the first tool that's installed and has a
+// display to talk to.
+func findClipboardTool(getenv func(string) string, lookPath func(string) (string, error)) (clipboardTool, bool) {
+	for _, t := range clipboardTools {
+		if getenv(t.display) == "" {
+			continue
+		}
+		if _, err := lookPath(t.name); err == nil {
+			return t, true
+		}
+	}
+	return clipboardTool{}, false
+}
+
+// clipboardToolFor returns the tool to copy with when OSC 52 won't do.
+// Without one, OSC 52 is still worth a try.
+func clipboardToolFor(getenv func(string) string, lookPath func(string) (string, error)) (clipboardTool, bool) {
+	if isRemote(getenv) || !osc52Ignored(getenv) {
+		return clipboardTool{}, false
+	}
+	return findClipboardTool(getenv, lookPath)
+}
+
+// runClipboardTool copies text with t.
+func runClipboardTool(t clipboardTool, text string) error {
+	cmd := exec.Command(t.name, t.args...)
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", t.name, err)
+	}
+	return nil
+}
+
+// clipboardDoneMsg takes a sequence back out of the view once it's sent.
+type clipboardDoneMsg struct{ seq string }
+
+// clipboardText is the frame as text at the view's size. Plain text can't
+// show color mode's blocks, so that falls back to the detailed ramp.
+func (m model) clipboardText(color bool) string {
+	f := recFrame{img: m.currentFrame, mode: m.mode, filter: m.filter, width: m.width, height: m.height}
+	if !color && f.mode == ModeColor {
+		f.mode = ModeDetailed
+	}
+	text := renderRecText(f)
+	if f.mode != ModeColor {
+		// Trailing spaces only get in the way when pasting.
+		lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+		for i, l := range lines {
+			lines[i] = strings.TrimRight(l, " ")
+		}
+		text = strings.Join(lines, "\n") + "\n"
+	}
+	return text
+}
+
+func (m model) copyFrame(color bool) (tea.Model, tea.Cmd) {
+	if m.currentFrame == nil {
+		return m, func() tea.Msg { return statusMsg("No frame to copy!") }
+	}
+	text := m.clipboardText(color)
+	what := "text"
+	if color && m.mode == ModeColor {
+		what = "ANSI art"
+	}
+	copied := fmt.Sprintf("Copied %s (%s)", what, formatSize(int64(len(text))))
+
+	getenv := os.Getenv
+	if m.session != nil {
+		// The viewer's terminal, never the server's clipboard.
+		getenv = m.session.getenv
+	}
+	if t, ok := clipboardToolFor(getenv, exec.LookPath); ok {
+		return m, func() tea.Msg {
+			if err := runClipboardTool(t, text); err != nil {
+				return statusMsg("Can't copy: " + err.Error())
+			}
+			return statusMsg(copied + " via " + t.name)
+		}
+	}
+
+	// OSC 52 can't tell us if the terminal took it, so sending it counts.
+	seq := osc52Sequence(text, getenv)
+	m.clipboard = seq
+	next, clear := m.Update(statusMsg(copied + " via OSC 52"))
+	return next, tea.Batch(clear, tea.Tick(osc52Hold, func(time.Time) tea.Msg {
+		return clipboardDoneMsg{seq}
+	}))
+}
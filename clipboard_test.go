@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func fakeEnv(vars map[string]string) func(string) string {
+	return func(k string) string { return vars[k] }
+}
+
+func TestOSC52Sequence(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString([]byte("hello"))
+	if got := osc52Sequence("hello", fakeEnv(nil)); got != "\x1b]52;c;"+b64+"\x07" {
+		t.Errorf("plain sequence = %q", got)
+	}
+	// tmux only passes it on wrapped in a DCS.
+	if got := osc52Sequence("hello", fakeEnv(map[string]string{"TMUX": "/tmp/tmux-1000/default,1,0"})); !strings.HasPrefix(got, "\x1bPtmux;") {
+		t.Errorf("tmux sequence = %q", got)
+	}
+}
+
+func TestFindClipboardTool(t *testing.T) {
+	installed := func(names ...string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			for _, n := range names {
+				if n == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", errors.New("not found")
+		}
+	}
+	env := fakeEnv(map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"})
+	if tool, _ := findClipboardTool(env, installed("xclip", "wl-copy")); tool.name != "wl-copy" {
+		t.Errorf("picked %q, want wl-copy", tool.name)
+	}
+	if tool, _ := findClipboardTool(env, installed("xclip")); tool.name != "xclip" {
+		t.Errorf("picked %q, want xclip", tool.name)
+	}
+	// No X server, no xclip.
+	if _, ok := findClipboardTool(fakeEnv(nil), installed("xclip")); ok {
+		t.Error("picked a tool with no display to talk to")
+	}
+}
+
+func TestClipboardToolFor(t *testing.T) {
+	installed := func(string) (string, error) { return "/usr/bin/xclip", nil }
+	for _, c := range []struct {
+		env  map[string]string
+		tool bool
+	}{
+		{map[string]string{"DISPLAY": ":0", "TERM": "xterm-kitty"}, false}, // speaks OSC 52
+		{map[string]string{"DISPLAY": ":0", "VTE_VERSION": "7600"}, true},  // doesn't
+		{map[string]string{"DISPLAY": ":0", "VTE_VERSION": "7600", "SSH_TTY": "/dev/pts/3"}, false},
+		{map[string]string{"TERM_PROGRAM": "Apple_Terminal"}, false}, // nothing to copy with
+	} {
+		if _, ok := clipboardToolFor(fakeEnv(c.env), installed); ok != c.tool {
+			t.Errorf("%v: tool = %v, want %v", c.env, ok, c.tool)
+		}
+	}
+}
+
+func TestCopyGoesOutWithTheView(t *testing.T) {
+	t.Setenv("VTE_VERSION", "")
+	t.Setenv("KONSOLE_VERSION", "")
+	t.Setenv("TERM_PROGRAM", "")
+	t.Setenv("TERM", "xterm-256color")
+	t.Setenv("TMUX", "")
+	m := testModel()
+	m.currentFrame = readFrame(t, newFakeReader(drawColorBars))
+
+	m, cmd := send(t, m, keyPress("y"))
+	b64 := base64.StdEncoding.EncodeToString([]byte(m.clipboardText(false)))
+	if !strings.HasPrefix(m.View(), "\x1b]52;c;"+b64+"\x07") {
+		t.Fatalf("view doesn't start with the copy: %.40q", m.View())
+	}
+	if !strings.Contains(m.statusText, "via OSC 52") || cmd == nil {
+		t.Errorf("status %q", m.statusText)
+	}
+
+	// Once it's had time to go out, it's gone.
+	m, _ = send(t, m, clipboardDoneMsg{m.clipboard})
+	if strings.Contains(m.View(), "\x1b]52") {
+		t.Error("the copy is still in the view")
+	}
+}
+
+func TestClipboardText(t *testing.T) {
+	m := testModel()
+	m.currentFrame = readFrame(t, newFakeReader(drawColorBars))
+	m.mode = ModeColor
+
+	plain := m.clipboardText(false)
+	if strings.Contains(plain, "\x1b[") || strings.TrimSpace(plain) == "" {
+		t.Errorf("plain copy of color mode = %q", plain)
+	}
+	for _, line := range strings.Split(plain, "\n") {
+		if strings.HasSuffix(line, " ") {
+			t.Fatalf("line %q has trailing spaces", line)
+		}
+	}
+	if color := m.clipboardText(true); !strings.Contains(color, "\x1b[38;2;") {
+		t.Error("color copy has no colors")
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/fezcode/go-piml"
+)
+
+// --- Config ---
+//
+// Optional settings live in <UserConfigDir>/atlas.cam/config.piml, e.g.
+//
+//	(network_cameras)
+//	  > (camera)
+//	    (name) Kitchen
+//	    (url) http://192.168.1.20:8080/video
+//	    (username) admin
+//	    (password) hunter2
+//
+//	(camera)
+//	  (width) 1280
+//	  (height) 720
+//	  (frame_rate) 30
+//	  (format) MJPEG
+//	  (device) video2
+//	  (rescan_seconds) 0
+//
+//	(recording)
+//	  (format) gif
+//	  (raw_frames) false
+//	  (max_seconds) 300
+//	  (max_size_mb) 100
+//	  (palette) frame
+//	  (dither) false
+//	  (fps) 0
+//
+//	(snapshot)
+//	  (save_raw) false
+//	  (ansi_colors) truecolor
+//	  (author) fezcode
+//	  (ansi) false
+//	  (html) false
+//	  (svg) false
+//
+//	(output)
+//	  (dir) ~/Pictures/AtlasCam
+//	  (photo_name) atlas_cam_{date}_{time}
+//	  (clip_name) atlas_cam_clip_{date}_{time}
+//
+//	(render)
+//	  (columns) 120
+//	  (width) 1920
+//	  (height) 0
+//	  (font) /usr/share/fonts/TTF/JetBrainsMono-Regular.ttf
+//	  (foreground) #ffffff
+//	  (background) #000000
+//
+//	(hooks)
+//	  > (hook)
+//	    (name) upload
+//	    (on) photo
+//	    (run) rclone copy "$ATLAS_FILE" remote:webcam
+//	    (timeout_seconds) 60
+//
+//	(ssh)
+//	  (listen) :2222
+//	  (host_key) ~/.config/atlas.cam/ssh_host_key
+//	  (authorized_keys) ~/.config/atlas.cam/authorized_keys
+//	  (access) view
+//
+// Anything left out keeps its default.
+
+type Config struct {
+	Camera         CameraConfig    `piml:"camera"`
+	NetworkCameras []NetCamConfig  `piml:"network_cameras"`
+	Recording      RecordingConfig `piml:"recording"`
+	Snapshot       SnapshotConfig  `piml:"snapshot"`
+	Render         RenderConfig    `piml:"render"`
+	Output         OutputConfig    `piml:"output"`
+	Hooks          []HookConfig    `piml:"hooks"`
+	SSH            SSHConfig       `piml:"ssh"`
+}
+
+// CameraConfig is the mode we ask local cameras for. Zero values mean "no
+// preference"; the closest supported mode wins.
+type CameraConfig struct {
+	Width     int     `piml:"width"`
+	Height    int     `piml:"height"`
+	FrameRate float64 `piml:"frame_rate"`
+	// Pixel format as mediadevices names it: MJPEG, YUYV, I420, NV12, ...
+	Format string `piml:"format"`
+	// Device to open at startup, matched against label, name or URL.
+	Device string `piml:"device"`
+	// How often to look for newly plugged in cameras, 0 to only scan on
+	// demand (from the device picker).
+	RescanSeconds int `piml:"rescan_seconds"`
+}
+
+// merge returns c with every non-zero field of o applied on top.
+func (c CameraConfig) merge(o CameraConfig) CameraConfig {
+	if o.Width > 0 {
+		c.Width = o.Width
+	}
+	if o.Height > 0 {
+		c.Height = o.Height
+	}
+	if o.FrameRate > 0 {
+		c.FrameRate = o.FrameRate
+	}
+	if o.Format != "" {
+		c.Format = o.Format
+	}
+	if o.Device != "" {
+		c.Device = o.Device
+	}
+	return c
+}
+
+type RecordingConfig struct {
+	// gif, apng, png (a directory of numbered PNGs), avi (MJPEG) or cast
+	// (asciicast v2, the rendered text).
+	Format string `piml:"format"`
+	// Record the filtered camera feed instead of the rendered art.
+	RawFrames bool `piml:"raw_frames"`
+	// How long a recording can run and how big the file can get before
+	// it's stopped and saved. 0 means no limit.
+	MaxSeconds int `piml:"max_seconds"`
+	MaxSizeMB  int `piml:"max_size_mb"`
+	// "frame" builds a palette per frame, "global" reuses the first one.
+	Palette string `piml:"palette"`
+	// Floyd–Steinberg dithering for frames with more than 256 colors.
+	Dither bool `piml:"dither"`
+	// Resample to this frame rate, 0 to keep the capture timing.
+	FPS float64 `piml:"fps"`
+}
+
+type SnapshotConfig struct {
+	// Also save the camera frame as it came in, as a lossless PNG.
+	SaveRaw bool `piml:"save_raw"`
+	// Escapes for the color mode in .ans files: truecolor or 256.
+	ANSIColors string `piml:"ansi_colors"`
+	// Goes in the .ans file's SAUCE record.
+	Author string `piml:"author"`
+	// Also save the render as ANSI art, as a web page and as an SVG.
+	ANSI bool `piml:"ansi"`
+	HTML bool `piml:"html"`
+	SVG  bool `piml:"svg"`
+}
+
+// OutputConfig is where captures are saved and what they're called. Name
+// templates can use {date}, {time}, {unix}, {mode}, {filter}, {device}
+// and {seq}; see output.go.
+type OutputConfig struct {
+	// Empty means AtlasCam in the pictures folder.
+	Dir       string `piml:"dir"`
+	PhotoName string `piml:"photo_name"`
+	ClipName  string `piml:"clip_name"`
+}
+
+// RenderConfig is how snapshots of the text modes are laid out and drawn.
+type RenderConfig struct {
+	// Characters per line, whatever size the terminal is.
+	Columns int `piml:"columns"`
+	// Output size in pixels. The font is scaled so the text fills the
+	// width (and fits the height, if set); 0 height fits the text.
+	Width  int `piml:"width"`
+	Height int `piml:"height"`
+	// A .ttf or .otf file. Empty means the built-in Go Mono.
+	Font       string `piml:"font"`
+	Foreground string `piml:"foreground"`
+	Background string `piml:"background"`
+}
+
+// HookConfig is a command to run after a capture is saved; see hooks.go.
+type HookConfig struct {
+	// Shows in the status line and the log. Defaults to the command.
+	Name string `piml:"name"`
+	// photo, recording, or empty for both.
+	On string `piml:"on"`
+	// Run by sh -c (cmd /C on Windows), with the capture's files as
+	// arguments.
+	Run string `piml:"run"`
+	// Killed after this long. 0 means 60 seconds.
+	TimeoutSeconds int `piml:"timeout_seconds"`
+}
+
+// SSHConfig is for `atlas.cam ssh-serve`; see sshserve.go.
+type SSHConfig struct {
+	Listen string `piml:"listen"`
+	// Created on first start if it doesn't exist. Empty means
+	// ssh_host_key next to the config file.
+	HostKey string `piml:"host_key"`
+	// The keys allowed in, OpenSSH style. Empty means authorized_keys next
+	// to the config file. A key can have an access="view" or
+	// access="control" option.
+	AuthorizedKeys string `piml:"authorized_keys"`
+	// What keys without an access option can do: view (watch, with their
+	// own mode and filter) or control (also save photos and recordings).
+	Access string `piml:"access"`
+}
+
+type NetCamConfig struct {
+	Name     string `piml:"name"`
+	URL      string `piml:"url"`
+	Username string `piml:"username"`
+	Password string `piml:"password"`
+	// Seconds to wait for the connection, and for each frame once connected.
+	TimeoutSeconds int `piml:"timeout_seconds"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Recording: RecordingConfig{Format: "gif", MaxSeconds: 300, MaxSizeMB: 100, Palette: "frame"},
+		Snapshot:  SnapshotConfig{ANSIColors: "truecolor"},
+		Output:    OutputConfig{PhotoName: defaultPhotoName, ClipName: defaultClipName},
+		SSH:       SSHConfig{Listen: ":2222", Access: "view"},
+		Render: RenderConfig{
+			Columns:    defaultRenderColumns,
+			Width:      defaultRenderWidth,
+			Foreground: "#ffffff",
+			Background: "#000000",
+		},
+	}
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "atlas.cam", "config.piml")
+}
+
+// loadConfig reads the config at path. A missing file is not an error, you
+// just get the defaults.
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := piml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
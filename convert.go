@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --- Convert ---
+//
+// `atlas.cam convert` renders an image file the way a snapshot would,
+// writing the same set of files. Given a capture's JSON sidecar it starts
+// from the original frame the sidecar points at, with the mode, filter and
+// column count it was taken with; flags override any of them.
+//
+// Only captures with an original can be re-rendered: color photos, which
+// keep the frame as a (lossy) .frame.jpg, and any photo saved with
+// save_raw. Text-mode photos without it only have the art.
+
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	fs.Usage = usage
+	configPath := fs.String("config", defaultConfigPath(), "")
+	modeName := fs.String("mode", "", "")
+	filterName := fs.String("filter", "", "")
+	columns := fs.Int("columns", 0, "")
+	outDir := fs.String("out", "", "")
+	// Flags can come after the file too, so keep parsing past it.
+	var files []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(files) != 1 {
+		return errors.New("convert takes one file (a capture's .json sidecar or an image)")
+	}
+	path := files[0]
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Render.validate(); err != nil {
+		return err
+	}
+	if _, err := parseANSIColors(cfg.Snapshot.ANSIColors); err != nil {
+		return err
+	}
+
+	snap, err := loadCapture(path, &cfg)
+	if err != nil {
+		return err
+	}
+	if *modeName != "" {
+		if snap.mode, err = parseMode(*modeName); err != nil {
+			return err
+		}
+	}
+	if *filterName != "" {
+		if snap.filter, err = parseFilter(*filterName); err != nil {
+			return err
+		}
+	}
+	if *columns > 0 {
+		cfg.Render.Columns = *columns
+	}
+	snap.info.mode, snap.info.filter = snap.mode, snap.filter
+
+	base, saved, err := saveConverted(path, *outDir, snap, cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s (%s)\n", base, strings.Join(saved, ", "))
+	return nil
+}
+
+// loadCapture reads the frame to convert. For a sidecar that's the original
+// it points at, set up as the capture was taken; cfg picks up its column
+// count.
+func loadCapture(path string, cfg *Config) (snapshot, error) {
+	snap := snapshot{info: captureInfo{at: time.Now(), device: "convert"}}
+	src := path
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		meta, err := readCaptureMeta(path)
+		if err != nil {
+			return snap, err
+		}
+		if meta.Original == "" {
+			return snap, fmt.Errorf("%s: no original frame was saved with this capture (text-mode photos need save_raw)", path)
+		}
+		src = filepath.Join(filepath.Dir(path), meta.Original)
+		if snap.mode, err = parseMode(meta.Mode); err != nil {
+			return snap, err
+		}
+		if snap.filter, err = parseFilter(meta.Filter); err != nil {
+			return snap, err
+		}
+		if meta.OriginalFiltered {
+			snap.filter = FilterNone
+		}
+		if meta.Columns > 0 {
+			cfg.Render.Columns = meta.Columns
+		}
+		snap.info.device = meta.Device
+	}
+	snap.info.mode, snap.info.filter = snap.mode, snap.filter
+
+	f, err := os.Open(src)
+	if err != nil {
+		return snap, err
+	}
+	defer f.Close()
+	if snap.frame, _, err = image.Decode(f); err != nil {
+		return snap, fmt.Errorf("%s: %w", src, err)
+	}
+	return snap, nil
+}
+
+// saveConverted writes snap as <path's name>_<mode> in dir, next to path
+// when dir is empty.
+func saveConverted(path, dir string, snap snapshot, cfg Config) (string, []string, error) {
+	if dir == "" {
+		dir = filepath.Dir(path)
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "_" + modeSlug(snap.mode)
+	base := captureNames.reserve(dir, name, snap.info, photoExts)
+	saved, err := writeSnapshot(base, snap, cfg)
+	captureNames.release(base)
+	if err != nil {
+		return "", nil, err
+	}
+	return base, saved, nil
+}
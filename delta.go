@@ -0,0 +1,107 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// --- Delta Frames ---
+//
+// Between two ASCII frames most characters stay put, so after the first
+// frame only the bounding box of what changed is written. Pixels inside the
+// box that didn't change use the transparent index, and frames are never
+// disposed, so the viewer keeps showing the previous frame underneath.
+// Runs of transparent pixels also compress far better than the pixels
+// they replace.
+//
+// Changes are found by comparing displayed colors, not palette indexes,
+// since every frame may have a palette of its own.
+
+// transparentColor fills the palette slot quantize keeps free.
+var transparentColor = color.RGBA{}
+
+type frameDiffer struct {
+	canvas image.Rectangle
+	shown  []uint32 // RGB on screen after the last frame, canvas sized
+
+	// Palette with the transparent slot appended, cached so a global
+	// palette stays the same slice (and the GIF writer can share it).
+	srcPal color.Palette
+	outPal color.Palette
+}
+
+// diff returns what to write for p (in canvas coordinates at the origin)
+// and its transparent index.
+func (d *frameDiffer) diff(p *image.Paletted) (*image.Paletted, int) {
+	pal := d.withTransparent(p.Palette)
+	trans := len(pal) - 1
+	keys := make([]uint32, len(p.Palette))
+	for i, c := range p.Palette {
+		r, g, b, _ := c.RGBA()
+		keys[i] = rgbKey(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+	}
+
+	if d.shown == nil {
+		// First frame: everything is new, and it sets the canvas.
+		d.canvas = p.Rect
+		d.shown = make([]uint32, p.Rect.Dx()*p.Rect.Dy())
+		d.remember(p, p.Rect, keys)
+		p.Palette = pal
+		return p, trans
+	}
+
+	area := p.Rect.Intersect(d.canvas)
+	changed := image.Rectangle{}
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		row := p.Pix[p.PixOffset(area.Min.X, y):]
+		shown := d.shown[y*d.canvas.Dx():]
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if keys[row[x-area.Min.X]] != shown[x] {
+				changed = changed.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	if changed.Empty() {
+		// Nothing moved; a single transparent pixel still carries the delay.
+		out := image.NewPaletted(image.Rect(0, 0, 1, 1), pal)
+		out.Pix[0] = uint8(trans)
+		return out, trans
+	}
+
+	out := image.NewPaletted(changed, pal)
+	for y := changed.Min.Y; y < changed.Max.Y; y++ {
+		src := p.Pix[p.PixOffset(changed.Min.X, y):]
+		dst := out.Pix[out.PixOffset(changed.Min.X, y):]
+		shown := d.shown[y*d.canvas.Dx()+changed.Min.X:]
+		for x := range changed.Dx() {
+			if keys[src[x]] == shown[x] {
+				dst[x] = uint8(trans)
+			} else {
+				dst[x] = src[x]
+			}
+		}
+	}
+	d.remember(p, changed, keys)
+	return out, trans
+}
+
+// remember records what the viewer shows inside r after p is drawn.
+func (d *frameDiffer) remember(p *image.Paletted, r image.Rectangle, keys []uint32) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		src := p.Pix[p.PixOffset(r.Min.X, y):]
+		shown := d.shown[y*d.canvas.Dx()+r.Min.X:]
+		for x := range r.Dx() {
+			shown[x] = keys[src[x]]
+		}
+	}
+}
+
+func (d *frameDiffer) withTransparent(pal color.Palette) color.Palette {
+	if len(pal) == len(d.srcPal) && len(pal) > 0 && &pal[0] == &d.srcPal[0] {
+		return d.outPal
+	}
+	d.srcPal = pal
+	d.outPal = append(pal[:len(pal):len(pal)], transparentColor)
+	return d.outPal
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// composite plays g back the way a viewer does with DisposalNone frames,
+// returning the canvas after each frame.
+func composite(g *gif.GIF) []*image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	var out []*image.RGBA
+	for _, f := range g.Image {
+		draw.Draw(canvas, f.Bounds(), f, f.Bounds().Min, draw.Over)
+		snap := image.NewRGBA(canvas.Bounds())
+		copy(snap.Pix, canvas.Pix)
+		out = append(out, snap)
+	}
+	return out
+}
+
+func TestDeltaFramesReproduceInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ascii.gif")
+	rec, err := startRecording(path, recordGIF, RecordingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newFakeReader(drawBall)
+	var want []image.Image
+	start := time.Unix(0, 0)
+	for i := 0; i < 6; i++ {
+		fr := recFrame{img: readFrame(t, r), mode: ModeASCII, width: 60, height: 24}
+		if i == 3 {
+			// Same picture as the frame before.
+			fr = recFrame{img: want[2], mode: ModeColor}
+		}
+		fr.at = start.Add(time.Duration(i) * 100 * time.Millisecond)
+		want = append(want, renderRecFrame(fr))
+		rec.add(fr)
+	}
+	msg := string(rec.stop()().(statusMsg))
+	if !strings.Contains(msg, "deltas saved") {
+		t.Errorf("no savings report in %q", msg)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != len(want) {
+		t.Fatalf("decoded %d frames, want %d", len(g.Image), len(want))
+	}
+	for i, frame := range composite(g) {
+		if err := sameImage(frame, want[i]); err != nil {
+			t.Errorf("frame %d: %v", i, err)
+		}
+	}
+	if b := g.Image[3].Bounds(); b.Dx() != 1 || b.Dy() != 1 {
+		t.Errorf("unchanged frame was written as %v, want a single pixel", b)
+	}
+	if g.Image[1].Bounds() == g.Image[0].Bounds() {
+		t.Errorf("second frame wasn't cropped to the change: %v", g.Image[1].Bounds())
+	}
+	for i, d := range g.Disposal {
+		if d != gif.DisposalNone {
+			t.Errorf("frame %d has disposal %d, want DisposalNone", i, d)
+		}
+	}
+}
+
+func TestDiffCropsToChange(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	b := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	b.Pix[b.PixOffset(5, 2)] = 255
+	b.Pix[b.PixOffset(8, 6)+1] = 255
+
+	q := newQuantizer(RecordingConfig{})
+	var d frameDiffer
+	d.diff(q.quantize(a))
+	out, trans := d.diff(q.quantize(b))
+	if want := image.Rect(5, 2, 9, 7); out.Rect != want {
+		t.Fatalf("delta rect = %v, want %v", out.Rect, want)
+	}
+	if got := out.ColorIndexAt(6, 2); int(got) != trans {
+		t.Errorf("unchanged pixel has index %d, want transparent %d", got, trans)
+	}
+	if got := out.ColorIndexAt(5, 2); int(got) == trans {
+		t.Error("changed pixel is transparent")
+	}
+}
@@ -0,0 +1,714 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/nfnt/resize"
+)
+
+// --- Gallery ---
+//
+// Browses the captures in the output directory, newest first, going by
+// their sidecars, each with a thumbnail. The selected one is previewed
+// through the current view mode (GIFs play, a frame at a time from the
+// file) next to what its sidecar says, and can be deleted, renamed or
+// exported again in another mode or format. Previews and thumbnails load
+// in the background; gen tells stale loads and animation ticks apart.
+
+type galleryEntry struct {
+	path string // the sidecar
+	meta *captureMeta
+}
+
+// name is the base name the capture's files share.
+func (e galleryEntry) name() string {
+	return strings.TrimSuffix(filepath.Base(e.path), ".json")
+}
+
+type galleryPrompt int
+
+const (
+	promptNone galleryPrompt = iota
+	promptDelete
+	promptRename
+)
+
+type gallery struct {
+	dir     string
+	entries []galleryEntry
+	cursor  int
+
+	gen        int
+	preview    image.Image
+	player     *gifPlayer // set instead of preview for GIFs
+	previewErr string
+
+	thumbs   map[string]image.Image // by sidecar path, nil if there's none
+	thumbing bool                   // a thumbnail is loading
+
+	prompt galleryPrompt
+	input  []rune // the new name while renaming
+}
+
+type galleryPreviewMsg struct {
+	gen    int
+	img    image.Image
+	player *gifPlayer
+	err    error
+}
+
+type galleryTickMsg struct{ gen int }
+
+type galleryThumbMsg struct {
+	path string
+	img  image.Image
+}
+
+// galleryExportedMsg reports a finished export, so the list can pick up
+// the new capture.
+type galleryExportedMsg string
+
+type galleryKeyMap struct {
+	Up     key.Binding
+	Down   key.Binding
+	Export key.Binding
+	Rename key.Binding
+	Delete key.Binding
+	Close  key.Binding
+}
+
+var galleryKeys = galleryKeyMap{
+	Up:     key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
+	Down:   key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
+	Export: key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "export")),
+	Rename: key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "rename")),
+	Delete: key.NewBinding(key.WithKeys("x", "delete"), key.WithHelp("x", "delete")),
+	Close:  key.NewBinding(key.WithKeys("esc", "q", "v"), key.WithHelp("esc", "close")),
+}
+
+var galleryListStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder(), false, true, false, false).BorderForeground(grey).PaddingRight(1)
+
+func newGallery(dir string) (*gallery, error) {
+	g := &gallery{dir: dir, thumbs: make(map[string]image.Image)}
+	return g, g.reload()
+}
+
+// close lets go of the file a GIF preview plays from.
+func (g *gallery) close() {
+	if g.player != nil {
+		g.player.close()
+		g.player = nil
+	}
+}
+
+// reload rereads the directory, keeping the cursor on the same capture if
+// it's still there.
+func (g *gallery) reload() error {
+	var current string
+	if e, ok := g.selected(); ok {
+		current = e.path
+	}
+	entries, err := listCaptures(g.dir)
+	if err != nil {
+		return err
+	}
+	g.entries = entries
+	g.cursor = max(0, min(g.cursor, len(entries)-1))
+	for i, e := range entries {
+		if e.path == current {
+			g.cursor = i
+		}
+	}
+	return nil
+}
+
+func (g *gallery) selected() (galleryEntry, bool) {
+	if g.cursor < 0 || g.cursor >= len(g.entries) {
+		return galleryEntry{}, false
+	}
+	return g.entries[g.cursor], true
+}
+
+// listCaptures finds the sidecars in dir, newest capture first.
+func listCaptures(dir string) ([]galleryEntry, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var entries []galleryEntry
+	for _, p := range paths {
+		meta, err := readCaptureMeta(p)
+		if err != nil || meta.App != "atlas.cam" {
+			continue // not one of ours
+		}
+		entries = append(entries, galleryEntry{path: p, meta: meta})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].meta.Started, entries[j].meta.Started
+		if a.Equal(b) {
+			return entries[i].path > entries[j].path
+		}
+		return a.After(b)
+	})
+	return entries, nil
+}
+
+// loadPreview clears the current preview and loads the selected one.
+func (g *gallery) loadPreview() tea.Cmd {
+	g.gen++
+	g.close()
+	g.preview, g.previewErr = nil, ""
+	e, ok := g.selected()
+	if !ok {
+		return nil
+	}
+	gen := g.gen
+	return func() tea.Msg {
+		img, player, err := loadPreviewImage(e)
+		return galleryPreviewMsg{gen: gen, img: img, player: player, err: err}
+	}
+}
+
+// loadPreviewImage picks what to show for a capture: the original frame
+// (filtered as it was) or the photo for snapshots, the recording itself
+// where it's something we can decode.
+func loadPreviewImage(e galleryEntry) (image.Image, *gifPlayer, error) {
+	dir := filepath.Dir(e.path)
+	if e.meta.Kind == "recording" {
+		if len(e.meta.Files) == 0 {
+			return nil, nil, errors.New("no files")
+		}
+		file := e.meta.Files[0]
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".gif":
+			f, err := os.Open(filepath.Join(dir, file))
+			if err != nil {
+				return nil, nil, err
+			}
+			p, err := newGIFPlayer(f)
+			return nil, p, err
+		case ".png":
+			// An APNG decodes as its first frame.
+			img, err := decodeImageFile(filepath.Join(dir, file))
+			return img, nil, err
+		}
+		return nil, nil, fmt.Errorf("no preview for %s recordings", orDefault(e.meta.Format, "these"))
+	}
+
+	if e.meta.Original != "" {
+		img, err := decodeImageFile(filepath.Join(dir, e.meta.Original))
+		if err != nil {
+			return nil, nil, err
+		}
+		if !e.meta.OriginalFiltered {
+			if f, err := parseFilter(e.meta.Filter); err == nil {
+				img = applyFilter(img, f)
+			}
+		}
+		return img, nil, nil
+	}
+	for _, file := range e.meta.Files {
+		if strings.EqualFold(filepath.Ext(file), ".jpg") {
+			img, err := decodeImageFile(filepath.Join(dir, file))
+			return img, nil, err
+		}
+	}
+	return nil, nil, errors.New("no image to preview")
+}
+
+func decodeImageFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return img, nil
+}
+
+// setPreview takes a finished load. For GIFs it returns the first tick.
+// The thumbnails wait for the preview, which matters more.
+func (g *gallery) setPreview(msg galleryPreviewMsg) tea.Cmd {
+	if msg.gen != g.gen {
+		if msg.player != nil {
+			msg.player.close()
+		}
+		return nil
+	}
+	var tick tea.Cmd
+	switch {
+	case msg.err != nil:
+		g.previewErr = msg.err.Error()
+	case msg.player != nil:
+		g.player = msg.player
+		tick = g.tick()
+	default:
+		g.preview = msg.img
+	}
+	return tea.Batch(tick, g.loadThumbs())
+}
+
+func (g *gallery) tick() tea.Cmd {
+	if g.player == nil {
+		return nil
+	}
+	gen := g.gen
+	return tea.Tick(g.player.delay(), func(time.Time) tea.Msg { return galleryTickMsg{gen} })
+}
+
+// advance moves the animation on a frame. It stops on the last good frame
+// if the rest won't decode, or straight away for a still GIF.
+func (g *gallery) advance(msg galleryTickMsg) tea.Cmd {
+	if msg.gen != g.gen || g.player == nil {
+		return nil
+	}
+	if err := g.player.next(); err != nil {
+		return nil
+	}
+	return g.tick()
+}
+
+// --- Thumbnails ---
+//
+// Small enough to keep one for every capture. They load one at a time, in
+// list order, each load starting the next.
+
+const (
+	thumbCols    = 8
+	thumbRows    = 3
+	thumbMaxSide = 64 // pixels, plenty for 8x3 characters
+)
+
+func (g *gallery) loadThumbs() tea.Cmd {
+	if g.thumbing {
+		return nil
+	}
+	for _, e := range g.entries {
+		if _, ok := g.thumbs[e.path]; ok {
+			continue
+		}
+		g.thumbing = true
+		return func() tea.Msg {
+			return galleryThumbMsg{path: e.path, img: loadThumbnail(e)}
+		}
+	}
+	return nil
+}
+
+func (g *gallery) setThumb(msg galleryThumbMsg) tea.Cmd {
+	g.thumbing = false
+	g.thumbs[msg.path] = msg.img
+	return g.loadThumbs()
+}
+
+// loadThumbnail is the capture's preview (a GIF's first frame) shrunk
+// down, or nil if it has none.
+func loadThumbnail(e galleryEntry) image.Image {
+	img, player, err := loadPreviewImage(e)
+	if err != nil {
+		return nil
+	}
+	if player != nil {
+		img = player.canvas
+		defer player.close()
+	}
+	return resize.Thumbnail(thumbMaxSide, thumbMaxSide, img, resize.Bilinear)
+}
+
+func (g *gallery) image() image.Image {
+	if g.player != nil {
+		return g.player.canvas
+	}
+	return g.preview
+}
+
+// update handles a key. done means the gallery should close.
+func (g *gallery) update(msg tea.KeyMsg) (done bool, cmd tea.Cmd, status string) {
+	switch g.prompt {
+	case promptDelete:
+		g.prompt = promptNone
+		if msg.String() != "y" {
+			return false, nil, ""
+		}
+		e, _ := g.selected()
+		if err := deleteCapture(e); err != nil {
+			return false, nil, "Can't delete: " + err.Error()
+		}
+		if err := g.reload(); err != nil {
+			return false, nil, err.Error()
+		}
+		return false, g.loadPreview(), "Deleted " + e.name()
+
+	case promptRename:
+		switch msg.Type {
+		case tea.KeyEsc:
+			g.prompt = promptNone
+		case tea.KeyEnter:
+			g.prompt = promptNone
+			e, _ := g.selected()
+			name := strings.TrimSpace(string(g.input))
+			if name == "" || name == e.name() {
+				return false, nil, ""
+			}
+			path, err := renameCapture(e, name)
+			if err != nil {
+				return false, nil, "Can't rename: " + err.Error()
+			}
+			g.entries[g.cursor].path = path
+			if err := g.reload(); err != nil {
+				return false, nil, err.Error()
+			}
+			return false, g.loadPreview(), "Renamed to " + name
+		case tea.KeyBackspace:
+			if len(g.input) > 0 {
+				g.input = g.input[:len(g.input)-1]
+			}
+		case tea.KeyRunes, tea.KeySpace:
+			g.input = append(g.input, msg.Runes...)
+		}
+		return false, nil, ""
+	}
+
+	switch {
+	case key.Matches(msg, galleryKeys.Close):
+		return true, nil, ""
+	case key.Matches(msg, galleryKeys.Up):
+		if g.cursor > 0 {
+			g.cursor--
+			return false, g.loadPreview(), ""
+		}
+	case key.Matches(msg, galleryKeys.Down):
+		if g.cursor < len(g.entries)-1 {
+			g.cursor++
+			return false, g.loadPreview(), ""
+		}
+	case key.Matches(msg, galleryKeys.Delete):
+		if _, ok := g.selected(); ok {
+			g.prompt = promptDelete
+		}
+	case key.Matches(msg, galleryKeys.Rename):
+		if e, ok := g.selected(); ok {
+			g.prompt = promptRename
+			g.input = []rune(e.name())
+		}
+	}
+	return false, nil, ""
+}
+
+// view lays the list out on the left, the preview (rendered in mode) and
+// the sidecar on the right.
+func (g *gallery) view(width, height int, mode Mode) string {
+	listW := min(36, max(width/3, 12))
+	rightW := max(width-listW-3, 1)
+
+	var list strings.Builder
+	list.WriteString(titleStyle.UnsetMarginBottom().Render(fmt.Sprintf("Gallery (%d)", len(g.entries))))
+	list.WriteByte('\n')
+	if len(g.entries) == 0 {
+		list.WriteString(statusStyle.Render("(no captures in " + g.dir + ")"))
+	}
+	rows := max((height-1)/thumbRows, 1)
+	start := max(0, g.cursor-rows+1)
+	for i := start; i < min(start+rows, len(g.entries)); i++ {
+		e := g.entries[i]
+		mark := "▣ "
+		if e.meta.Kind == "recording" {
+			mark = "▶ "
+		}
+		var thumb string
+		if img := g.thumbs[e.path]; img != nil {
+			thumb = strings.TrimSuffix(renderArt(img, mode, thumbCols, thumbRows, true), "\n")
+		}
+		thumb = lipgloss.Place(thumbCols, thumbRows, lipgloss.Center, lipgloss.Center, thumb)
+		textW := max(listW-thumbCols-1, 1)
+		line := truncate(mark+e.name(), textW)
+		if i == g.cursor {
+			line = pickerCursorStyle.Render(line)
+		}
+		when := statusStyle.Render(truncate(e.meta.Started.Format("Jan 2 15:04"), textW))
+		list.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, thumb, " ", line+"\n"+when))
+		list.WriteByte('\n')
+	}
+	left := galleryListStyle.Width(listW).Height(height).MaxHeight(height).Render(strings.TrimSuffix(list.String(), "\n"))
+
+	var info []string
+	if e, ok := g.selected(); ok {
+		info = e.describe(rightW)
+	}
+	switch g.prompt {
+	case promptDelete:
+		e, _ := g.selected()
+		info = append(info, errorStyle.Render(fmt.Sprintf("Delete %s and its %d files? y/n", e.name(), len(e.meta.Files))))
+	case promptRename:
+		info = append(info, pickerActiveStyle.Render(truncate("Rename to: "+string(g.input)+"█", rightW)))
+	}
+
+	previewH := max(height-len(info)-1, 1)
+	var preview string
+	switch img := g.image(); {
+	case img != nil:
+		preview = strings.TrimSuffix(renderArt(img, mode, rightW, previewH, true), "\n")
+	case g.previewErr != "":
+		preview = statusStyle.Render(g.previewErr)
+	case len(g.entries) > 0:
+		preview = statusStyle.Render("Loading...")
+	}
+	preview = lipgloss.Place(rightW, previewH, lipgloss.Center, lipgloss.Center, preview)
+	right := lipgloss.JoinVertical(lipgloss.Left, preview, "", strings.Join(info, "\n"))
+
+	return lipgloss.JoinHorizontal(lipgloss.Top, left, " ", right)
+}
+
+// galleryView takes over the screen from the feed while browsing.
+func (m model) galleryView() string {
+	h := max(m.height-4, 1)
+	body := m.gallery.view(m.width, h, m.mode)
+	if m.picker != nil {
+		body = lipgloss.Place(m.width, h, lipgloss.Center, lipgloss.Center, m.picker.view(h))
+	}
+	header := titleStyle.Foreground(lipgloss.Color("#D4AF37")).Render("ATLAS CAM")
+	parts := []string{"↑/↓ move • m " + m.mode.String() + " • e export • n rename • x delete • esc close"}
+	if m.statusText != "" {
+		parts = append(parts, m.statusText)
+	}
+	footer := statusStyle.Render(truncate(strings.Join(parts, " | "), m.width))
+	return lipgloss.JoinVertical(lipgloss.Center, header, body, footer)
+}
+
+// describe is the sidecar as a few lines of text.
+func (e galleryEntry) describe(width int) []string {
+	m := e.meta
+	kind := "Photo"
+	if m.Kind == "recording" {
+		kind = "Recording"
+		if m.Format != "" {
+			kind += " (" + m.Format + ")"
+		}
+	}
+	lines := []string{
+		titleStyle.UnsetMarginBottom().Render(e.name()),
+		fmt.Sprintf("%s • %s • %s", kind, m.Mode, m.Filter),
+		fmt.Sprintf("Camera: %s, %dx%d", m.Device, m.Width, m.Height),
+	}
+	if m.Columns > 0 {
+		lines = append(lines, fmt.Sprintf("Text: %dx%d", m.Columns, m.Rows))
+	}
+	taken := "Taken: " + m.Started.Format("2006-01-02 15:04:05")
+	if m.Ended != nil {
+		taken += fmt.Sprintf(" (%s, %d frames)", m.Ended.Sub(m.Started).Round(100*time.Millisecond), m.Frames)
+	}
+	lines = append(lines, taken, "Files: "+strings.Join(m.Files, ", "))
+	for i := range lines {
+		lines[i] = truncate(lines[i], width)
+	}
+	return lines
+}
+
+func truncate(s string, width int) string {
+	if lipgloss.Width(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && lipgloss.Width(string(r))+1 > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "…"
+}
+
+// --- Managing Captures ---
+
+// captureFiles are the paths of a capture's files, sidecar last. Names
+// that would lead out of the directory are skipped, whatever the sidecar
+// says.
+func captureFiles(e galleryEntry) []string {
+	dir := filepath.Dir(e.path)
+	var paths []string
+	for _, f := range e.meta.Files {
+		if f != filepath.Base(f) || f == "." || f == ".." {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, f))
+	}
+	return append(paths, e.path)
+}
+
+// deleteCapture removes every file of a capture. PNG sequences are a
+// directory of frames, hence RemoveAll.
+func deleteCapture(e galleryEntry) error {
+	for _, p := range captureFiles(e) {
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameCapture gives every file of a capture the base name name and
+// returns the new sidecar path. Files that don't share the old base name
+// keep theirs.
+func renameCapture(e galleryEntry, name string) (string, error) {
+	if name != filepath.Base(name) || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("%q isn't a file name", name)
+	}
+	old := e.name()
+	dir := filepath.Dir(e.path)
+	rename := func(f string) string {
+		if f == filepath.Base(f) && strings.HasPrefix(f, old) {
+			return name + f[len(old):]
+		}
+		return f
+	}
+	taken := func(f string) bool {
+		_, err := os.Lstat(filepath.Join(dir, f))
+		return !errors.Is(err, os.ErrNotExist)
+	}
+
+	// Check everything first so a clash doesn't leave it half renamed.
+	meta := *e.meta
+	meta.Files = nil
+	for _, f := range e.meta.Files {
+		nf := rename(f)
+		if nf != f && taken(nf) {
+			return "", fmt.Errorf("%s already exists", nf)
+		}
+		meta.Files = append(meta.Files, nf)
+	}
+	if taken(name + ".json") {
+		return "", fmt.Errorf("%s.json already exists", name)
+	}
+
+	for i, f := range e.meta.Files {
+		if meta.Files[i] == f {
+			continue
+		}
+		if err := os.Rename(filepath.Join(dir, f), filepath.Join(dir, meta.Files[i])); err != nil {
+			return "", err
+		}
+	}
+	if meta.Original != "" {
+		meta.Original = rename(meta.Original)
+	}
+	path := filepath.Join(dir, name+".json")
+	if err := meta.write(path); err != nil {
+		return "", err
+	}
+	return path, os.Remove(e.path)
+}
+
+// exportTargets lists what a capture can be exported as: the other modes
+// for photos with an original frame, the other image formats for GIFs.
+func exportTargets(e galleryEntry) (items []string, payload []any) {
+	if e.meta.Kind == "recording" {
+		if len(e.meta.Files) == 0 || !strings.EqualFold(filepath.Ext(e.meta.Files[0]), ".gif") {
+			return nil, nil
+		}
+		for _, f := range []recordingFormat{recordAPNG, recordPNGSequence, recordAVI} {
+			items = append(items, f.String())
+			payload = append(payload, f)
+		}
+		return items, payload
+	}
+	if e.meta.Original == "" {
+		return nil, nil
+	}
+	for m := ModeASCII; m <= ModeStructure; m++ {
+		if modeSlug(m) != e.meta.Mode {
+			items = append(items, m.String())
+			payload = append(payload, m)
+		}
+	}
+	return items, payload
+}
+
+// exportCaptureCmd exports e as target, a Mode or a recordingFormat from
+// exportTargets.
+func exportCaptureCmd(e galleryEntry, target any, cfg Config) tea.Cmd {
+	return func() tea.Msg {
+		switch target := target.(type) {
+		case Mode:
+			snap, err := loadCapture(e.path, &cfg)
+			if err != nil {
+				return galleryExportedMsg("Export failed: " + err.Error())
+			}
+			snap.mode, snap.info.mode = target, target
+			base, _, err := saveConverted(e.path, "", snap, cfg)
+			if err != nil {
+				return galleryExportedMsg("Export failed: " + err.Error())
+			}
+			return galleryExportedMsg("Exported " + filepath.Base(base))
+		case recordingFormat:
+			path, err := reencodeGIF(e, target, cfg.Recording)
+			if err != nil {
+				return galleryExportedMsg("Export failed: " + err.Error())
+			}
+			return galleryExportedMsg("Exported " + filepath.Base(path))
+		}
+		return nil
+	}
+}
+
+// reencodeGIF writes a GIF recording's frames out again as format, which
+// has to take images, with a sidecar copied from the GIF's.
+func reencodeGIF(e galleryEntry, format recordingFormat, cfg RecordingConfig) (string, error) {
+	f, err := os.Open(filepath.Join(filepath.Dir(e.path), e.meta.Files[0]))
+	if err != nil {
+		return "", err
+	}
+	p, err := newGIFPlayer(f)
+	if err != nil {
+		return "", err
+	}
+	defer p.close()
+
+	ext := format.extension()
+	info := captureInfo{at: time.Now()}
+	base := captureNames.reserve(filepath.Dir(e.path), e.name()+"_"+format.configName(), info, []string{ext, ".json"})
+	path := base + ext
+	sink, err := newRecordingSink(format, path, cfg)
+	captureNames.release(base)
+	if err != nil {
+		return "", err
+	}
+	fs, ok := sink.(frameSink)
+	if !ok {
+		sink.close()
+		os.RemoveAll(path)
+		return "", fmt.Errorf("can't export to %s", format)
+	}
+	frames := 0
+	for err == nil {
+		if err = fs.writeFrame(p.canvas, max(p.cur.delay, 1)); err == nil {
+			frames++
+			err = p.step()
+		}
+	}
+	if err != io.EOF {
+		sink.close()
+		return "", err
+	}
+	if err := sink.close(); err != nil {
+		return "", err
+	}
+
+	meta := *e.meta
+	meta.Format = format.configName()
+	meta.Files = []string{filepath.Base(path)}
+	meta.Frames = frames
+	return path, meta.write(strings.TrimSuffix(path, ext) + ".json")
+}
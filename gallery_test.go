@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// writeTestSnapshot saves a snapshot named name in dir, taken at at.
+func writeTestSnapshot(t *testing.T, dir, name string, at time.Time, cfg Config) galleryEntry {
+	t.Helper()
+	info := testCapture
+	info.at = at
+	base := filepath.Join(dir, name)
+	snap := snapshot{frame: readFrame(t, newFakeReader(drawBall)), mode: ModeASCII, filter: FilterNone, info: info}
+	if _, err := writeSnapshot(base, snap, cfg); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := readCaptureMeta(base + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return galleryEntry{path: base + ".json", meta: meta}
+}
+
+// writeTestGIF records a few frames to dir/name.gif, sidecar and all.
+func writeTestGIF(t *testing.T, dir, name string) galleryEntry {
+	t.Helper()
+	path := filepath.Join(dir, name+".gif")
+	rec, err := startRecording(path, recordGIF, RecordingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newFakeReader(drawBall)
+	rec.meta = newCaptureMeta("recording", testCapture, readFrame(t, r).Bounds().Size())
+	rec.meta.Format = "gif"
+	for i := 0; i < 3; i++ {
+		rec.add(recFrame{img: readFrame(t, r), at: testCapture.at.Add(time.Duration(i) * 100 * time.Millisecond), mode: ModeColor, width: 40, height: 16})
+	}
+	rec.stop()()
+	meta, err := readCaptureMeta(filepath.Join(dir, name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return galleryEntry{path: filepath.Join(dir, name+".json"), meta: meta}
+}
+
+func TestListCaptures(t *testing.T) {
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.Render.Columns = 20
+	writeTestSnapshot(t, dir, "old", time.Unix(1000, 0), cfg)
+	writeTestSnapshot(t, dir, "new", time.Unix(2000, 0), cfg)
+	os.WriteFile(filepath.Join(dir, "other.json"), []byte(`{"name": "not a capture"}`), 0644)
+
+	entries, err := listCaptures(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.name())
+	}
+	if strings.Join(names, " ") != "new old" {
+		t.Errorf("listed %v, want [new old]", names)
+	}
+}
+
+func TestRenameCapture(t *testing.T) {
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.Render.Columns = 20
+	cfg.Snapshot.SaveRaw = true
+	e := writeTestSnapshot(t, dir, "snap", testCapture.at, cfg)
+	writeTestSnapshot(t, dir, "taken", testCapture.at, cfg)
+
+	if _, err := renameCapture(e, "taken"); err == nil {
+		t.Error("renamed over another capture")
+	}
+	if _, err := renameCapture(e, "../up"); err == nil {
+		t.Error("renamed out of the directory")
+	}
+
+	path, err := renameCapture(e, "holiday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := readCaptureMeta(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Original != "holiday.raw.png" {
+		t.Errorf("original = %q", meta.Original)
+	}
+	for _, f := range meta.Files {
+		if !strings.HasPrefix(f, "holiday.") {
+			t.Errorf("file %q kept its name", f)
+		}
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Error(err)
+		}
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "snap.*")); len(left) > 0 {
+		t.Errorf("left behind %v", left)
+	}
+}
+
+func TestDeleteCapture(t *testing.T) {
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.Render.Columns = 20
+	e := writeTestSnapshot(t, dir, "snap", testCapture.at, cfg)
+	writeTestSnapshot(t, dir, "keep", testCapture.at, cfg)
+
+	// A sidecar can't point deletes outside its directory.
+	e.meta.Files = append(e.meta.Files, "../outside")
+	os.WriteFile(filepath.Join(filepath.Dir(dir), "outside"), nil, 0644)
+	defer os.Remove(filepath.Join(filepath.Dir(dir), "outside"))
+
+	if err := deleteCapture(e); err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "snap.*")); len(left) > 0 {
+		t.Errorf("left behind %v", left)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "outside")); err != nil {
+		t.Error("deleted a file outside the capture directory")
+	}
+	if entries, _ := listCaptures(dir); len(entries) != 1 {
+		t.Errorf("%d captures left, want 1", len(entries))
+	}
+}
+
+func TestGIFPreviewPlays(t *testing.T) {
+	e := writeTestGIF(t, t.TempDir(), "clip")
+	_, p, err := loadPreviewImage(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	first := append([]byte(nil), p.canvas.Pix...)
+	p.next()
+	if string(p.canvas.Pix) == string(first) {
+		t.Error("second frame looks like the first")
+	}
+	p.next()
+	p.next()
+	if p.frame != 0 || string(p.canvas.Pix) != string(first) {
+		t.Errorf("after a loop at frame %d, want the first frame again", p.frame)
+	}
+}
+
+func TestGIFReaderMatchesImageGIF(t *testing.T) {
+	// image/gif's own output, with frames that move about the canvas.
+	var buf bytes.Buffer
+	anim := &gif.GIF{Config: image.Config{Width: 42, Height: 32}}
+	for i := 0; i < 3; i++ {
+		img := readFrame(t, newFakeReader(drawColorBars))
+		p := image.NewPaletted(image.Rect(i, i, 40+i, 30+i), palette.Plan9)
+		draw.FloydSteinberg.Draw(p, p.Rect, img, image.Point{})
+		anim.Image = append(anim.Image, p)
+		anim.Delay = append(anim.Delay, 5+i)
+	}
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	want, _ := gif.DecodeAll(bytes.NewReader(data))
+
+	r, err := newGIFReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range want.Image {
+		fr, err := r.next()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if fr.img.Rect != w.Rect || !bytes.Equal(fr.img.Pix, w.Pix) || fr.delay != want.Delay[i] {
+			t.Errorf("frame %d differs from image/gif's", i)
+		}
+	}
+	if _, err := r.next(); err != io.EOF {
+		t.Errorf("after the last frame: %v, want io.EOF", err)
+	}
+
+	// Cut short, it's an error rather than a silent end.
+	r, _ = newGIFReader(bytes.NewReader(data[:len(data)/2]))
+	for err = nil; err == nil; _, err = r.next() {
+	}
+	if err == io.EOF {
+		t.Error("a truncated GIF ended cleanly")
+	}
+}
+
+func TestExportGIF(t *testing.T) {
+	e := writeTestGIF(t, t.TempDir(), "clip")
+	items, _ := exportTargets(e)
+	if strings.Join(items, ", ") != "APNG, PNG sequence, AVI" {
+		t.Errorf("export targets = %v", items)
+	}
+
+	path, err := reencodeGIF(e, recordAPNG, RecordingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != "clip_apng.png" {
+		t.Errorf("exported to %s", path)
+	}
+	meta, err := readCaptureMeta(strings.TrimSuffix(path, ".png") + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Format != "apng" || meta.Frames != 3 || meta.Files[0] != "clip_apng.png" || meta.Device != testCapture.device {
+		t.Errorf("sidecar = %s, %d frames, files %v, device %q", meta.Format, meta.Frames, meta.Files, meta.Device)
+	}
+}
+
+func TestGalleryKeys(t *testing.T) {
+	dir := t.TempDir()
+	m := testModel()
+	m.cfg.Output.Dir = dir
+	m.cfg.Render.Columns = 20
+	m.cfg.Snapshot.SaveRaw = true
+	writeTestSnapshot(t, dir, "snap", time.Unix(1000, 0), m.cfg)
+	writeTestGIF(t, dir, "clip")
+
+	m, cmd := send(t, m, keyPress("v"))
+	if m.gallery == nil || len(m.gallery.entries) != 2 || cmd == nil {
+		t.Fatalf("gallery = %+v after 'v'", m.gallery)
+	}
+	m, cmd = send(t, m, cmd())
+	if m.gallery.image() == nil {
+		t.Fatalf("no preview (%s)", m.gallery.previewErr)
+	}
+	// Then the thumbnails, one after another.
+	for pending := []tea.Cmd{cmd}; len(pending) > 0; pending = pending[1:] {
+		if pending[0] == nil {
+			continue
+		}
+		switch msg := pending[0]().(type) {
+		case tea.BatchMsg:
+			pending = append(pending, msg...)
+		case galleryThumbMsg:
+			m, cmd = send(t, m, msg)
+			pending = append(pending, cmd)
+		}
+	}
+	if len(m.gallery.thumbs) != 2 || m.gallery.thumbs[m.gallery.entries[0].path] == nil {
+		t.Errorf("thumbnails = %v", m.gallery.thumbs)
+	}
+	if view := m.View(); !strings.Contains(view, "Gallery (2)") || !strings.Contains(view, "Files: ") {
+		t.Errorf("view doesn't show the gallery:\n%s", view)
+	}
+
+	// Export the photo in another mode through the picker.
+	m, _ = send(t, m, keyPress("j"))
+	if e, _ := m.gallery.selected(); e.name() != "snap" {
+		t.Fatalf("selected %s, want snap", e.name())
+	}
+	m, _ = send(t, m, keyPress("e"))
+	if m.picker == nil || m.picker.kind != pickerExport {
+		t.Fatalf("no export picker, status %q", m.statusText)
+	}
+	m, cmd = send(t, m, keyPress(" "))
+	if cmd == nil {
+		t.Fatal("choosing a mode didn't export")
+	}
+	m, _ = send(t, m, cmd())
+	if len(m.gallery.entries) != 3 {
+		t.Errorf("%d captures after export, want 3 (status %q)", len(m.gallery.entries), m.statusText)
+	}
+
+	m, _ = send(t, m, keyPress("q"))
+	if m.gallery != nil {
+		t.Fatal("'q' should close the gallery, not quit")
+	}
+}
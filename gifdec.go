@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"compress/lzw"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+)
+
+// --- Streaming GIF Reader ---
+//
+// The other half of gifenc.go. image/gif's DecodeAll holds every frame of
+// a clip in memory, which for a recording near the size limit is a lot to
+// spend on a preview, so this reads a GIF a frame at a time instead.
+// Extensions other than graphic control are skipped.
+
+// gifMaxSide bounds the canvas, like y4mMaxSide does for y4m frames.
+const gifMaxSide = 8192
+
+type gifReader struct {
+	r      *bufio.Reader
+	width  int
+	height int
+	global color.Palette
+
+	// From the graphic control extension, for the next image only.
+	delay       int
+	disposal    byte
+	transparent int
+}
+
+type gifFrame struct {
+	img      *image.Paletted // in canvas coordinates
+	delay    int             // in 1/100 s
+	disposal byte
+}
+
+// newGIFReader reads the header; frames come from next.
+func newGIFReader(r io.Reader) (*gifReader, error) {
+	g := &gifReader{r: bufio.NewReader(r), transparent: -1}
+	var hdr [13]byte
+	if _, err := io.ReadFull(g.r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("gif: %w", err)
+	}
+	if string(hdr[:6]) != "GIF87a" && string(hdr[:6]) != "GIF89a" {
+		return nil, errors.New("gif: not a GIF file")
+	}
+	g.width, g.height = int(hdr[6])|int(hdr[7])<<8, int(hdr[8])|int(hdr[9])<<8
+	if g.width == 0 || g.height == 0 || g.width > gifMaxSide || g.height > gifMaxSide {
+		return nil, fmt.Errorf("gif: canvas size %dx%d is out of range", g.width, g.height)
+	}
+	if hdr[10]&0x80 != 0 {
+		var err error
+		if g.global, err = g.readColorTable(hdr[10]); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func (g *gifReader) readColorTable(flags byte) (color.Palette, error) {
+	n := 1 << (flags&7 + 1)
+	buf := make([]byte, 3*n)
+	if _, err := io.ReadFull(g.r, buf); err != nil {
+		return nil, fmt.Errorf("gif: color table: %w", err)
+	}
+	pal := make(color.Palette, n)
+	for i := range pal {
+		pal[i] = color.RGBA{buf[3*i], buf[3*i+1], buf[3*i+2], 0xff}
+	}
+	return pal, nil
+}
+
+// next reads the next frame, or returns io.EOF at the trailer.
+func (g *gifReader) next() (gifFrame, error) {
+	for {
+		b, err := g.r.ReadByte()
+		if err != nil {
+			return gifFrame{}, fmt.Errorf("gif: %w", io.ErrUnexpectedEOF)
+		}
+		switch b {
+		case 0x21:
+			if err := g.readExtension(); err != nil {
+				return gifFrame{}, err
+			}
+		case 0x2c:
+			return g.readImage()
+		case 0x3b:
+			return gifFrame{}, io.EOF
+		default:
+			return gifFrame{}, fmt.Errorf("gif: unknown block 0x%02x", b)
+		}
+	}
+}
+
+func (g *gifReader) readExtension() error {
+	label, err := g.r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("gif: %w", io.ErrUnexpectedEOF)
+	}
+	if label == 0xf9 {
+		var gce [6]byte // size, flags, delay, transparent index, terminator
+		if _, err := io.ReadFull(g.r, gce[:]); err != nil {
+			return fmt.Errorf("gif: graphic control: %w", err)
+		}
+		if gce[0] != 4 || gce[5] != 0 {
+			return errors.New("gif: bad graphic control extension")
+		}
+		g.disposal = gce[1] >> 2 & 7
+		g.delay = int(gce[2]) | int(gce[3])<<8
+		g.transparent = -1
+		if gce[1]&1 != 0 {
+			g.transparent = int(gce[4])
+		}
+		return nil
+	}
+	return g.skipBlocks()
+}
+
+// skipBlocks reads sub-blocks up to and including the terminator.
+func (g *gifReader) skipBlocks() error {
+	for {
+		n, err := g.r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("gif: %w", io.ErrUnexpectedEOF)
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := g.r.Discard(int(n)); err != nil {
+			return fmt.Errorf("gif: %w", io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func (g *gifReader) readImage() (gifFrame, error) {
+	var desc [9]byte
+	if _, err := io.ReadFull(g.r, desc[:]); err != nil {
+		return gifFrame{}, fmt.Errorf("gif: image descriptor: %w", err)
+	}
+	left, top := int(desc[0])|int(desc[1])<<8, int(desc[2])|int(desc[3])<<8
+	w, h := int(desc[4])|int(desc[5])<<8, int(desc[6])|int(desc[7])<<8
+	r := image.Rect(left, top, left+w, top+h)
+	if !r.In(image.Rect(0, 0, g.width, g.height)) {
+		return gifFrame{}, errors.New("gif: frame is outside the canvas")
+	}
+
+	pal := g.global
+	if desc[8]&0x80 != 0 {
+		var err error
+		if pal, err = g.readColorTable(desc[8]); err != nil {
+			return gifFrame{}, err
+		}
+	}
+	if len(pal) == 0 {
+		return gifFrame{}, errors.New("gif: no color table")
+	}
+	if g.transparent >= 0 && g.transparent < len(pal) {
+		pal = append(color.Palette(nil), pal...)
+		pal[g.transparent] = color.RGBA{}
+	}
+	fr := gifFrame{img: image.NewPaletted(r, pal), delay: g.delay, disposal: g.disposal}
+	g.delay, g.disposal, g.transparent = 0, 0, -1
+
+	litWidth, err := g.r.ReadByte()
+	if err != nil {
+		return gifFrame{}, fmt.Errorf("gif: %w", io.ErrUnexpectedEOF)
+	}
+	if litWidth < 2 || litWidth > 8 {
+		return gifFrame{}, fmt.Errorf("gif: bad LZW code size %d", litWidth)
+	}
+	br := &gifBlockReader{r: g.r}
+	lr := lzw.NewReader(br, lzw.LSB, int(litWidth))
+	_, err = io.ReadFull(lr, fr.img.Pix)
+	lr.Close()
+	if err != nil {
+		return gifFrame{}, fmt.Errorf("gif: image data: %w", err)
+	}
+	// Whatever the LZW stream didn't need, then the block terminator.
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		return gifFrame{}, fmt.Errorf("gif: image data: %w", err)
+	}
+	g.r.ReadByte()
+	for _, i := range fr.img.Pix {
+		if int(i) >= len(pal) {
+			return gifFrame{}, errors.New("gif: pixel outside the color table")
+		}
+	}
+	if desc[8]&0x40 != 0 {
+		deinterlace(fr.img)
+	}
+	return fr, nil
+}
+
+// deinterlace puts the rows of an interlaced frame back in order. They're
+// stored every 8th from 0, every 8th from 4, every 4th from 2, then every
+// 2nd from 1.
+func deinterlace(p *image.Paletted) {
+	h := p.Rect.Dy()
+	rows := make([]byte, len(p.Pix))
+	src := 0
+	for _, pass := range []struct{ start, step int }{{0, 8}, {4, 8}, {2, 4}, {1, 2}} {
+		for y := pass.start; y < h; y += pass.step {
+			copy(rows[y*p.Stride:(y+1)*p.Stride], p.Pix[src*p.Stride:])
+			src++
+		}
+	}
+	p.Pix = rows
+}
+
+// gifBlockReader reads the data of a run of sub-blocks, stopping (with
+// io.EOF) at the terminator, which it leaves unread.
+type gifBlockReader struct {
+	r    *bufio.Reader
+	left int
+}
+
+func (b *gifBlockReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for b.left == 0 {
+		n, err := b.r.Peek(1)
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if n[0] == 0 {
+			return 0, io.EOF
+		}
+		b.r.ReadByte()
+		b.left = int(n[0])
+	}
+	p = p[:min(len(p), b.left)]
+	n, err := b.r.Read(p)
+	b.left -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// --- GIF Playback ---
+
+// gifPlayer composites a GIF's frames onto a canvas one at a time, reading
+// each from the file as it's needed.
+type gifPlayer struct {
+	f      io.ReadSeekCloser
+	r      *gifReader
+	canvas *image.RGBA
+	cur    gifFrame
+	frame  int         // index of cur
+	saved  *image.RGBA // the canvas before a DisposalPrevious frame
+}
+
+// newGIFPlayer starts playing f, which it closes when closed itself.
+func newGIFPlayer(f io.ReadSeekCloser) (*gifPlayer, error) {
+	p := &gifPlayer{f: f}
+	if err := p.rewind(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// rewind goes back to a blank canvas and draws the first frame.
+func (p *gifPlayer) rewind() error {
+	if _, err := p.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r, err := newGIFReader(p.f)
+	if err != nil {
+		return err
+	}
+	p.r, p.frame = r, -1
+	if p.canvas == nil || p.canvas.Rect.Dx() != r.width || p.canvas.Rect.Dy() != r.height {
+		p.canvas = image.NewRGBA(image.Rect(0, 0, r.width, r.height))
+	} else {
+		clear(p.canvas.Pix)
+	}
+	p.cur = gifFrame{}
+	if err := p.step(); err != nil {
+		if err == io.EOF {
+			err = errors.New("gif: no frames")
+		}
+		return err
+	}
+	return nil
+}
+
+// step disposes of the current frame and draws the following one, or
+// returns io.EOF after the last.
+func (p *gifPlayer) step() error {
+	fr, err := p.r.next()
+	if err != nil {
+		return err
+	}
+	if p.cur.img != nil {
+		switch p.cur.disposal {
+		case gif.DisposalBackground:
+			draw.Draw(p.canvas, p.cur.img.Rect, image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			if p.saved != nil {
+				copy(p.canvas.Pix, p.saved.Pix)
+			}
+		}
+	}
+	p.cur = fr
+	p.frame++
+	if fr.disposal == gif.DisposalPrevious {
+		if p.saved == nil {
+			p.saved = image.NewRGBA(p.canvas.Rect)
+		}
+		copy(p.saved.Pix, p.canvas.Pix)
+	}
+	draw.Draw(p.canvas, fr.img.Rect, fr.img, fr.img.Rect.Min, draw.Over)
+	return nil
+}
+
+// next is step, starting over after the last frame. A single frame GIF
+// has nothing to move on to, which is io.EOF.
+func (p *gifPlayer) next() error {
+	err := p.step()
+	if err == io.EOF && p.frame > 0 {
+		err = p.rewind()
+	}
+	return err
+}
+
+// delay is how long the current frame stays up.
+func (p *gifPlayer) delay() time.Duration {
+	d := 10
+	if p.cur.delay > 0 {
+		d = p.cur.delay
+	}
+	return time.Duration(d) * 10 * time.Millisecond
+}
+
+func (p *gifPlayer) close() error {
+	return p.f.Close()
+}
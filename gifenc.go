@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"compress/lzw"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+)
+
+// --- Streaming GIF Writer ---
+//
+// image/gif only has EncodeAll, which wants every frame in memory at once.
+// This writes the same format a frame at a time: header on the first frame,
+// then one graphic control extension + image per frame, trailer on close.
+// Frame bounds are canvas coordinates. The first frame fixes the canvas
+// size, and its palette becomes the global color table; later frames are
+// clipped to the canvas and only carry a color table of their own if their
+// palette differs.
+
+type gifWriter struct {
+	w      *bufio.Writer
+	n      int64 // bytes written so far
+	width  int
+	height int
+	global color.Palette
+	err    error
+}
+
+func newGIFWriter(w io.Writer) *gifWriter {
+	g := &gifWriter{}
+	g.w = bufio.NewWriter(&countingWriter{w: w, n: &g.n})
+	return g
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// size is the number of bytes written so far, including buffered ones.
+func (g *gifWriter) size() int64 {
+	return g.n + int64(g.w.Buffered())
+}
+
+func (g *gifWriter) writeHeader(width, height int, global color.Palette) {
+	g.width, g.height, g.global = width, height, global
+	g.w.WriteString("GIF89a")
+	g.writeUint16(width)
+	g.writeUint16(height)
+	bits := paletteBits(len(global))
+	g.w.Write([]byte{0x80 | byte(bits-1), 0x00, 0x00}) // global color table, bg 0, square pixels
+	g.writeColorTable(global, bits)
+
+	// NETSCAPE2.0 application extension: loop forever.
+	g.w.Write([]byte{0x21, 0xff, 0x0b})
+	g.w.WriteString("NETSCAPE2.0")
+	g.w.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+}
+
+// writeFrame appends p, shown for delay hundredths of a second. transparent
+// is the palette index to leave see-through, or -1. Frames are never
+// disposed, so whatever is under a transparent pixel stays visible.
+func (g *gifWriter) writeFrame(p *image.Paletted, delay, transparent int) error {
+	if g.err != nil {
+		return g.err
+	}
+	if len(p.Palette) == 0 || len(p.Palette) > 256 {
+		return errors.New("gif: palette must have 1 to 256 colors")
+	}
+	if g.width == 0 {
+		g.writeHeader(p.Rect.Max.X, p.Rect.Max.Y, p.Palette)
+	}
+
+	b := p.Bounds().Intersect(image.Rect(0, 0, g.width, g.height))
+	if b.Empty() {
+		return nil
+	}
+	p = p.SubImage(b).(*image.Paletted)
+
+	// Graphic control extension: disposal "do not dispose", delay, and
+	// the transparent index if there is one.
+	flags, trans := byte(1<<2), byte(0)
+	if transparent >= 0 {
+		flags |= 0x01
+		trans = byte(transparent)
+	}
+	g.w.Write([]byte{0x21, 0xf9, 0x04, flags})
+	g.writeUint16(delay)
+	g.w.Write([]byte{trans, 0x00})
+
+	bits := paletteBits(len(p.Palette))
+	g.w.WriteByte(0x2c)
+	g.writeUint16(b.Min.X)
+	g.writeUint16(b.Min.Y)
+	g.writeUint16(b.Dx())
+	g.writeUint16(b.Dy())
+	if samePalette(p.Palette, g.global) {
+		bits = paletteBits(len(g.global))
+		g.w.WriteByte(0x00)
+	} else {
+		g.w.WriteByte(0x80 | byte(bits-1)) // local color table follows
+		g.writeColorTable(p.Palette, bits)
+	}
+
+	litWidth := max(bits, 2)
+	g.w.WriteByte(byte(litWidth))
+	bw := &blockWriter{w: g.w}
+	lw := lzw.NewWriter(bw, lzw.LSB, litWidth)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := p.PixOffset(b.Min.X, y)
+		if _, err := lw.Write(p.Pix[i : i+b.Dx()]); err != nil {
+			g.err = err
+			return err
+		}
+	}
+	lw.Close()
+	bw.close()
+
+	g.err = g.w.Flush()
+	return g.err
+}
+
+// close writes the trailer. Nothing is written if no frame ever was.
+func (g *gifWriter) close() error {
+	if g.err != nil || g.width == 0 {
+		return g.err
+	}
+	g.w.WriteByte(0x3b)
+	g.err = g.w.Flush()
+	return g.err
+}
+
+func (g *gifWriter) writeUint16(v int) {
+	g.w.Write([]byte{byte(v), byte(v >> 8)})
+}
+
+// writeColorTable writes pal padded with black to 2^bits entries.
+func (g *gifWriter) writeColorTable(pal color.Palette, bits int) {
+	for i := 0; i < 1<<bits; i++ {
+		var r, gr, b uint32
+		if i < len(pal) {
+			r, gr, b, _ = pal[i].RGBA()
+		}
+		g.w.Write([]byte{byte(r >> 8), byte(gr >> 8), byte(b >> 8)})
+	}
+}
+
+func samePalette(a, b color.Palette) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		r1, g1, b1, _ := a[i].RGBA()
+		r2, g2, b2, _ := b[i].RGBA()
+		if r1 != r2 || g1 != g2 || b1 != b2 {
+			return false
+		}
+	}
+	return true
+}
+
+// paletteBits is the color table size exponent for n colors (1..8).
+func paletteBits(n int) int {
+	bits := 1
+	for 1<<bits < n {
+		bits++
+	}
+	return bits
+}
+
+// blockWriter chops the LZW stream into GIF's 255-byte sub-blocks.
+type blockWriter struct {
+	w   *bufio.Writer
+	buf [255]byte
+	n   int
+}
+
+func (b *blockWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		b.buf[b.n] = c
+		b.n++
+		if b.n == len(b.buf) {
+			b.flush()
+		}
+	}
+	return len(p), nil
+}
+
+func (b *blockWriter) flush() {
+	if b.n == 0 {
+		return
+	}
+	b.w.WriteByte(byte(b.n))
+	b.w.Write(b.buf[:b.n])
+	b.n = 0
+}
+
+// close flushes the last sub-block and writes the block terminator.
+func (b *blockWriter) close() {
+	b.flush()
+	b.w.WriteByte(0x00)
+}
+
+// --- GIF Recording ---
+
+// gifSink quantizes frames, turns them into deltas and writes them out.
+type gifSink struct {
+	f    *os.File
+	gw   *gifWriter
+	q    *quantizer
+	diff frameDiffer
+
+	// Bytes the frames took, and roughly what they would have taken
+	// without delta frames.
+	frameBytes, fullBytes int64
+	firstBytes            int64
+}
+
+func newGIFSink(path string, cfg RecordingConfig) (*gifSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &gifSink{f: f, gw: newGIFWriter(f), q: newQuantizer(cfg)}, nil
+}
+
+func (s *gifSink) writeFrame(img image.Image, delay int) error {
+	p := s.q.quantize(img)
+	first := s.diff.shown == nil
+	out, trans := s.diff.diff(p)
+
+	before := s.gw.size()
+	if err := s.gw.writeFrame(out, delay, trans); err != nil {
+		return err
+	}
+	n := s.gw.size() - before
+	s.frameBytes += n
+	// Without deltas every frame would cover the whole canvas, like the
+	// first one, and cost about what it did. Encoding each one in full as
+	// well just to know exactly would double the work.
+	if first {
+		s.firstBytes = n
+	}
+	s.fullBytes += s.firstBytes
+	return nil
+}
+
+func (s *gifSink) size() int64 {
+	return s.gw.size()
+}
+
+func (s *gifSink) close() error {
+	err := s.gw.close()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *gifSink) summary() string {
+	if s.fullBytes <= s.frameBytes {
+		return ""
+	}
+	saved := s.fullBytes - s.frameBytes
+	return fmt.Sprintf("deltas saved ~%s / %d%%", formatSize(saved), saved*100/s.fullBytes)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --- Hooks ---
+//
+// Hooks are commands from the config that run after a photo or recording is
+// saved, to upload it, sync it, send a notification and so on. They start
+// from the goroutine that did the saving and run in the background, each
+// with a timeout. Results go to the log, and to the status line of the
+// viewer that took the capture: through a channel the model listens on
+// locally, straight to the session's program over SSH. Quitting waits for
+// hooks still running.
+
+const defaultHookTimeout = 60 * time.Second
+
+// hookOutputLimit is how much of a hook's output is kept, from the end,
+// which is where the errors usually are.
+const hookOutputLimit = 32 << 10
+
+// savedCapture is what a hook gets to know about.
+type savedCapture struct {
+	kind    string   // photo or recording
+	files   []string // the main file first
+	sidecar string   // may be empty
+}
+
+type hookResult struct {
+	name   string
+	file   string // the capture's main file
+	err    error
+	output string
+	took   time.Duration
+}
+
+type hookResultMsg hookResult
+
+type hookRunner struct {
+	results chan hookResult
+	running sync.WaitGroup
+	pending atomic.Int64 // how many are running, for the quit message
+
+	logPath string // empty means hookLogPath()
+	logOnce sync.Once
+	log     *log.Logger
+}
+
+var captureHooks = newHookRunner("")
+
+func newHookRunner(logPath string) *hookRunner {
+	return &hookRunner{results: make(chan hookResult, 16), logPath: logPath}
+}
+
+// hookLogPath is where hook output goes unless told otherwise.
+func hookLogPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "atlas.cam", "hooks.log")
+}
+
+func (h HookConfig) validate() error {
+	switch strings.ToLower(h.On) {
+	case "", "photo", "recording":
+	default:
+		return fmt.Errorf("hook %q: on is %q, want photo, recording or nothing for both", h.displayName(), h.On)
+	}
+	if strings.TrimSpace(h.Run) == "" {
+		return fmt.Errorf("hook %q: nothing to run", h.displayName())
+	}
+	return nil
+}
+
+func (h HookConfig) displayName() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return h.Run
+}
+
+func (h HookConfig) matches(kind string) bool {
+	return h.On == "" || strings.EqualFold(h.On, kind)
+}
+
+// start runs every hook that applies to c, in the background, and hands
+// each result to report.
+func (r *hookRunner) start(hooks []HookConfig, c savedCapture, report func(hookResult)) {
+	var env []string
+	for _, h := range hooks {
+		if !h.matches(c.kind) {
+			continue
+		}
+		if env == nil {
+			env = hookEnv(c)
+		}
+		r.running.Add(1)
+		r.pending.Add(1)
+		go func(h HookConfig) {
+			defer r.running.Done()
+			defer r.pending.Add(-1)
+			res := runHook(h, c, env)
+			r.logResult(res)
+			report(res)
+		}(h)
+	}
+}
+
+// report passes res on to whoever is waiting on results.
+func (r *hookRunner) report(res hookResult) {
+	select {
+	case r.results <- res:
+	default: // nobody listening (or far behind), the log has it
+	}
+}
+
+// wait blocks until running hooks finish, which their timeouts bound.
+func (r *hookRunner) wait() {
+	r.running.Wait()
+}
+
+func runHook(h HookConfig, c savedCapture, env []string) hookResult {
+	timeout := defaultHookTimeout
+	if h.TimeoutSeconds > 0 {
+		timeout = time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", append([]string{"/C", h.Run}, c.files...)...)
+	} else {
+		// $0 is our name, so the files start at $1 and "$@" is all of them.
+		cmd = exec.CommandContext(ctx, "sh", append([]string{"-c", h.Run, "atlas.cam"}, c.files...)...)
+	}
+	cmd.Dir = filepath.Dir(c.files[0])
+	cmd.Env = append(os.Environ(), env...)
+	// A hook that leaves something running in the background holding its
+	// output open shouldn't keep us waiting past the timeout.
+	cmd.WaitDelay = time.Second
+	out := &tailBuffer{limit: hookOutputLimit}
+	cmd.Stdout, cmd.Stderr = out, out
+
+	start := time.Now()
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	return hookResult{name: h.displayName(), file: c.files[0], err: err, output: out.String(), took: time.Since(start)}
+}
+
+// tailBuffer keeps the last limit bytes written to it, so a chatty hook
+// can't fill memory before its timeout.
+type tailBuffer struct {
+	buf   []byte
+	limit int
+	cut   int64 // bytes dropped from the front
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	// Trim once there's a whole limit's worth extra, not on every write.
+	if extra := len(t.buf) - t.limit; extra >= t.limit {
+		t.cut += int64(extra)
+		t.buf = append(t.buf[:0], t.buf[extra:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	b, cut := t.buf, t.cut
+	if extra := len(b) - t.limit; extra > 0 {
+		b, cut = b[extra:], cut+int64(extra)
+	}
+	if cut == 0 {
+		return string(b)
+	}
+	// Start on a whole line where there is one.
+	if i := bytes.IndexByte(b, '\n'); i >= 0 && i < len(b)-1 {
+		b, cut = b[i+1:], cut+int64(i+1)
+	}
+	return fmt.Sprintf("[first %s cut]\n%s", formatSize(cut), b)
+}
+
+// hookEnv describes the capture in ATLAS_* variables, from its sidecar
+// where there is one.
+func hookEnv(c savedCapture) []string {
+	env := []string{
+		"ATLAS_KIND=" + c.kind,
+		"ATLAS_FILE=" + c.files[0],
+		"ATLAS_DIR=" + filepath.Dir(c.files[0]),
+		"ATLAS_SIDECAR=" + c.sidecar,
+	}
+	if c.sidecar == "" {
+		return env
+	}
+	meta, err := readCaptureMeta(c.sidecar)
+	if err != nil {
+		return env
+	}
+	env = append(env,
+		"ATLAS_MODE="+meta.Mode,
+		"ATLAS_FILTER="+meta.Filter,
+		"ATLAS_DEVICE="+meta.Device,
+		"ATLAS_WIDTH="+strconv.Itoa(meta.Width),
+		"ATLAS_HEIGHT="+strconv.Itoa(meta.Height),
+		"ATLAS_TAKEN="+meta.Started.Format(time.RFC3339),
+		"ATLAS_VERSION="+meta.Version,
+	)
+	if meta.Kind == "recording" {
+		env = append(env, "ATLAS_FORMAT="+meta.Format, "ATLAS_FRAMES="+strconv.Itoa(meta.Frames))
+	}
+	return env
+}
+
+func (r *hookRunner) logResult(res hookResult) {
+	r.logOnce.Do(func() {
+		path := r.logPath
+		if path == "" {
+			path = hookLogPath()
+		}
+		if path == "" {
+			return
+		}
+		os.MkdirAll(filepath.Dir(path), 0755)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return
+		}
+		r.log = log.New(f, "", log.LstdFlags)
+	})
+	if r.log == nil {
+		return
+	}
+	status := "ok"
+	if res.err != nil {
+		status = res.err.Error()
+	}
+	r.log.Printf("hook %s for %s: %s (%s)", res.name, res.file, status, res.took.Round(time.Millisecond))
+	if out := strings.TrimRight(res.output, "\n"); out != "" {
+		r.log.Printf("hook %s output:\n%s", res.name, out)
+	}
+}
+
+// status is the result as one line for the status bar: how it went and the
+// last thing it printed.
+func (res hookResult) status() string {
+	s := "Hook " + res.name
+	if res.err != nil {
+		s += " failed: " + res.err.Error()
+	} else {
+		s += fmt.Sprintf(" done (%s)", res.took.Round(100*time.Millisecond))
+	}
+	lines := strings.Split(strings.TrimSpace(res.output), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		s += ": " + last
+	}
+	return s
+}
+
+// waitForHookCmd delivers the next hook result.
+func waitForHookCmd(results <-chan hookResult) tea.Cmd {
+	return func() tea.Msg {
+		return hookResultMsg(<-results)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func nextHookResult(t *testing.T, r *hookRunner) hookResult {
+	t.Helper()
+	select {
+	case res := <-r.results:
+		return res
+	case <-time.After(10 * time.Second):
+		t.Fatal("hook never finished")
+		return hookResult{}
+	}
+}
+
+func TestHookGetsCapture(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run through sh here")
+	}
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.Render.Columns = 20
+	e := writeTestSnapshot(t, dir, "snap", testCapture.at, cfg)
+	files := []string{filepath.Join(dir, "snap.jpg"), filepath.Join(dir, "snap.txt")}
+
+	logPath := filepath.Join(dir, "hooks.log")
+	r := newHookRunner(logPath)
+	hooks := []HookConfig{
+		{Name: "env", Run: `echo "$ATLAS_KIND $ATLAS_MODE $ATLAS_DEVICE"; echo "$# $(basename "$1")"`},
+		{Name: "clips only", On: "recording", Run: "echo nope"},
+	}
+	r.start(hooks, savedCapture{kind: "photo", files: files, sidecar: e.path}, r.report)
+	res := nextHookResult(t, r)
+	r.wait()
+
+	if res.err != nil || res.name != "env" {
+		t.Fatalf("%s: %v", res.name, res.err)
+	}
+	if want := "photo ascii " + testCapture.device + "\n2 snap.jpg\n"; res.output != want {
+		t.Errorf("output = %q, want %q", res.output, want)
+	}
+	if got := res.status(); !strings.HasPrefix(got, "Hook env done") || !strings.HasSuffix(got, ": 2 snap.jpg") {
+		t.Errorf("status = %q", got)
+	}
+	select {
+	case res := <-r.results:
+		t.Errorf("%s ran for a photo", res.name)
+	default:
+	}
+
+	data, _ := os.ReadFile(logPath)
+	if !strings.Contains(string(data), "hook env for "+files[0]+": ok") || !strings.Contains(string(data), "2 snap.jpg") {
+		t.Errorf("log = %q", data)
+	}
+}
+
+func TestHookFailureAndTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run through sh here")
+	}
+	dir := t.TempDir()
+	r := newHookRunner(filepath.Join(dir, "hooks.log"))
+	c := savedCapture{kind: "recording", files: []string{filepath.Join(dir, "clip.gif")}}
+
+	r.start([]HookConfig{{Name: "upload", Run: "echo 'no network' >&2; exit 3"}}, c, r.report)
+	res := nextHookResult(t, r)
+	if got := res.status(); got != "Hook upload failed: exit status 3: no network" {
+		t.Errorf("status = %q", got)
+	}
+
+	start := time.Now()
+	r.start([]HookConfig{{Name: "slow", Run: "sleep 30", TimeoutSeconds: 1}}, c, r.report)
+	res = nextHookResult(t, r)
+	if res.err == nil || !strings.Contains(res.err.Error(), "timed out") {
+		t.Errorf("err = %v, want a timeout", res.err)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("timeout took %s", took)
+	}
+	r.wait()
+}
+
+func TestHookValidate(t *testing.T) {
+	for _, h := range []HookConfig{{Run: "true"}, {On: "Photo", Run: "true"}, {On: "recording", Run: "true"}} {
+		if err := h.validate(); err != nil {
+			t.Errorf("%+v: %v", h, err)
+		}
+	}
+	for _, h := range []HookConfig{{On: "video", Run: "true"}, {Name: "empty"}} {
+		if err := h.validate(); err == nil {
+			t.Errorf("%+v passed", h)
+		}
+	}
+}
+
+func TestHookResultShowsInStatus(t *testing.T) {
+	m, cmd := send(t, testModel(), hookResultMsg{name: "sync", output: "3 files\n", took: time.Second})
+	if m.statusText != "Hook sync done (1s): 3 files" {
+		t.Errorf("status = %q", m.statusText)
+	}
+	if cmd == nil {
+		t.Error("stopped listening for hook results")
+	}
+}
+
+func TestHookOutputIsCapped(t *testing.T) {
+	out := &tailBuffer{limit: 100}
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(out, "line %d\n", i)
+	}
+	if len(out.buf) >= 2*out.limit {
+		t.Errorf("holding %d bytes for a limit of %d", len(out.buf), out.limit)
+	}
+	got := out.String()
+	if !strings.HasPrefix(got, "[first ") || !strings.HasSuffix(got, "line 998\nline 999\n") {
+		t.Errorf("output = %q", got)
+	}
+	if _, rest, _ := strings.Cut(got, "\n"); len(rest) > 100 || !strings.HasPrefix(rest, "line ") {
+		t.Errorf("kept %q", rest)
+	}
+
+	small := &tailBuffer{limit: 100}
+	small.Write([]byte("all of it\n"))
+	if got := small.String(); got != "all of it\n" {
+		t.Errorf("short output = %q", got)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// --- HTML & SVG Export ---
+//
+// For docs and chat, where a .txt loses the color and a .jpg loses the
+// text. The rendered text (escapes and all) is split into runs of one
+// color, and each run becomes a <span> in a <pre> (HTML) or a <text>
+// element of its own (SVG). Recordings can be saved as a single HTML file
+// that plays the frames back with a few lines of script, no external files
+// needed.
+
+const (
+	exportBackground = "#0c0c0c"
+	exportForeground = "#cccccc"
+
+	svgFontSize   = 14
+	svgCharWidth  = 8.4 // 0.6em, the advance of most monospace fonts
+	svgLineHeight = 16
+	svgPadding    = 8
+)
+
+const htmlTheme = `body { margin: 0; background: ` + exportBackground + `; color: ` + exportForeground + `; }
+pre.atlas { margin: 0; padding: 1em; font: 14px/1.15 Menlo, Consolas, "DejaVu Sans Mono", monospace; }
+`
+
+// textRun is a stretch of text in one color. A nil fg is the default color.
+type textRun struct {
+	fg   *color.RGBA
+	text string
+}
+
+// styledLines splits rendered text into lines of runs, following the SGR
+// color escapes the renderers use (38;2 truecolor, 38;5 palette, 0 and 39
+// to reset). Other escapes are dropped.
+func styledLines(text string) [][]textRun {
+	var lines [][]textRun
+	var fg *color.RGBA
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		var runs []textRun
+		var cur strings.Builder
+		flush := func() {
+			if cur.Len() == 0 {
+				return
+			}
+			if n := len(runs); n > 0 && sameRunColor(runs[n-1].fg, fg) {
+				runs[n-1].text += cur.String()
+			} else {
+				runs = append(runs, textRun{fg: fg, text: cur.String()})
+			}
+			cur.Reset()
+		}
+		for i := 0; i < len(line); i++ {
+			if line[i] != 0x1b {
+				cur.WriteByte(line[i])
+				continue
+			}
+			end := strings.IndexFunc(line[i+1:], func(r rune) bool { return r >= 0x40 && r <= 0x7e && r != '[' })
+			if end < 0 {
+				break
+			}
+			seq := line[i+1 : i+1+end+1]
+			i += end + 1
+			if !strings.HasPrefix(seq, "[") || !strings.HasSuffix(seq, "m") {
+				continue
+			}
+			next := sgrForeground(seq[1:len(seq)-1], fg)
+			if !sameRunColor(next, fg) {
+				flush()
+				fg = next
+			}
+		}
+		flush()
+		lines = append(lines, runs)
+	}
+	return lines
+}
+
+// sgrForeground applies the parameters of an SGR escape to fg.
+func sgrForeground(params string, fg *color.RGBA) *color.RGBA {
+	p := strings.Split(params, ";")
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case "", "0", "39":
+			fg = nil
+		case "38":
+			if i+4 < len(p) && p[i+1] == "2" {
+				var c [3]uint8
+				for j := range c {
+					v, _ := strconv.Atoi(p[i+2+j])
+					c[j] = clampUint8(v)
+				}
+				fg = &color.RGBA{c[0], c[1], c[2], 255}
+				i += 4
+			} else if i+2 < len(p) && p[i+1] == "5" {
+				n, _ := strconv.Atoi(p[i+2])
+				c := xtermColor(n)
+				fg = &c
+				i += 2
+			}
+		}
+	}
+	return fg
+}
+
+func sameRunColor(a, b *color.RGBA) bool {
+	return a == b || (a != nil && b != nil && *a == *b)
+}
+
+// xtermColor is the color of an xterm 256 palette entry, using the usual
+// VGA-ish values for the 16 system colors.
+func xtermColor(n int) color.RGBA {
+	system := [16][3]uint8{
+		{0, 0, 0}, {170, 0, 0}, {0, 170, 0}, {170, 85, 0},
+		{0, 0, 170}, {170, 0, 170}, {0, 170, 170}, {170, 170, 170},
+		{85, 85, 85}, {255, 85, 85}, {85, 255, 85}, {255, 255, 85},
+		{85, 85, 255}, {255, 85, 255}, {85, 255, 255}, {255, 255, 255},
+	}
+	levels := [6]uint8{0, 95, 135, 175, 215, 255}
+	switch {
+	case n < 0 || n > 255:
+		return color.RGBA{204, 204, 204, 255}
+	case n < 16:
+		c := system[n]
+		return color.RGBA{c[0], c[1], c[2], 255}
+	case n < 232:
+		n -= 16
+		return color.RGBA{levels[n/36], levels[n/6%6], levels[n%6], 255}
+	default:
+		v := uint8(8 + 10*(n-232))
+		return color.RGBA{v, v, v, 255}
+	}
+}
+
+func hexColor(c *color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// htmlPre renders text as the contents of a <pre class="atlas">.
+func htmlPre(text string) string {
+	var b strings.Builder
+	for i, runs := range styledLines(text) {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		for _, r := range runs {
+			if r.fg == nil {
+				b.WriteString(html.EscapeString(r.text))
+				continue
+			}
+			fmt.Fprintf(&b, `<span style="color:%s">%s</span>`, hexColor(r.fg), html.EscapeString(r.text))
+		}
+	}
+	return b.String()
+}
+
+// htmlPage is a standalone page showing text.
+func htmlPage(text, title string) []byte {
+	var b bytes.Buffer
+	writeHTMLHead(&b, title, "")
+	fmt.Fprintf(&b, "<pre class=\"atlas\">%s</pre>\n</body>\n</html>\n", htmlPre(text))
+	return b.Bytes()
+}
+
+func writeHTMLHead(b io.StringWriter, title, css string) {
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	b.WriteString("<title>" + html.EscapeString(title) + "</title>\n")
+	b.WriteString("<style>\n" + htmlTheme + css + "</style>\n</head>\n<body>\n")
+}
+
+// svgImage renders text as an SVG, one <text> per run. textLength pins each
+// run to the character grid, whatever monospace font the viewer picks.
+func svgImage(text string) []byte {
+	lines := styledLines(text)
+	cols := 0
+	for _, runs := range lines {
+		n := 0
+		for _, r := range runs {
+			n += utf8.RuneCountInString(r.text)
+		}
+		cols = max(cols, n)
+	}
+	width := float64(cols)*svgCharWidth + 2*svgPadding
+	height := len(lines)*svgLineHeight + 2*svgPadding
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%d" viewBox="0 0 %g %d">`+"\n", width, height, width, height)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", exportBackground)
+	fmt.Fprintf(&b, `<g font-family="Menlo, Consolas, 'DejaVu Sans Mono', monospace" font-size="%d" fill="%s" xml:space="preserve">`+"\n", svgFontSize, exportForeground)
+	for y, runs := range lines {
+		col := 0
+		baseline := svgPadding + y*svgLineHeight + svgLineHeight*3/4
+		for _, r := range runs {
+			n := utf8.RuneCountInString(r.text)
+			x := svgPadding + float64(col)*svgCharWidth
+			col += n
+			if strings.TrimSpace(r.text) == "" {
+				continue
+			}
+			fill := ""
+			if r.fg != nil {
+				fill = fmt.Sprintf(` fill="%s"`, hexColor(r.fg))
+			}
+			fmt.Fprintf(&b, `<text x="%g" y="%d" textLength="%g" lengthAdjust="spacingAndGlyphs"%s>%s</text>`+"\n",
+				x, baseline, float64(n)*svgCharWidth, fill, html.EscapeString(r.text))
+		}
+	}
+	b.WriteString("</g>\n</svg>\n")
+	return b.Bytes()
+}
+
+// --- HTML Player Recording ---
+//
+// Frames are appended to a script array as they arrive, so the recording
+// is streamed to disk like the other formats; close adds the player.
+
+const htmlPlayerCSS = `.controls { padding: 0 1em 1em; font: 13px sans-serif; color: #888; }
+.controls button { margin-right: 1em; }
+`
+
+const htmlPlayerJS = `(() => {
+  const screen = document.getElementById("screen");
+  const button = document.getElementById("play");
+  const pos = document.getElementById("pos");
+  let i = 0, timer = null;
+  function tick() {
+    screen.innerHTML = frames[i].h;
+    pos.textContent = (i + 1) + " / " + frames.length;
+    const delay = frames[i].d * 10;
+    i = (i + 1) % frames.length;
+    timer = setTimeout(tick, delay);
+  }
+  button.onclick = () => {
+    if (timer) {
+      clearTimeout(timer);
+      timer = null;
+      button.textContent = "Play";
+    } else {
+      button.textContent = "Pause";
+      tick();
+    }
+  };
+  if (frames.length) tick();
+})();
+`
+
+type htmlPlayerSink struct {
+	f      *os.File
+	w      *bufio.Writer
+	n      int64
+	frames int
+	err    error
+}
+
+func newHTMLPlayerSink(path string) (*htmlPlayerSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &htmlPlayerSink{f: f}
+	s.w = bufio.NewWriter(&countingWriter{w: f, n: &s.n})
+	writeHTMLHead(s.w, "Atlas Cam", htmlPlayerCSS)
+	s.w.WriteString("<pre class=\"atlas\" id=\"screen\"></pre>\n")
+	s.w.WriteString("<div class=\"controls\"><button id=\"play\">Pause</button><span id=\"pos\"></span></div>\n")
+	s.w.WriteString("<script>\nconst frames = [\n")
+	return s, nil
+}
+
+func (s *htmlPlayerSink) writeText(text string, delay int) error {
+	if s.err != nil {
+		return s.err
+	}
+	// json.Marshal escapes <, > and &, so frames can't close the script.
+	frame, err := json.Marshal(struct {
+		D int    `json:"d"`
+		H string `json:"h"`
+	}{delay, htmlPre(text)})
+	if err != nil {
+		return err
+	}
+	s.w.Write(frame)
+	_, s.err = s.w.WriteString(",\n")
+	s.frames++
+	return s.err
+}
+
+func (s *htmlPlayerSink) size() int64 {
+	return s.n + int64(s.w.Buffered())
+}
+
+func (s *htmlPlayerSink) close() error {
+	if s.err == nil {
+		s.w.WriteString("];\n</script>\n<script>\n" + htmlPlayerJS + "</script>\n</body>\n</html>\n")
+		s.err = s.w.Flush()
+	}
+	if err := s.f.Close(); s.err == nil {
+		s.err = err
+	}
+	return s.err
+}
+
+func (s *htmlPlayerSink) summary() string {
+	return ""
+}
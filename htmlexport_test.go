@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStyledLines(t *testing.T) {
+	red := &color.RGBA{255, 0, 0, 255}
+	text := "a<b\x1b[38;2;255;0;0m██\x1b[38;2;255;0;0m█\x1b[0m \n\x1b[38;5;196mx\x1b[39my\n"
+	got := styledLines(text)
+	want := [][]textRun{
+		{{nil, "a<b"}, {red, "███"}, {nil, " "}},
+		{{red, "x"}, {nil, "y"}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if len(got[i]) != len(want[i]) {
+			t.Fatalf("line %d has %d runs, want %d", i, len(got[i]), len(want[i]))
+		}
+		for j, r := range want[i] {
+			if g := got[i][j]; g.text != r.text || !sameRunColor(g.fg, r.fg) {
+				t.Errorf("line %d run %d = %v %q, want %v %q", i, j, g.fg, g.text, r.fg, r.text)
+			}
+		}
+	}
+}
+
+func TestHTMLPage(t *testing.T) {
+	page := string(htmlPage("<&>\n\x1b[38;2;0;128;255m██\x1b[0m\n", "snap"))
+	for _, want := range []string{
+		"<title>snap</title>",
+		`<pre class="atlas">&lt;&amp;&gt;` + "\n" + `<span style="color:#0080ff">██</span></pre>`,
+		"background: " + exportBackground,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page is missing %q", want)
+		}
+	}
+}
+
+func TestSVGImage(t *testing.T) {
+	frame := readFrame(t, newFakeReader(drawBall))
+	svg := svgImage(imageToANSI(frame, 20, 10))
+
+	var doc struct {
+		Width  float64 `xml:"width,attr"`
+		Height int     `xml:"height,attr"`
+		Texts  []struct {
+			Fill string `xml:"fill,attr"`
+			Text string `xml:",chardata"`
+		} `xml:"g>text"`
+	}
+	if err := xml.Unmarshal(svg, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Texts) == 0 {
+		t.Fatal("no text elements")
+	}
+	for _, txt := range doc.Texts {
+		if !strings.HasPrefix(txt.Fill, "#") || strings.Trim(txt.Text, "█") != "" {
+			t.Fatalf("unexpected run %+v", txt)
+		}
+	}
+	lines := strings.Count(imageToANSI(frame, 20, 10), "\n")
+	if want := lines*svgLineHeight + 2*svgPadding; doc.Height != want {
+		t.Errorf("height = %d, want %d", doc.Height, want)
+	}
+}
+
+func TestHTMLPlayerRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.html")
+	rec, err := startRecording(path, recordHTML, RecordingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newFakeReader(drawBall)
+	for i := 0; i < 3; i++ {
+		at := time.Unix(0, 0).Add(time.Duration(i) * 100 * time.Millisecond)
+		rec.add(recFrame{img: readFrame(t, r), at: at, mode: ModeColor, width: 30, height: 14})
+	}
+	if msg := string(rec.stop()().(statusMsg)); !strings.HasPrefix(msg, "Saved HTML player") {
+		t.Fatalf("stop returned %q", msg)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := bytes.Index(data, []byte("const frames = ["))
+	end := bytes.Index(data, []byte("];\n</script>"))
+	if start < 0 || end < start {
+		t.Fatal("no frame data in the page")
+	}
+	list := bytes.TrimSuffix(bytes.TrimSpace(data[start+len("const frames = "):end]), []byte(","))
+	var frames []struct {
+		D int    `json:"d"`
+		H string `json:"h"`
+	}
+	if err := json.Unmarshal(append(list, ']'), &frames); err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("%d frames, want 3", len(frames))
+	}
+	for i, f := range frames {
+		if f.D != 10 || !strings.Contains(f.H, "<span style=") {
+			t.Errorf("frame %d = delay %d, %.40q", i, f.D, f.H)
+		}
+	}
+	if bytes.Contains(data[start:end], []byte("</")) {
+		t.Error("frame data could close the script tag")
+	}
+	if !bytes.Contains(data, []byte(`id="screen"`)) || !bytes.HasSuffix(data, []byte("</html>\n")) {
+		t.Error("player markup is incomplete")
+	}
+}
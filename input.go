@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --- Stream Inputs ---
+//
+// Besides real cameras, atlas.cam can read frames from a file or stdin, e.g.
+//
+//	ffmpeg -i clip.mp4 -f yuv4mpegpipe - | atlas.cam --input -
+//	ffmpeg -i clip.mp4 -f mjpeg - | atlas.cam --input -
+//
+// The container is sniffed from the first bytes, so both work on pipes.
+
+type inputOptions struct {
+	fps  float64 // pacing rate for sources that don't carry one (MJPEG)
+	fast bool    // ignore pacing and decode as fast as possible
+	loop bool    // rewind files on EOF instead of ending the stream
+}
+
+const defaultInputFPS = 30
+
+// interval is the pacing period for sources without their own timing.
+func (o inputOptions) interval() time.Duration {
+	if o.fast {
+		return 0
+	}
+	fps := o.fps
+	if fps <= 0 {
+		fps = defaultInputFPS
+	}
+	return time.Duration(float64(time.Second) / fps)
+}
+
+// frameDecoder pulls single frames out of a container stream.
+type frameDecoder interface {
+	decode(br *bufio.Reader) (image.Image, error)
+	// frameInterval is the native frame period of the stream, 0 if unknown.
+	frameInterval() time.Duration
+}
+
+// streamReader is a VideoReader over a byte stream (file or stdin). It
+// handles pacing and EOF behaviour, the actual parsing is up to the decoder.
+type streamReader struct {
+	path   string
+	src    io.ReadCloser
+	br     *bufio.Reader
+	dec    frameDecoder
+	newDec func() frameDecoder
+	opts   inputOptions
+	pace   pacer
+}
+
+func openStreamInput(path string, opts inputOptions) (*streamReader, error) {
+	src, err := openInputFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReaderSize(src, 1<<16)
+	newDec, err := sniffContainer(br, path)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+
+	return &streamReader{
+		path:   path,
+		src:    src,
+		br:     br,
+		dec:    newDec(),
+		newDec: newDec,
+		opts:   opts,
+	}, nil
+}
+
+func openInputFile(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// sniffContainer picks a decoder from the stream magic, falling back to the
+// file extension for streams that start with junk (e.g. multipart preamble).
+func sniffContainer(br *bufio.Reader, path string) (func() frameDecoder, error) {
+	head, _ := br.Peek(16)
+	switch {
+	case bytes.HasPrefix(head, []byte(y4mMagic)):
+		return func() frameDecoder { return &y4mDecoder{} }, nil
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8}), bytes.HasPrefix(head, []byte("--")):
+		return func() frameDecoder { return &mjpegDecoder{} }, nil
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".y4m":
+		return func() frameDecoder { return &y4mDecoder{} }, nil
+	case ".mjpeg", ".mjpg", ".jpg", ".jpeg":
+		return func() frameDecoder { return &mjpegDecoder{} }, nil
+	}
+
+	if len(head) == 0 {
+		return nil, fmt.Errorf("input %s is empty", path)
+	}
+	return nil, fmt.Errorf("unrecognised input format (want YUV4MPEG2 or MJPEG)")
+}
+
+func (r *streamReader) Read() (image.Image, func(), error) {
+	for {
+		img, err := r.dec.decode(r.br)
+		if err == nil {
+			r.pace.wait(r.interval())
+			return img, func() {}, nil
+		}
+		if !errors.Is(err, io.EOF) || !r.opts.loop || r.path == "-" {
+			return nil, nil, err
+		}
+		if err := r.rewind(); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+func (r *streamReader) interval() time.Duration {
+	if r.opts.fast {
+		return 0
+	}
+	if d := r.dec.frameInterval(); d > 0 {
+		return d
+	}
+	return r.opts.interval()
+}
+
+// rewind reopens the file from the start. Reopening (rather than seeking)
+// also resets any header state the decoder has parsed.
+func (r *streamReader) rewind() error {
+	r.src.Close()
+	src, err := openInputFile(r.path)
+	if err != nil {
+		return err
+	}
+	r.src = src
+	r.br.Reset(src)
+	r.dec = r.newDec()
+	return nil
+}
+
+func (r *streamReader) Close() error {
+	return r.src.Close()
+}
+
+// pacer sleeps so that frames come out at a steady rate. If we fall more
+// than a frame behind (slow decoding) it resyncs instead of bursting.
+type pacer struct {
+	next time.Time
+}
+
+func (p *pacer) wait(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	now := time.Now()
+	if p.next.IsZero() || now.Sub(p.next) > interval {
+		p.next = now
+	}
+	if d := p.next.Sub(now); d > 0 {
+		time.Sleep(d)
+	}
+	p.next = p.next.Add(interval)
+}
+
+// --- Commands ---
+
+type inputEndedMsg struct{}
+
+func openInputCmd(path string, opts inputOptions) tea.Cmd {
+	if isNetCamURL(path) {
+		return openNetCamCmd(NetCamConfig{URL: path})
+	}
+	if isPatternInput(path) {
+		return func() tea.Msg {
+			r, err := newPatternReader(path, opts)
+			if err != nil {
+				return errorMsg(err)
+			}
+			return cameraReadyMsg{reader: r, driverID: path}
+		}
+	}
+	return func() tea.Msg {
+		r, err := openStreamInput(path, opts)
+		if err != nil {
+			return errorMsg(fmt.Errorf("failed to open input: %w", err))
+		}
+		name := path
+		if path == "-" {
+			name = "stdin"
+		}
+		return cameraReadyMsg{reader: r, driverID: name}
+	}
+}
+
+// closeReader releases non-mediadevices readers (files, sockets, ...).
+func closeReader(r VideoReader) {
+	if c, ok := r.(io.Closer); ok {
+		c.Close()
+	}
+}
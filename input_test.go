@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTemp(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUnknownInput(t *testing.T) {
+	path := writeTemp(t, "junk.bin", []byte("definitely not video"))
+	if _, err := openStreamInput(path, inputOptions{}); err == nil {
+		t.Error("expected an error for an unrecognised container")
+	}
+}
@@ -1,13 +1,13 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
-	"image/gif"
-	"image/jpeg"
 	_ "image/png"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,15 +17,10 @@ import (
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
 
 	"github.com/nfnt/resize"
 
 	"github.com/pion/mediadevices"
-	"github.com/pion/mediadevices/pkg/driver"
 	_ "github.com/pion/mediadevices/pkg/driver/camera"
 	"github.com/pion/mediadevices/pkg/prop"
 )
@@ -251,47 +246,6 @@ func imageToANSI(img image.Image, width, height int) string {
         return sb.String()
     }
     
-    func textToImage(text string) image.Image {
-    
-	lines := strings.Split(text, "\n")
-	if len(lines) == 0 { return image.NewRGBA(image.Rect(0,0,1,1)) }
-	
-	// Basic font is 7x13
-	charW := 7
-	charH := 13
-	
-	width := 0
-	for _, line := range lines {
-		if len(line) > width { width = len(line) }
-	}
-	width *= charW
-	height := len(lines) * charH
-	
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	// Fill black
-	for i := 0; i < len(img.Pix); i+=4 {
-		img.Pix[i] = 0
-		img.Pix[i+1] = 0
-		img.Pix[i+2] = 0
-		img.Pix[i+3] = 255
-	}
-	
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  image.White,
-		Face: basicfont.Face7x13,
-		Dot:  fixed.P(0, charH),
-	}
-	
-	for _, line := range lines {
-		d.Dot.X = 0
-		d.DrawString(line)
-		d.Dot.Y += fixed.I(charH)
-	}
-	
-	return img
-}
-
 func applyFilter(img image.Image, f Filter) image.Image {
 	if f == FilterNone { return img }
 	
@@ -333,6 +287,21 @@ func applyFilter(img image.Image, f Filter) image.Image {
 	return newImg
 }
 
+// renderArt draws img as text in mode. Everything that shows or saves the
+// art goes through here. The color mode ignores center.
+func renderArt(img image.Image, mode Mode, width, height int, center bool) string {
+	switch mode {
+	case ModeColor:
+		return imageToANSI(img, width, height)
+	case ModeStructure:
+		return imageToStructureAscii(img, width, height, center)
+	case ModeDetailed:
+		return imageToAscii(img, width, height, asciiDetailed, center)
+	default:
+		return imageToAscii(img, width, height, asciiStandard, center)
+	}
+}
+
 // --- Types ---
 
 type Mode int
@@ -385,7 +354,10 @@ type clearStatusMsg struct{}
 type cameraReadyMsg struct {
 	stream mediadevices.MediaStream
 	reader VideoReader
-	driverID string
+	driverID string // display name
+	deviceID string // mediadevices ID, local cameras only
+	source   string // videoSource key, empty for file/pattern input
+	format   string // negotiated mode, if known
 }
 
 type VideoReader interface {
@@ -412,12 +384,27 @@ type model struct {
     keys        keyMap
 	showHelp    bool
 	
-	recording   bool
-	recFrames   []image.Image
-	recStart    time.Time
+	rec         *recorder // nil when not recording
+	recFormat   recordingFormat
 	
-	devices     []mediadevices.MediaDeviceInfo
-	currentDev  int
+	cfg         Config
+	devices     []videoSource
+	currentDev  int // index into devices of the open source, -1 if none
+	
+	input       string
+	inputOpts   inputOptions
+	
+	readerGen   int
+	activeID    string // mediadevices ID of the open camera, if any
+	activeKey   string // videoSource key of the open source, if any
+	sourceLabel string
+	reconnects  int // attempts so far, 0 when not reconnecting
+	retrying    bool // a network camera is reconnecting on its own
+	format      string
+	picker      *picker
+	gallery     *gallery // nil unless browsing captures
+	session     *sshSession // nil unless this is an ssh-serve session
+	clipboard   string // an OSC 52 copy on its way out with the view
 	
 	err error
 }
@@ -429,6 +416,13 @@ type keyMap struct {
     Mode   key.Binding
     Help   key.Binding
     Record key.Binding
+    RecFormat key.Binding
+    Format key.Binding
+    Devices key.Binding
+    Gallery key.Binding
+    Copy   key.Binding
+    CopyANSI key.Binding
+    Retry  key.Binding
     Quit   key.Binding
 }
 
@@ -438,34 +432,47 @@ var keys = keyMap{
     Filter: key.NewBinding(key.WithKeys("f"), key.WithHelp("f", "cycle filter")),
     Mode:   key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "toggle mode")),
     Help:   key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "toggle help")),
-    Record: key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "record gif")),
+    Record: key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "record")),
+    RecFormat: key.NewBinding(key.WithKeys("g"), key.WithHelp("g", "recording format")),
+    Format: key.NewBinding(key.WithKeys("o"), key.WithHelp("o", "camera format")),
+    Devices: key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "devices")),
+    Gallery: key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "gallery")),
+    Copy:   key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "copy text")),
+    CopyANSI: key.NewBinding(key.WithKeys("Y"), key.WithHelp("Y", "copy with color")),
+    Retry:  key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "retry")),
     Quit:   key.NewBinding(key.WithKeys("q", "esc", "ctrl+c"), key.WithHelp("q", "quit")),
 }
 
 func (k keyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.Snap, k.Record, k.Mode, k.Filter, k.Switch, k.Help, k.Quit}
+	return []key.Binding{k.Snap, k.Record, k.Mode, k.Filter, k.Switch, k.Devices, k.Format, k.Help, k.Quit}
 }
 
 func (k keyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.Snap, k.Record, k.Mode},
-		{k.Filter, k.Switch, k.Help, k.Quit},
+		{k.Snap, k.Record, k.RecFormat, k.Mode},
+		{k.Filter, k.Switch, k.Devices, k.Format},
+		{k.Copy, k.CopyANSI, k.Gallery},
+		{k.Help, k.Quit},
 	}
 }
 
-// --- Init & Update ---
-
-func initialModel() model {
-	devices := mediadevices.EnumerateDevices()
-	var videoDevs []mediadevices.MediaDeviceInfo
-	for _, d := range devices {
-		if d.DeviceType == driver.Camera {
-			videoDevs = append(videoDevs, d)
+// errorHint lists the ways off the error screen that are switched on.
+func (k keyMap) errorHint() string {
+	var parts []string
+	for _, b := range []key.Binding{k.Retry, k.Devices, k.Quit} {
+		if b.Enabled() {
+			parts = append(parts, b.Help().Key+" "+b.Help().Desc)
 		}
 	}
+	return strings.Join(parts, " • ")
+}
+
+// --- Init & Update ---
 
+func initialModel(cfg Config, input string, opts inputOptions) model {
 	h := help.New()
 	h.ShowAll = true // Always show full help when visible
+	recFormat, _ := parseRecordingFormat(cfg.Recording.Format) // checked in main
 
 	return model{
 		mode: ModeASCII,
@@ -473,68 +480,84 @@ func initialModel() model {
 		help: h,
 		keys: keys,
 		statusText: "Initializing...",
-		devices: videoDevs,
+		cfg: cfg,
+		devices: listSources(cfg),
+		currentDev: -1,
+		input: input,
+		inputOpts: opts,
+		recFormat: recFormat,
 	}
 }
 
 func (m model) Init() tea.Cmd {
+	if m.session != nil {
+		// The server has the camera open already, we just watch.
+		return tea.Batch(m.session.readyCmd(), tea.EnterAltScreen)
+	}
     return tea.Batch(
-		initCameraCmd,
+		openSourceCmd(m.cfg, m.devices, m.input, m.inputOpts),
+		rescanTickCmd(m.cfg.Camera.RescanSeconds),
+		waitForHookCmd(captureHooks.results),
 		tea.EnterAltScreen,
 	)
 }
 
-func initCameraCmd() tea.Msg {
-	s, err := mediadevices.GetUserMedia(mediadevices.MediaStreamConstraints{
-		Video: func(c *mediadevices.MediaTrackConstraints) {
-			// Relaxed constraints to find any matching driver
-		},
-	})
-	
-	if err != nil {
-		return errorMsg(fmt.Errorf("failed to open camera: %w", err))
+// openSourceCmd opens what we were asked to show at startup: the input, the
+// configured device, or else the first camera.
+func openSourceCmd(cfg Config, devices []videoSource, input string, opts inputOptions) tea.Cmd {
+	switch {
+	case input != "":
+		return openInputCmd(input, opts)
+	case cfg.Camera.Device != "":
+		for _, d := range devices {
+			if d.matches(cfg.Camera.Device) {
+				return d.openCmd(cfg.Camera)
+			}
+		}
+		return func() tea.Msg {
+			return errorMsg(fmt.Errorf("no camera matching %q", cfg.Camera.Device))
+		}
 	}
-	
-	if len(s.GetVideoTracks()) == 0 {
-		for _, t := range s.GetTracks() { t.Close() }
-		return errorMsg(fmt.Errorf("no video tracks found"))
+	return initCameraCmd(cfg.Camera)
+}
+
+func initCameraCmd(want CameraConfig) tea.Cmd {
+	return func() tea.Msg {
+		msg, err := openCamera("", want)
+		if err != nil {
+			return errorMsg(fmt.Errorf("failed to open camera: %w", err))
+		}
+		return msg
 	}
-	
-	track := s.GetVideoTracks()[0]
-	videoTrack := track.(*mediadevices.VideoTrack)
-	reader := videoTrack.NewReader(false)
-	
-	return cameraReadyMsg{stream: s, reader: reader}
 }
 
-func switchCameraCmd(driverID string) tea.Cmd {
+func switchCameraCmd(driverID string, want CameraConfig) tea.Cmd {
 	return func() tea.Msg {
-		s, err := mediadevices.GetUserMedia(mediadevices.MediaStreamConstraints{
-			Video: func(c *mediadevices.MediaTrackConstraints) {
-				c.DeviceID = prop.String(driverID)
-			},
-		})
-		
+		msg, err := openCamera(driverID, want)
 		if err != nil { return errorMsg(err) }
-		
-		if len(s.GetVideoTracks()) == 0 {
-			for _, t := range s.GetTracks() { t.Close() }
-			return errorMsg(fmt.Errorf("no video tracks found on new device"))
-		}
-		
-		track := s.GetVideoTracks()[0]
-		videoTrack := track.(*mediadevices.VideoTrack)
-		reader := videoTrack.NewReader(false)
-		
-		return cameraReadyMsg{stream: s, reader: reader, driverID: driverID}
+		return msg
 	}
 }
 
-func readFrameCmd(reader VideoReader) tea.Cmd {
+// readMsg carries a read loop's result along with the reader generation it
+// came from, so results from a reader we've since replaced can be dropped.
+type readMsg struct {
+	gen int
+	msg tea.Msg
+}
+
+func readFrameCmd(reader VideoReader, gen int) tea.Cmd {
 	return func() tea.Msg {
 		frame, release, err := reader.Read()
+		var retry *netCamRetry
+		if errors.As(err, &retry) {
+			return readMsg{gen, netCamRetryMsg{retry}}
+		}
+		if errors.Is(err, io.EOF) {
+			return readMsg{gen, inputEndedMsg{}}
+		}
 		if err != nil {
-			return errorMsg(err)
+			return readMsg{gen, errorMsg(err)}
 		}
 		
 		bounds := frame.Bounds()
@@ -547,7 +570,7 @@ func readFrameCmd(reader VideoReader) tea.Cmd {
 		}
 		
 		release()
-		return frameMsg(clone)
+		return readMsg{gen, frameMsg(clone)}
 	}
 }
 
@@ -557,119 +580,26 @@ func (m model) savePhoto() tea.Cmd {
 	}
 	
 	// Capture the current frame in a closure to avoid race if m.currentFrame changes
-	frameToSave := m.currentFrame
-	currentFilter := m.filter
-	currentMode := m.mode
-	// Capture dimensions for ASCII text generation
-	w, h := m.width, m.height
+	snap := snapshot{frame: m.currentFrame, mode: m.mode, filter: m.filter, info: m.captureInfo()}
+	cfg := m.cfg
+	report := m.hookReport()
 	
 	return func() tea.Msg {
-		home, _ := os.UserHomeDir()
-		dir := filepath.Join(home, "Pictures", "AtlasCam")
-		if err := os.MkdirAll(dir, 0755); err != nil {
+		base, err := photoPath(cfg.Output, snap.info)
+		if err != nil {
 			return errorMsg(err)
 		}
-		
-		timestamp := time.Now().Unix()
-		name := fmt.Sprintf("atlas_cam_%d", timestamp)
-		
-		// 1. Save High-Res Image (JPG)
-		// If in Color Mode, we save the High Res filtered image.
-		// If in ASCII Mode, we save the RENDERED ASCII IMAGE.
-		
-		pathJPG := filepath.Join(dir, name+".jpg")
-		f, err := os.Create(pathJPG)
-		if err != nil { return errorMsg(err) }
-		defer f.Close()
-
-		filteredFrame := applyFilter(frameToSave, currentFilter)
-		
-		var finalImage image.Image
-		finalImage = filteredFrame
-		
-		if currentMode == ModeASCII || currentMode == ModeDetailed || currentMode == ModeStructure {
-			chars := asciiStandard
-			if currentMode == ModeDetailed { chars = asciiDetailed }
-			
-			var txt string
-			if currentMode == ModeStructure {
-				txt = imageToStructureAscii(filteredFrame, w, h-4, false)
-			} else {
-				txt = imageToAscii(filteredFrame, w, h-4, chars, false)
-			}
-			
-			// Convert that text to an image
-			finalImage = textToImage(txt)
-			
-			// Also save the text file since we have it
-			pathTXT := filepath.Join(dir, name+".txt")
-			os.WriteFile(pathTXT, []byte(txt), 0644)
-		}
-
-		if err := jpeg.Encode(f, finalImage, nil); err != nil {
+		saved, err := writeSnapshot(base, snap, cfg)
+		captureNames.release(base)
+		if err != nil {
 			return errorMsg(err)
 		}
-		
-		return statusMsg("Saved " + name + ".jpg")
-	}
-}
-
-func (m model) saveVideo(frames []image.Image) tea.Cmd {
-	if len(frames) == 0 { return nil }
-	
-	return func() tea.Msg {
-		home, _ := os.UserHomeDir()
-		dir := filepath.Join(home, "Pictures", "AtlasCam")
-		if err := os.MkdirAll(dir, 0755); err != nil { return errorMsg(err) }
-		
-		name := fmt.Sprintf("atlas_cam_clip_%d.gif", time.Now().Unix())
-		path := filepath.Join(dir, name)
-		f, err := os.Create(path)
-		if err != nil { return errorMsg(err) }
-		defer f.Close()
-		
-		// Convert frames to Paletted for GIF
-		// This is slow, so we do it here in the goroutine
-		outGIF := &gif.GIF{}
-		
-		// Use a standard palette. 
-		// For ASCII (BW), we can use a small palette.
-		// For Color, we need Plan9 or similar.
-		// Let's use Plan9 for safety.
-		// opts := gif.Options{NumColors: 256, Drawer: draw.FloydSteinberg} // Unused
-		
-		for _, src := range frames {
-			bounds := src.Bounds()
-			paletted := image.NewPaletted(bounds, 	color.Palette{
-				color.Black, color.White, color.RGBA{255,0,0,255}, color.RGBA{0,255,0,255}, color.RGBA{0,0,255,255},
-				// Add grays
-				color.Gray{0x33}, color.Gray{0x66}, color.Gray{0x99}, color.Gray{0xCC},
-			})
-			
-			// Actually, just use standard quantizer if possible, but manual palette is faster?
-			// Let's use a simple quantization
-			// Draw into paletted image
-			draw.Draw(paletted, bounds, src, bounds.Min, draw.Src)
-			
-			outGIF.Image = append(outGIF.Image, paletted)
-			outGIF.Delay = append(outGIF.Delay, 4) // 4x10ms = 40ms ~ 25fps
+		var files []string
+		for _, ext := range saved {
+			files = append(files, base+ext)
 		}
-		
-		// EncodeAll does not take options? Wait.
-		// gif.EncodeAll signature is (w io.Writer, g *GIF) error
-		// Options are only for Encode (single frame) or EncodeAll does not support them?
-		// Ah, EncodeAll just encodes the GIF struct. The Quantizer is used during paletted creation.
-		// My mistake. The 'opts' variable I created earlier (with NumColors) is for 'draw.Quantizer' interface usage 
-		// if we were using a Quantizer. But here I am manually creating Paletted image.
-		// 
-		// Actually, standard library image/draw doesn't have a simple "Quantize to this palette" function
-		// except draw.Draw which just finds nearest color.
-		
-		// So 'opts' is unused. I should remove it.
-		
-		gif.EncodeAll(f, outGIF)
-		
-		return statusMsg("Saved GIF: " + name)
+		captureHooks.start(cfg.Hooks, savedCapture{kind: "photo", files: files, sidecar: base + ".json"}, report)
+		return statusMsg("Saved " + filepath.Base(base) + " (" + strings.Join(saved, ", ") + ")")
 	}
 }
 
@@ -684,48 +614,70 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.stream != nil && m.stream != msg.stream {
 			for _, t := range m.stream.GetTracks() { t.Close() }
 		}
+		if m.reader != nil {
+			closeReader(m.reader)
+		}
 		m.stream = msg.stream
 		m.reader = msg.reader
+		m.readerGen++
+		m.activeID = msg.deviceID
+		m.activeKey = msg.source
+		m.format = msg.format
+		m.sourceLabel = msg.driverID
+		m.currentDev = findSource(m.devices, m.activeKey)
+		m.reconnects = 0
+		m.retrying = false
+		m.err = nil
 		m.statusText = "Camera Ready"
 		if msg.driverID != "" {
 			m.statusText += fmt.Sprintf(" (%s)", msg.driverID)
 		}
-		return m, readFrameCmd(m.reader)
+		return m, readFrameCmd(m.reader, m.readerGen)
+		
+	case readMsg:
+		if msg.gen != m.readerGen {
+			return m, nil
+		}
+		if err, ok := msg.msg.(errorMsg); ok {
+			return m.readFailed(err)
+		}
+		return m.Update(msg.msg)
 		
 	case frameMsg:
 		m.currentFrame = image.Image(msg)
+		if m.retrying {
+			m.retrying = false
+			m.statusText = "Reconnected to " + m.sourceName()
+		}
 		
 		// Recording Logic
-		if m.recording {
-			// Process frame EXACTLY as we do for saving/viewing
-			// This duplicates some logic but ensures consistency
-			filtered := applyFilter(m.currentFrame, m.filter)
-			
-			var frameToRec image.Image
-			
-			if m.mode == ModeASCII || m.mode == ModeDetailed || m.mode == ModeStructure {
-				chars := asciiStandard
-				if m.mode == ModeDetailed { chars = asciiDetailed }
-				
-				var txt string
-				// No margin for video
-				if m.mode == ModeStructure {
-					txt = imageToStructureAscii(filtered, m.width, m.height-4, false)
-				} else {
-					txt = imageToAscii(filtered, m.width, m.height-4, chars, false)
-				}
-				frameToRec = textToImage(txt)
+		var stop tea.Cmd
+		if m.rec != nil {
+			if reason := m.rec.limitReached(); reason != "" {
+				stop = m.stopRecording()
+				m.statusText = "Recording stopped at " + reason + ", saving..."
 			} else {
-				frameToRec = filtered
+				m.rec.add(recFrame{img: m.currentFrame, at: time.Now(), mode: m.mode, filter: m.filter, width: m.width, height: m.height})
 			}
-			
-			// Append copy? textToImage creates new, applyFilter creates new.
-			// m.currentFrame is reused? No, readFrameCmd creates new copy.
-			// So we are safe to just append.
-			m.recFrames = append(m.recFrames, frameToRec)
 		}
 		
-		return m, readFrameCmd(m.reader) // Loop
+		return m, tea.Batch(readFrameCmd(m.reader, m.readerGen), stop) // Loop
+		
+	case netCamRetryMsg:
+		m.retrying = true
+		m.statusText = fmt.Sprintf("Reconnecting to %s: %v", m.sourceName(), msg.err)
+		return m, readFrameCmd(m.reader, m.readerGen)
+		
+	case inputEndedMsg:
+		if m.canReconnect() {
+			return m.readFailed(errCameraStopped)
+		}
+		// Stream input ran out (and isn't looping). Flush any recording first.
+		closeReader(m.reader)
+		if m.rec != nil {
+			return m, tea.Sequence(m.stopRecording(), tea.Quit)
+		}
+		return m, tea.Quit
 		
 	case errorMsg:
 		m.err = msg
@@ -739,60 +691,415 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return clearStatusMsg{}
 		})
 
+	case hookResultMsg:
+		next, clear := m.Update(statusMsg(hookResult(msg).status()))
+		if m.session != nil {
+			return next, clear // sent straight to the program, nothing to wait on
+		}
+		return next, tea.Batch(clear, waitForHookCmd(captureHooks.results))
+		
+	case clipboardDoneMsg:
+		if m.clipboard == msg.seq {
+			m.clipboard = ""
+		}
+		return m, nil
+
 	case clearStatusMsg:
 		m.statusText = ""
 		return m, nil
+		
+	case cameraModesMsg:
+		if msg.err != nil {
+			m.statusText = "Can't list formats: " + msg.err.Error()
+			return m, nil
+		}
+		items := make([]string, len(msg.modes))
+		payload := make([]any, len(msg.modes))
+		active := -1
+		for i, v := range msg.modes {
+			items[i] = formatMode(v)
+			payload[i] = v
+			if items[i] == m.format {
+				active = i
+			}
+		}
+		m.picker = newPicker(pickerCameraMode, "Camera Format", items, payload, active)
+		return m, nil
+		
+	case reconnectTickMsg:
+		if msg.gen != m.readerGen || m.reconnects == 0 {
+			return m, nil
+		}
+		return m, reconnectCmd(m.cfg, m.activeKey, m.sourceName(), m.readerGen)
+		
+	case reconnectMsg:
+		if msg.gen != m.readerGen || m.reconnects == 0 {
+			// Switched elsewhere meanwhile, don't leak what we opened.
+			if msg.ready != nil {
+				closeReady(*msg.ready)
+			}
+			return m, nil
+		}
+		m.setDevices(msg.devices)
+		if msg.err != nil {
+			return m.retryLater(msg.err)
+		}
+		return m.Update(*msg.ready)
+		
+	case rescanTickMsg:
+		return m, tea.Batch(rescanDevicesCmd(m.cfg), rescanTickCmd(m.cfg.Camera.RescanSeconds))
+		
+	case devicesMsg:
+		m.setDevices(msg)
+		return m, nil
+		
+	case galleryPreviewMsg:
+		if m.gallery == nil {
+			if msg.player != nil {
+				msg.player.close()
+			}
+			return m, nil
+		}
+		return m, m.gallery.setPreview(msg)
+		
+	case galleryThumbMsg:
+		if m.gallery == nil {
+			return m, nil
+		}
+		return m, m.gallery.setThumb(msg)
+		
+	case galleryTickMsg:
+		if m.gallery == nil {
+			return m, nil
+		}
+		return m, m.gallery.advance(msg)
+		
+	case galleryExportedMsg:
+		var load tea.Cmd
+		if m.gallery != nil {
+			m.gallery.reload()
+			load = m.gallery.loadPreview()
+		}
+		next, clear := m.Update(statusMsg(msg))
+		return next, tea.Batch(load, clear)
 
 	case tea.KeyMsg:
+		if m.picker != nil && msg.String() != "ctrl+c" {
+			return m.updatePicker(msg)
+		}
+		if m.gallery != nil && msg.String() != "ctrl+c" {
+			return m.updateGallery(msg)
+		}
 		switch {
 		case key.Matches(msg, m.keys.Quit):
-			if m.stream != nil {
-				for _, t := range m.stream.GetTracks() { t.Close() }
+			m.closeSource()
+			if m.rec != nil {
+				// Finish the file rather than leave it without a trailer.
+				return m, tea.Sequence(m.stopRecording(), tea.Quit)
 			}
 			return m, tea.Quit
 			
 		case key.Matches(msg, m.keys.Record):
-			m.recording = !m.recording
-			if m.recording {
-				m.recFrames = []image.Image{}
-				m.recStart = time.Now()
-				m.statusText = "Recording..."
-			} else {
-				m.statusText = fmt.Sprintf("Encoding %d frames...", len(m.recFrames))
-				return m, m.saveVideo(m.recFrames)
+			if m.rec != nil {
+				m.statusText = "Saving recording..."
+				return m, m.stopRecording()
+			}
+			path, err := recordingPath(m.cfg.Output, m.recFormat, m.captureInfo())
+			if err == nil {
+				m.rec, err = startRecording(path, m.recFormat, m.cfg.Recording)
+				captureNames.release(strings.TrimSuffix(path, m.recFormat.extension()))
 			}
+			if err == nil {
+				var size image.Point
+				if m.currentFrame != nil { size = m.currentFrame.Bounds().Size() }
+				meta := newCaptureMeta("recording", m.captureInfo(), size)
+				meta.Format = m.recFormat.configName()
+				meta.Columns, meta.Rows, meta.Ramp = m.width, m.height-4, modeRamp(m.mode)
+				m.rec.meta = meta
+				m.rec.hooks, m.rec.report = m.cfg.Hooks, m.hookReport()
+			}
+			if err != nil {
+				m.statusText = "Can't record: " + err.Error()
+				return m, nil
+			}
+			m.statusText = "Recording " + m.recFormat.String() + "..."
+			
+		case key.Matches(msg, m.keys.RecFormat):
+			// Takes effect from the next recording.
+			m.recFormat = recordingFormats[(int(m.recFormat)+1)%len(recordingFormats)]
+			m.statusText = "Recording format: " + m.recFormat.String()
 			
 		case key.Matches(msg, m.keys.Snap):
 			return m, m.savePhoto()
 			
+		case key.Matches(msg, m.keys.Copy):
+			return m.copyFrame(false)
+			
+		case key.Matches(msg, m.keys.CopyANSI):
+			return m.copyFrame(true)
+			
 		case key.Matches(msg, m.keys.Mode):
 			m.mode = (m.mode + 1) % 4
 			
 		case key.Matches(msg, m.keys.Filter):
 			m.filter = (m.filter + 1) % 7
+			
+		case key.Matches(msg, m.keys.Format):
+			if m.activeID == "" {
+				m.statusText = "Format selection needs a local camera"
+				return m, nil
+			}
+			return m, queryModesCmd(m.activeID)
+			
+		case key.Matches(msg, m.keys.Devices):
+			items, payload := devicePickerItems(m.devices)
+			m.picker = newPicker(pickerDevice, "Devices", items, payload, m.currentDev)
+			m.picker.hint = "r rescan"
+			// Show what we have right away, refresh when the scan is back.
+			return m, rescanDevicesCmd(m.cfg)
+		
+		case key.Matches(msg, m.keys.Gallery):
+			dir, err := captureDir(m.cfg.Output)
+			if err == nil {
+				m.gallery, err = newGallery(dir)
+			}
+			if err != nil {
+				m.gallery = nil
+				m.statusText = "Can't open gallery: " + err.Error()
+				return m, nil
+			}
+			return m, m.gallery.loadPreview()
 		
 		case key.Matches(msg, m.keys.Help):
 			m.showHelp = !m.showHelp
 			
+		case key.Matches(msg, m.keys.Retry):
+			if m.err == nil {
+				return m, nil
+			}
+			return m.retry()
+			
 		case key.Matches(msg, m.keys.Switch):
-			if len(m.devices) > 1 {
-				m.currentDev = (m.currentDev + 1) % len(m.devices)
-				dev := m.devices[m.currentDev]
-				
-				m.statusText = "Switching to " + dev.Label
-				return m, switchCameraCmd(dev.DeviceID)
-			} else {
+			switch {
+			case len(m.devices) == 0:
+				m.statusText = "No cameras found"
+				return m, nil
+			case len(m.devices) == 1 && m.currentDev == 0:
 				m.statusText = "No other cameras found"
 				return m, nil
 			}
+			return m.switchTo((m.currentDev + 1) % len(m.devices))
+		}
+	}
+	return m, nil
+}
+
+// stopRecording closes the recording; the command reports when it's saved.
+func (m *model) stopRecording() tea.Cmd {
+	cmd := m.rec.stop()
+	m.rec = nil
+	return cmd
+}
+
+// closeSource stops the current stream and orphans its read loop.
+func (m *model) closeSource() {
+	if m.stream != nil {
+		for _, t := range m.stream.GetTracks() { t.Close() }
+	}
+	if m.reader != nil {
+		closeReader(m.reader)
+	}
+	m.stream = nil
+	m.reader = nil
+	m.readerGen++
+}
+
+// switchTo opens m.devices[i].
+func (m model) switchTo(i int) (tea.Model, tea.Cmd) {
+	dev := m.devices[i]
+	m.currentDev = i
+	m.reconnects = 0
+	m.statusText = "Switching to " + dev.title()
+	if dev.kind == sourceCamera && dev.key() == m.activeKey {
+		// Reopening the device we're on, release it first.
+		m.closeSource()
+	}
+	return m, dev.openCmd(m.cfg.Camera)
+}
+
+// setDevices replaces the source list after a scan and re-finds the open
+// source in it by key, since device IDs change between scans.
+func (m *model) setDevices(devices []videoSource) {
+	m.devices = devices
+	m.currentDev = findSource(devices, m.activeKey)
+	if m.currentDev >= 0 && devices[m.currentDev].kind == sourceCamera {
+		m.activeID = devices[m.currentDev].id
+	}
+	if m.picker != nil && m.picker.kind == pickerDevice {
+		items, payload := devicePickerItems(devices)
+		m.picker.setItems(items, payload, m.currentDev)
+	}
+}
+
+// canReconnect reports whether the open source is a camera we can reopen,
+// as opposed to a file or pipe that's simply done.
+func (m model) canReconnect() bool {
+	if m.session != nil {
+		return false // the server does the reconnecting
+	}
+	return m.activeKey != "" || m.input == ""
+}
+
+// captureInfo describes a capture taken now, for naming its files.
+func (m model) captureInfo() captureInfo {
+	return captureInfo{at: time.Now(), mode: m.mode, filter: m.filter, device: m.sourceName()}
+}
+
+// hookReport is where results of this viewer's hooks go, so they show up
+// for whoever took the capture.
+func (m model) hookReport() func(hookResult) {
+	if m.session != nil && m.session.send != nil {
+		send := m.session.send
+		return func(res hookResult) { send(hookResultMsg(res)) }
+	}
+	return captureHooks.report
+}
+
+func (m model) sourceName() string {
+	if m.sourceLabel != "" {
+		return m.sourceLabel
+	}
+	return "camera"
+}
+
+// readFailed handles an error from the read loop: transient ones start
+// reconnecting, the rest go to the error screen. Recording carries on
+// either way; it just gets no frames until the camera is back.
+func (m model) readFailed(err error) (tea.Model, tea.Cmd) {
+	m.closeSource()
+	if !m.canReconnect() {
+		return m.Update(errorMsg(err))
+	}
+	return m.retryLater(err)
+}
+
+// retryLater schedules the next reconnect attempt, or gives up.
+func (m model) retryLater(err error) (tea.Model, tea.Cmd) {
+	if isFatalReadError(err) || m.reconnects >= maxReconnectAttempts {
+		m.reconnects = 0
+		return m.Update(errorMsg(err))
+	}
+	m.reconnects++
+	m.statusText = fmt.Sprintf("Reconnecting to %s (attempt %d/%d)...", m.sourceName(), m.reconnects, maxReconnectAttempts)
+	return m, reconnectTickCmd(m.reconnects, m.readerGen)
+}
+
+// retry is the error screen's way out: try the same source again, right now.
+func (m model) retry() (tea.Model, tea.Cmd) {
+	if !m.canReconnect() {
+		if m.input == "-" {
+			m.statusText = "Can't reopen stdin"
+			return m, nil
+		}
+		m.err = nil
+		m.statusText = "Reopening " + m.input
+		return m, openInputCmd(m.input, m.inputOpts)
+	}
+	m.closeSource()
+	m.err = nil
+	m.reconnects = 1
+	m.statusText = "Reconnecting to " + m.sourceName() + "..."
+	return m, reconnectCmd(m.cfg, m.activeKey, m.sourceName(), m.readerGen)
+}
+
+func (m model) updatePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.picker.kind == pickerDevice && msg.String() == "r" {
+		m.statusText = "Scanning for devices..."
+		return m, rescanDevicesCmd(m.cfg)
+	}
+	done, chosen := m.picker.update(msg)
+	if !done {
+		return m, nil
+	}
+	p := m.picker
+	m.picker = nil
+	if chosen < 0 {
+		return m, nil
+	}
+
+	switch p.kind {
+	case pickerCameraMode:
+		// Same device, so it has to be released before it can reopen.
+		m.closeSource()
+		m.reconnects = 0
+		m.cfg.Camera = m.cfg.Camera.withMode(p.payload[chosen].(prop.Video))
+		m.statusText = "Switching to " + p.items[chosen]
+		return m, switchCameraCmd(m.activeID, m.cfg.Camera)
+		
+	case pickerDevice:
+		if chosen == m.currentDev && m.reader != nil {
+			return m, nil
+		}
+		return m.switchTo(chosen)
+		
+	case pickerExport:
+		if e, ok := m.gallery.selected(); ok {
+			m.statusText = "Exporting " + e.name() + " as " + p.items[chosen] + "..."
+			return m, exportCaptureCmd(e, p.payload[chosen], m.cfg)
 		}
 	}
 	return m, nil
 }
 
+func (m model) updateGallery(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	g := m.gallery
+	if g.prompt == promptNone {
+		switch {
+		case key.Matches(msg, m.keys.Mode):
+			// Previews follow the view mode, so this is how to try them out.
+			m.mode = (m.mode + 1) % 4
+			return m, nil
+		case key.Matches(msg, galleryKeys.Export):
+			e, ok := g.selected()
+			if !ok {
+				return m, nil
+			}
+			items, payload := exportTargets(e)
+			if len(items) == 0 {
+				m.statusText = "Can't export " + e.name() + ": only GIFs and photos with an original frame can be"
+				return m, nil
+			}
+			m.picker = newPicker(pickerExport, "Export as", items, payload, -1)
+			return m, nil
+		}
+	}
+	done, cmd, status := g.update(msg)
+	if done {
+		g.close()
+		m.gallery = nil
+	}
+	if status != "" {
+		m.statusText = status
+	}
+	return m, cmd
+}
+
 func (m model) View() string {
+	return m.clipboard + m.view()
+}
+
+func (m model) view() string {
+	if m.gallery != nil {
+		return m.galleryView()
+	}
+	if m.picker != nil && (m.err != nil || m.currentFrame == nil) {
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, m.picker.view(m.height))
+	}
+	
 	if m.err != nil {
-		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, errorStyle.Render(m.err.Error()))
+		hint := statusStyle.Render(m.keys.errorHint())
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center,
+			lipgloss.JoinVertical(lipgloss.Center, errorStyle.Render(m.err.Error()), "", hint))
 	}
 	
 	if m.currentFrame == nil {
@@ -809,33 +1116,40 @@ func (m model) View() string {
 	h := m.height - 4
 	if h < 1 { h = 1 }
 
-	switch m.mode {
-	case ModeColor:
-		art = imageToANSI(filtered, m.width, h)
-	case ModeDetailed:
-		art = imageToAscii(filtered, m.width, h, asciiDetailed, true)
-	case ModeStructure:
-		art = imageToStructureAscii(filtered, m.width, h, true)
+	switch {
+	case m.picker != nil:
+		art = lipgloss.Place(m.width, h, lipgloss.Center, lipgloss.Center, m.picker.view(h))
 	default:
-		art = imageToAscii(filtered, m.width, h, asciiStandard, true)
+		art = renderArt(filtered, m.mode, m.width, h, true)
 	}
 	
-	// UI Layout
+	// UI Layout (a copy of the style, ssh-serve sessions render side by side)
+	style := titleStyle.Foreground(lipgloss.Color("#D4AF37"))
 	title := "ATLAS CAM"
-	if m.recording {
-		title += fmt.Sprintf(" [REC %ds]", int(time.Since(m.recStart).Seconds()))
-		titleStyle = titleStyle.Foreground(lipgloss.Color("#FF0000"))
-	} else {
-		titleStyle = titleStyle.Foreground(lipgloss.Color("#D4AF37"))
+	if m.rec != nil {
+		title += fmt.Sprintf(" [REC %ds", int(time.Since(m.rec.start).Seconds()))
+		if fps := m.rec.fps(); fps > 0 {
+			title += fmt.Sprintf(" @ %.1ffps", fps)
+		}
+		title += "]"
+		style = style.Foreground(lipgloss.Color("#FF0000"))
 	}
 	
-	header := titleStyle.Render(title)
+	header := style.Render(title)
 	
 	var footer string
 	if m.showHelp {
 		footer = m.help.View(m.keys)
 	} else {
-		footer = statusStyle.Render(fmt.Sprintf("%s | %s | %s | Press '?' for help", m.mode, m.filter, m.statusText))
+		parts := []string{m.mode.String(), m.filter.String()}
+		if m.format != "" {
+			parts = append(parts, m.format)
+		}
+		if m.rec != nil {
+			parts = append(parts, "● "+formatSize(m.rec.size()))
+		}
+		parts = append(parts, m.statusText, "Press '?' for help")
+		footer = statusStyle.Render(strings.Join(parts, " | "))
 	}
 	
 	return lipgloss.JoinVertical(lipgloss.Center,
@@ -847,22 +1161,150 @@ func (m model) View() string {
 
 var Version = "dev"
 
+func usage() {
+	fmt.Println("Atlas Cam - Terminal webcam viewer and ASCII camera.")
+	fmt.Println("\nUsage:")
+	fmt.Println("  atlas.cam                Start the camera viewer")
+	fmt.Println("  atlas.cam --input FILE   View a .y4m or MJPEG file ('-' reads stdin)")
+	fmt.Println("  atlas.cam --input URL    View an HTTP MJPEG network camera")
+	fmt.Println("  atlas.cam --input pattern:NAME[+counter]")
+	fmt.Println("                           Generated test pattern: " + strings.Join(patternNames(), ", "))
+	fmt.Println("  atlas.cam convert FILE   Render an image, or re-render a capture from its")
+	fmt.Println("                           .json sidecar (--mode, --filter, --columns, --out).")
+	fmt.Println("                           Sidecars of color photos start from their JPEG;")
+	fmt.Println("                           other modes need photos saved with save_raw")
+	fmt.Println("  atlas.cam serve          Stream the feed over HTTP to curl or a browser")
+	fmt.Println("                           (--listen ADDR, default localhost:8080)")
+	fmt.Println("  atlas.cam ssh-serve      Run the viewer over SSH for the keys in authorized_keys")
+	fmt.Println("                           (--listen ADDR, default :2222; --host-key PATH,")
+	fmt.Println("                           --authorized-keys PATH, --access view|control)")
+	fmt.Println("  atlas.cam -v             Show version")
+	fmt.Println("  atlas.cam -h             Show this help")
+	fmt.Println("\nOptions:")
+	fmt.Println("  --config PATH   Config file (default: " + defaultConfigPath() + ")")
+	fmt.Println("  --width N       Requested camera width")
+	fmt.Println("  --height N      Requested camera height")
+	fmt.Println("  --fps N         Requested camera frame rate, or playback rate for")
+	fmt.Println("                  MJPEG and pattern input (default 30)")
+	fmt.Println("  --format NAME   Requested camera pixel format (MJPEG, YUYV, I420, ...)")
+	fmt.Println("  --device NAME   Camera to open, matched against its label, name or URL")
+	fmt.Println("  --fast          Decode input as fast as possible, ignoring the frame rate")
+	fmt.Println("  --loop          Restart file input at EOF instead of exiting")
+	fmt.Println("\nExample:")
+	fmt.Println("  ffmpeg -i clip.mp4 -f yuv4mpegpipe - | atlas.cam --input -")
+}
+
+// sourceFlags pick what to show and how, for the viewer and the servers.
+type sourceFlags struct {
+	configPath string
+	input      string
+	opts       inputOptions
+	camera     CameraConfig
+}
+
+func (f *sourceFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.configPath, "config", defaultConfigPath(), "")
+	fs.StringVar(&f.input, "input", "", "")
+	fs.IntVar(&f.camera.Width, "width", 0, "")
+	fs.IntVar(&f.camera.Height, "height", 0, "")
+	fs.Float64Var(&f.opts.fps, "fps", 0, "")
+	fs.StringVar(&f.camera.Format, "format", "", "")
+	fs.StringVar(&f.camera.Device, "device", "", "")
+	fs.BoolVar(&f.opts.fast, "fast", false, "")
+	fs.BoolVar(&f.opts.loop, "loop", false, "")
+}
+
+// load reads the config with the flags applied on top, and checks it.
+func (f *sourceFlags) load() (Config, error) {
+	cfg, err := loadConfig(f.configPath)
+	if err != nil {
+		return cfg, err
+	}
+
+	// Flags win over the config file.
+	f.camera.FrameRate = f.opts.fps
+	cfg.Camera = cfg.Camera.merge(f.camera)
+	if cfg.Camera.Format != "" {
+		if _, err := parseFrameFormat(cfg.Camera.Format); err != nil {
+			return cfg, err
+		}
+	}
+	if _, err := parseRecordingFormat(cfg.Recording.Format); err != nil {
+		return cfg, err
+	}
+	if _, err := parseANSIColors(cfg.Snapshot.ANSIColors); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Render.validate(); err != nil {
+		return cfg, err
+	}
+	for _, tmpl := range []string{cfg.Output.PhotoName, cfg.Output.ClipName} {
+		if err := checkNameTemplate(tmpl); err != nil {
+			return cfg, err
+		}
+	}
+	for _, h := range cfg.Hooks {
+		if err := h.validate(); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
 func main() {
-	if len(os.Args) > 1 && (os.Args[1] == "-v" || os.Args[1] == "--version") {
-		fmt.Printf("atlas.cam v%s\n", Version)
+	if len(os.Args) > 1 && os.Args[1] == "help" {
+		usage()
+		return
+	}
+	subcommands := map[string]func([]string) error{
+		"convert":   runConvert,
+		"serve":     runServe,
+		"ssh-serve": runSSHServe,
+	}
+	if len(os.Args) > 1 && subcommands[os.Args[1]] != nil {
+		// -h has already printed the usage, which is all it asks for.
+		if err := subcommands[os.Args[1]](os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 		return
 	}
-	if len(os.Args) > 1 && (os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help") {
-		fmt.Println("Atlas Cam - Terminal webcam viewer and ASCII camera.")
-		fmt.Println("\nUsage:")
-		fmt.Println("  atlas.cam        Start the camera viewer")
-		fmt.Println("  atlas.cam -v     Show version")
-		fmt.Println("  atlas.cam -h     Show this help")
+
+	var (
+		showVersion bool
+		src         sourceFlags
+	)
+	flag.Usage = usage
+	flag.BoolVar(&showVersion, "v", false, "")
+	flag.BoolVar(&showVersion, "version", false, "")
+	src.register(flag.CommandLine)
+	flag.Parse()
+
+	if showVersion {
+		fmt.Printf("atlas.cam v%s\n", Version)
 		return
 	}
 
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	cfg, err := src.load()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	input, opts := src.input, src.opts
+
+	teaOpts := []tea.ProgramOption{tea.WithAltScreen()}
+	if input == "-" {
+		// stdin carries video, so keyboard input has to come from the tty
+		teaOpts = append(teaOpts, tea.WithInputTTY())
+	}
+
+	p := tea.NewProgram(initialModel(cfg, input, opts), teaOpts...)
+	_, err = p.Run()
+	if n := captureHooks.pending.Load(); n > 0 {
+		fmt.Printf("Waiting for %d hook(s) to finish...\n", n)
+	}
+	captureHooks.wait()
+	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// --- Fakes & Helpers ---
+
+// fakeReader is a deterministic VideoReader: frame n is pattern frame n at
+// a small size, so golden files stay tiny.
+type fakeReader struct {
+	draw          patternFunc
+	width, height int
+	n             int
+	closed        bool
+}
+
+func newFakeReader(draw patternFunc) *fakeReader {
+	return &fakeReader{draw: draw, width: 64, height: 48}
+}
+
+func (r *fakeReader) Read() (image.Image, func(), error) {
+	img := image.NewRGBA(image.Rect(0, 0, r.width, r.height))
+	r.draw(img, r.n)
+	r.n++
+	return img, func() {}, nil
+}
+
+func (r *fakeReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func readFrame(t *testing.T, r VideoReader) image.Image {
+	t.Helper()
+	img, release, err := r.Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	release()
+	return img
+}
+
+func goldenPath(name string) string {
+	return filepath.Join("testdata", "golden", name)
+}
+
+// checkGolden compares got against testdata/golden/name byte for byte.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := goldenPath(name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	if utf8.Valid(got) && utf8.Valid(want) {
+		t.Errorf("%s: output differs from golden file (run go test -update to accept)\ngot:\n%s\nwant:\n%s", name, got, want)
+	} else {
+		t.Errorf("%s: output differs from golden file (run go test -update to accept), %d bytes vs %d", name, len(got), len(want))
+	}
+}
+
+// checkGoldenImage compares pixels rather than encoded bytes, so a change
+// in the PNG compressor doesn't fail the suite.
+func checkGoldenImage(t *testing.T, name string, got image.Image) {
+	t.Helper()
+	path := goldenPath(name)
+	if *update {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, got); err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, name, buf.Bytes())
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	defer f.Close()
+	want, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sameImage(got, want); err != nil {
+		t.Errorf("%s: %v (run go test -update to accept)", name, err)
+	}
+}
+
+func sameImage(got, want image.Image) error {
+	if got.Bounds() != want.Bounds() {
+		return fmt.Errorf("bounds %v, want %v", got.Bounds(), want.Bounds())
+	}
+	b := got.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !sameColor(got.At(x, y), want.At(x, y)) {
+				return fmt.Errorf("pixel (%d,%d) = %v, want %v", x, y, got.At(x, y), want.At(x, y))
+			}
+		}
+	}
+	return nil
+}
+
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+// --- Renderers ---
+
+func TestRenderersGolden(t *testing.T) {
+	sources := map[string]patternFunc{
+		"bars":      drawColorBars,
+		"zoneplate": drawZonePlate,
+		"ball":      drawBall,
+	}
+
+	for name, draw := range sources {
+		frame := readFrame(t, newFakeReader(draw))
+		t.Run(name, func(t *testing.T) {
+			checkGolden(t, "ascii_"+name+".txt", []byte(imageToAscii(frame, 40, 20, asciiStandard, true)))
+			checkGolden(t, "detailed_"+name+".txt", []byte(imageToAscii(frame, 40, 20, asciiDetailed, false)))
+			checkGolden(t, "ansi_"+name+".txt", []byte(imageToANSI(frame, 40, 20)))
+			checkGolden(t, "structure_"+name+".txt", []byte(imageToStructureAscii(frame, 40, 20, true)))
+		})
+	}
+}
+
+func TestRenderersEmptySize(t *testing.T) {
+	frame := readFrame(t, newFakeReader(drawColorBars))
+	if s := imageToAscii(frame, 0, 10, asciiStandard, true); s != "" {
+		t.Errorf("imageToAscii with zero width = %q, want empty", s)
+	}
+	if s := imageToANSI(frame, 10, 0); s != "" {
+		t.Errorf("imageToANSI with zero height = %q, want empty", s)
+	}
+	if s := imageToStructureAscii(frame, -1, -1, false); s != "" {
+		t.Errorf("imageToStructureAscii with negative size = %q, want empty", s)
+	}
+}
+
+// --- Filters ---
+
+func TestFiltersGolden(t *testing.T) {
+	frame := readFrame(t, newFakeReader(drawGradient))
+	for f := FilterNone; f <= FilterBlue; f++ {
+		t.Run(f.String(), func(t *testing.T) {
+			checkGoldenImage(t, fmt.Sprintf("filter_%d.png", int(f)), applyFilter(frame, f))
+		})
+	}
+}
+
+func TestFilterNoneIsIdentity(t *testing.T) {
+	frame := readFrame(t, newFakeReader(drawColorBars))
+	if applyFilter(frame, FilterNone) != frame {
+		t.Error("FilterNone should return the input image untouched")
+	}
+}
+
+// --- Exports ---
+
+func TestTextToImageGolden(t *testing.T) {
+	frame := readFrame(t, newFakeReader(drawBall))
+	txt := imageToAscii(frame, 24, 12, asciiStandard, false)
+	checkGoldenImage(t, "text_to_image.png", textToImage(txt))
+}
+
+func TestRecorderGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.gif")
+	rec, err := startRecording(path, recordGIF, RecordingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newFakeReader(drawBall)
+	start := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		at := start.Add(time.Duration(i) * 40 * time.Millisecond)
+		rec.add(recFrame{img: readFrame(t, r), at: at, mode: ModeColor, filter: FilterSepia})
+	}
+	msg, ok := rec.stop()().(statusMsg)
+	if !ok || !strings.HasPrefix(string(msg), "Saved GIF: clip.gif") {
+		t.Fatalf("stop returned %#v", msg)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "clip.gif", data)
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 5 || rec.added != 5 {
+		t.Errorf("GIF has %d frames (%d queued), want 5", len(g.Image), rec.added)
+	}
+	if got := rec.size(); got != int64(len(data)) {
+		t.Errorf("size() = %d, file is %d bytes", got, len(data))
+	}
+}
+
+func TestRecorderNoFrames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.gif")
+	rec, err := startRecording(path, recordGIF, RecordingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := rec.stop()(); msg != statusMsg("Nothing recorded") {
+		t.Errorf("stop returned %#v", msg)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("empty recording left a file behind")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --- Capture Metadata ---
+//
+// Every capture gets a JSON sidecar (same base name, .json) recording how it
+// was made: mode, filter, device, resolutions, the character ramp, times and
+// the app version. JPEGs also carry the key fields in a COM segment, so a
+// photo that loses its sidecar still says where it came from. `atlas.cam
+// convert` reads sidecars back to re-render a capture.
+
+const edgeRamp = " .:-|/\\"
+
+type captureMeta struct {
+	App     string `json:"app"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"` // photo or recording
+	Mode    string `json:"mode"`
+	Filter  string `json:"filter"`
+	Device  string `json:"device"`
+	// The camera frame's resolution.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// The text grid and the characters it was drawn with.
+	Columns int    `json:"columns,omitempty"`
+	Rows    int    `json:"rows,omitempty"`
+	Ramp    string `json:"ramp,omitempty"`
+
+	Started time.Time  `json:"started"`
+	Ended   *time.Time `json:"ended,omitempty"`
+	Frames  int        `json:"frames,omitempty"`
+	Format  string     `json:"format,omitempty"`
+	Files   []string   `json:"files"`
+
+	// A file holding the frame before rendering, which convert starts
+	// from. OriginalFiltered means the filter is already applied.
+	Original         string `json:"original,omitempty"`
+	OriginalFiltered bool   `json:"original_filtered,omitempty"`
+}
+
+func newCaptureMeta(kind string, info captureInfo, size image.Point) *captureMeta {
+	return &captureMeta{
+		App:     "atlas.cam",
+		Version: Version,
+		Kind:    kind,
+		Mode:    modeSlug(info.mode),
+		Filter:  filterSlug(info.filter),
+		Device:  info.device,
+		Width:   size.X,
+		Height:  size.Y,
+		Started: info.at,
+	}
+}
+
+// setArt records the text grid of a render in mode.
+func (c *captureMeta) setArt(mode Mode, art string) {
+	art = strings.TrimSuffix(art, "\n")
+	c.Columns = lipgloss.Width(art)
+	c.Rows = strings.Count(art, "\n") + 1
+	c.Ramp = modeRamp(mode)
+}
+
+func modeRamp(m Mode) string {
+	switch m {
+	case ModeDetailed:
+		return asciiDetailed
+	case ModeColor:
+		return asciiBlock
+	case ModeStructure:
+		return edgeRamp
+	default:
+		return asciiStandard
+	}
+}
+
+// comment is the one-line summary embedded in JPEGs.
+func (c *captureMeta) comment() string {
+	return fmt.Sprintf("%s %s; mode=%s; filter=%s; device=%s; camera=%dx%d; taken=%s",
+		c.App, c.Version, c.Mode, c.Filter, c.Device, c.Width, c.Height, c.Started.Format(time.RFC3339))
+}
+
+func (c *captureMeta) write(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func readCaptureMeta(path string) (*captureMeta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c captureMeta
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+func filterSlug(f Filter) string {
+	return fileSafe(strings.ToLower(f.String()))
+}
+
+func parseMode(s string) (Mode, error) {
+	for m := ModeASCII; m <= ModeStructure; m++ {
+		if strings.EqualFold(s, modeSlug(m)) {
+			return m, nil
+		}
+	}
+	return ModeASCII, fmt.Errorf("unknown mode %q (have: ascii, detailed, color, structure)", s)
+}
+
+func parseFilter(s string) (Filter, error) {
+	var names []string
+	for f := FilterNone; f <= FilterBlue; f++ {
+		if strings.EqualFold(s, filterSlug(f)) {
+			return f, nil
+		}
+		names = append(names, filterSlug(f))
+	}
+	return FilterNone, fmt.Errorf("unknown filter %q (have: %s)", s, strings.Join(names, ", "))
+}
+
+// --- JPEG Comments ---
+
+// jpegWithComment inserts a COM segment right after the SOI marker.
+func jpegWithComment(data []byte, comment string) []byte {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return data
+	}
+	if len(comment) > 0xffff-2 {
+		comment = comment[:0xffff-2]
+	}
+	seg := []byte{0xff, 0xfe, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(comment)+2))
+	seg = append(seg, comment...)
+
+	out := make([]byte, 0, len(data)+len(seg))
+	out = append(out, data[:2]...)
+	out = append(out, seg...)
+	return append(out, data[2:]...)
+}
+
+// jpegComment returns the first COM segment's text, if any.
+func jpegComment(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return "", false
+	}
+	for p := 2; p+4 <= len(data) && data[p] == 0xff; {
+		marker := data[p+1]
+		n := int(binary.BigEndian.Uint16(data[p+2:]))
+		if marker == 0xda || p+2+n > len(data) || n < 2 {
+			break // image data from here on
+		}
+		if marker == 0xfe {
+			return string(data[p+4 : p+2+n]), true
+		}
+		p += 2 + n
+	}
+	return "", false
+}
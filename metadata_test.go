@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJPEGComment(t *testing.T) {
+	frame := readFrame(t, newFakeReader(drawColorBars))
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, frame, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := jpegWithComment(buf.Bytes(), "atlas.cam dev; mode=ascii")
+
+	if got, ok := jpegComment(data); !ok || got != "atlas.cam dev; mode=ascii" {
+		t.Errorf("jpegComment = %q, %v", got, ok)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("JPEG with comment doesn't decode: %v", err)
+	}
+	if _, ok := jpegComment(buf.Bytes()); ok {
+		t.Error("found a comment in a plain JPEG")
+	}
+}
+
+func TestSnapshotSidecar(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "snap")
+	cfg := defaultConfig()
+	cfg.Render.Columns, cfg.Render.Width = 40, 320
+	cfg.Snapshot.ANSI, cfg.Snapshot.HTML, cfg.Snapshot.SVG = true, true, true
+	snap := snapshot{
+		frame:  readFrame(t, newFakeReader(drawBall)),
+		mode:   ModeStructure,
+		filter: FilterSepia,
+		info:   testCapture,
+	}
+	saved, err := writeSnapshot(base, snap, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ".jpg .txt .ans .html .svg .json"; strings.Join(saved, " ") != want {
+		t.Errorf("saved %v, want %s", saved, want)
+	}
+
+	meta, err := readCaptureMeta(base + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := snap.frame.Bounds()
+	if meta.Kind != "photo" || meta.Mode != "structure" || meta.Filter != "sepia" || meta.Device != testCapture.device {
+		t.Errorf("settings = %s/%s/%s/%q", meta.Kind, meta.Mode, meta.Filter, meta.Device)
+	}
+	if meta.Width != b.Dx() || meta.Height != b.Dy() || meta.Columns != 40 || meta.Ramp != edgeRamp {
+		t.Errorf("sizes = %dx%d, %d columns, ramp %q", meta.Width, meta.Height, meta.Columns, meta.Ramp)
+	}
+	if meta.Version != Version || !meta.Started.Equal(testCapture.at) || len(meta.Files) != 5 {
+		t.Errorf("version %q, started %v, files %v", meta.Version, meta.Started, meta.Files)
+	}
+	if meta.Original != "" {
+		t.Errorf("text render has original %q", meta.Original)
+	}
+
+	data, _ := os.ReadFile(base + ".jpg")
+	comment, _ := jpegComment(data)
+	if !strings.Contains(comment, "mode=structure; filter=sepia") {
+		t.Errorf("JPEG comment = %q", comment)
+	}
+}
+
+func TestSnapshotExtrasAreOptIn(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Render.Columns, cfg.Render.Width = 40, 320
+	snap := snapshot{frame: readFrame(t, newFakeReader(drawBall)), mode: ModeASCII, info: testCapture}
+	saved, err := writeSnapshot(filepath.Join(t.TempDir(), "snap"), snap, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ".jpg .txt .json"; strings.Join(saved, " ") != want {
+		t.Errorf("saved %v by default, want %s", saved, want)
+	}
+}
+
+func TestColorSnapshotIsDrawnInColor(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "snap")
+	cfg := defaultConfig()
+	cfg.Render.Columns, cfg.Render.Width = 14, 700
+	frame := readFrame(t, newFakeReader(drawColorBars))
+	saved, err := writeSnapshot(base, snapshot{frame: frame, mode: ModeColor, info: testCapture}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ".jpg .frame.jpg .json"; strings.Join(saved, " ") != want {
+		t.Errorf("saved %v, want %s", saved, want)
+	}
+
+	f, err := os.Open(base + ".jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo, err := jpeg.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb := photo.Bounds()
+	if pb.Dx() != 700 {
+		t.Errorf("photo is %dpx wide, want 700", pb.Dx())
+	}
+	// Each cell is the color its block was given, give or take JPEG.
+	art := renderArt(frame, ModeColor, 14, 56, false)
+	lines := styledLines(art)
+	y := pb.Dy() * 3 / (2 * len(lines)) // the middle of the second row
+	col := 0
+	for _, run := range lines[1] {
+		for range run.text {
+			x := (2*col + 1) * pb.Dx() / 28
+			if got := photo.At(x, y); run.fg == nil || !nearColor(got, *run.fg, 24) {
+				t.Errorf("column %d is %v, want %v", col, got, run.fg)
+			}
+			col++
+		}
+	}
+	if got := photo.At(5*pb.Dx()/28, y); !nearColor(got, color.RGBA{192, 192, 0, 255}, 24) {
+		t.Errorf("the yellow bar is %v", got)
+	}
+
+	meta, err := readCaptureMeta(base + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Original != "snap.frame.jpg" || meta.OriginalFiltered {
+		t.Errorf("original = %q (filtered %v)", meta.Original, meta.OriginalFiltered)
+	}
+}
+
+// nearColor reports whether each channel of a and b is within tol.
+func nearColor(a, b color.Color, tol int) bool {
+	ar, ag, ab, _ := a.RGBA()
+	br, bg, bb, _ := b.RGBA()
+	for _, d := range []int{int(ar>>8) - int(br>>8), int(ag>>8) - int(bg>>8), int(ab>>8) - int(bb>>8)} {
+		if d < -tol || d > tol {
+			return false
+		}
+	}
+	return true
+}
+
+func TestConvertFromSidecar(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	cfg := defaultConfig()
+	cfg.Render.Columns = 40
+
+	// A color snapshot keeps the frame, so it can be re-rendered.
+	base := filepath.Join(dir, "snap")
+	snap := snapshot{frame: readFrame(t, newFakeReader(drawBall)), mode: ModeColor, filter: FilterInvert, info: testCapture}
+	if _, err := writeSnapshot(base, snap, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := runConvert([]string{"--config", "", "--mode", "detailed", base + ".json"}); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := readCaptureMeta(filepath.Join(dir, "snap_detailed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The filter and the column count carry over.
+	if meta.Mode != "detailed" || meta.Filter != "invert" || meta.Columns != 40 || meta.Device != testCapture.device {
+		t.Errorf("converted = %s/%s, %d columns, device %q", meta.Mode, meta.Filter, meta.Columns, meta.Device)
+	}
+	txt, _ := os.ReadFile(filepath.Join(dir, "snap_detailed.txt"))
+	if len(txt) == 0 {
+		t.Error("no text written")
+	}
+
+	// Its own sidecar has nothing to start from.
+	err = runConvert([]string{"--config", "", filepath.Join(dir, "snap_detailed.json")})
+	if err == nil || !strings.Contains(err.Error(), "save_raw") {
+		t.Errorf("converting a capture with no original: %v", err)
+	}
+}
+
+func TestConvertImage(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "frame.png")
+	f, _ := os.Create(src)
+	png.Encode(f, readFrame(t, newFakeReader(drawColorBars)))
+	f.Close()
+
+	out := filepath.Join(dir, "out")
+	// Flags go before or after the file.
+	if err := runConvert([]string{"--config", "", "--filter", "grayscale", src, "--columns", "20", "--out", out}); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := readCaptureMeta(filepath.Join(out, "frame_ascii.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Mode != "ascii" || meta.Filter != "grayscale" || meta.Columns != 20 {
+		t.Errorf("converted = %s/%s, %d columns", meta.Mode, meta.Filter, meta.Columns)
+	}
+	if err := runConvert([]string{"--config", "", "--mode", "braille", src}); err == nil {
+		t.Error("convert accepted an unknown mode")
+	}
+	if err := runConvert([]string{"--config", "", src, src}); err == nil {
+		t.Error("convert took two files")
+	}
+}
+
+func TestRecordingSidecar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.cast")
+	rec, err := startRecording(path, recordAsciicast, RecordingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.meta = newCaptureMeta("recording", testCapture, readFrame(t, newFakeReader(drawBall)).Bounds().Size())
+	r := newFakeReader(drawBall)
+	for i := 0; i < 3; i++ {
+		rec.add(recFrame{img: readFrame(t, r), at: time.Unix(int64(i), 0), mode: ModeASCII, width: 40, height: 16})
+	}
+	rec.stop()()
+
+	meta, err := readCaptureMeta(filepath.Join(filepath.Dir(path), "clip.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Frames != 3 || meta.Ended == nil || !meta.Ended.Equal(time.Unix(2, 0)) || meta.Files[0] != "clip.cast" {
+		t.Errorf("sidecar = %d frames, ended %v, files %v", meta.Frames, meta.Ended, meta.Files)
+	}
+}
+
+func TestParseModeAndFilter(t *testing.T) {
+	for m := ModeASCII; m <= ModeStructure; m++ {
+		if got, err := parseMode(modeSlug(m)); err != nil || got != m {
+			t.Errorf("parseMode(%q) = %v, %v", modeSlug(m), got, err)
+		}
+	}
+	for f := FilterNone; f <= FilterBlue; f++ {
+		if got, err := parseFilter(filterSlug(f)); err != nil || got != f {
+			t.Errorf("parseFilter(%q) = %v, %v", filterSlug(f), got, err)
+		}
+	}
+}
+
+func TestRawFrameSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.Snapshot.SaveRaw = true
+	cfg.Render.Columns = 40
+
+	frame := readFrame(t, newFakeReader(drawBall))
+	base := filepath.Join(dir, "snap")
+	saved, err := writeSnapshot(base, snapshot{frame: frame, mode: ModeASCII, filter: FilterInvert, info: testCapture}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(saved, " "), ".raw.png") {
+		t.Fatalf("saved %v, want a .raw.png", saved)
+	}
+
+	// The PNG is the frame exactly, before the filter.
+	f, err := os.Open(base + ".raw.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sameImage(raw, frame); err != nil {
+		t.Error(err)
+	}
+
+	meta, err := readCaptureMeta(base + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Original != "snap.raw.png" || meta.OriginalFiltered {
+		t.Errorf("original = %q (filtered %v)", meta.Original, meta.OriginalFiltered)
+	}
+
+	// So an ASCII capture can come back in color, still inverted.
+	if err := runConvert([]string{"--config", "", "--mode", "color", base + ".json"}); err != nil {
+		t.Fatal(err)
+	}
+	meta, err = readCaptureMeta(filepath.Join(dir, "snap_color.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Mode != "color" || meta.Filter != "invert" {
+		t.Errorf("converted = %s/%s, want color/invert", meta.Mode, meta.Filter)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"time"
+)
+
+// --- MJPEG ---
+//
+// Motion JPEG has no real container: it's either JPEGs back to back or a
+// multipart body with boundary/header lines between them. Instead of trusting
+// boundaries we skip to the next SOI marker and walk the JPEG segments to find
+// the matching EOI, which handles both layouts (and EXIF thumbnails, whose
+// nested SOI/EOI markers sit inside a length-prefixed APP1 segment).
+
+type mjpegDecoder struct {
+	buf bytes.Buffer
+}
+
+func (d *mjpegDecoder) frameInterval() time.Duration { return 0 }
+
+func (d *mjpegDecoder) decode(br *bufio.Reader) (image.Image, error) {
+	data, err := readJPEGFrame(br, &d.buf)
+	if err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("mjpeg: %w", err)
+	}
+	return img, nil
+}
+
+// readJPEGFrame returns the bytes of the next complete JPEG in br. The
+// returned slice aliases buf and is only valid until the next call.
+func readJPEGFrame(br *bufio.Reader, buf *bytes.Buffer) ([]byte, error) {
+	buf.Reset()
+
+	// Skip to SOI. Anything before it is boundary/part headers.
+	prev := byte(0)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if prev == 0xFF && b == 0xD8 {
+			break
+		}
+		prev = b
+	}
+	buf.Write([]byte{0xFF, 0xD8})
+
+	// Header segments up to SOS carry explicit lengths.
+	for {
+		marker, err := readMarker(br)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		buf.Write([]byte{0xFF, marker})
+
+		if marker == 0xD9 {
+			return buf.Bytes(), nil
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue // standalone markers, no length
+		}
+
+		var lb [2]byte
+		if _, err := io.ReadFull(br, lb[:]); err != nil {
+			return nil, truncated(err)
+		}
+		n := int(lb[0])<<8 | int(lb[1])
+		if n < 2 {
+			return nil, fmt.Errorf("mjpeg: bad segment length %d", n)
+		}
+		buf.Write(lb[:])
+		if _, err := io.CopyN(buf, br, int64(n-2)); err != nil {
+			return nil, truncated(err)
+		}
+
+		if marker == 0xDA {
+			break
+		}
+	}
+
+	// Entropy-coded data: 0xFF is stuffed as FF 00, RSTn markers are
+	// inline, and anything else ends the scan (EOI, or another SOS in
+	// progressive JPEGs, which we just keep copying).
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, truncated(err)
+		}
+		buf.WriteByte(b)
+		if b != 0xFF {
+			continue
+		}
+
+		m, err := br.ReadByte()
+		if err != nil {
+			return nil, truncated(err)
+		}
+		for m == 0xFF { // fill bytes
+			buf.WriteByte(m)
+			if m, err = br.ReadByte(); err != nil {
+				return nil, truncated(err)
+			}
+		}
+		buf.WriteByte(m)
+		if m == 0xD9 {
+			return buf.Bytes(), nil
+		}
+	}
+}
+
+func readMarker(br *bufio.Reader) (byte, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, fmt.Errorf("mjpeg: expected marker, got 0x%02x", b)
+	}
+	for b == 0xFF {
+		if b, err = br.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
+
+// truncated turns a mid-frame EOF into an unexpected EOF, so callers can tell
+// a clean end of stream from a cut-off one.
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"testing"
+)
+
+func jpegBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMJPEGInput(t *testing.T) {
+	var stream bytes.Buffer
+	// Multipart framing with junk between parts, then two bare JPEGs.
+	for i := 0; i < 2; i++ {
+		stream.WriteString("--frame\r\nContent-Type: image/jpeg\r\n\r\n")
+		stream.Write(jpegBytes(t, 8+i, 8))
+		stream.WriteString("\r\n")
+	}
+	stream.Write(jpegBytes(t, 10, 8))
+	stream.Write(jpegBytes(t, 11, 8))
+
+	path := writeTemp(t, "clip.mjpeg", stream.Bytes())
+	r, err := openStreamInput(path, inputOptions{fast: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := 0; i < 4; i++ {
+		if w := readFrame(t, r).Bounds().Dx(); w != 8+i {
+			t.Errorf("frame %d width = %d, want %d", i, w, 8+i)
+		}
+	}
+	if _, _, err := r.Read(); !errors.Is(err, io.EOF) {
+		t.Errorf("Read at end = %v, want io.EOF", err)
+	}
+}
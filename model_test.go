@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"image/gif"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func keyPress(s string) tea.KeyMsg {
+	if s == " " {
+		return tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+// send runs msg through Update and returns the new model and command.
+func send(t *testing.T, m model, msg tea.Msg) (model, tea.Cmd) {
+	t.Helper()
+	next, cmd := m.Update(msg)
+	nm, ok := next.(model)
+	if !ok {
+		t.Fatalf("Update returned %T, want model", next)
+	}
+	return nm, cmd
+}
+
+func testModel() model {
+	m := initialModel(defaultConfig(), "", inputOptions{})
+	m.devices = nil
+	m.width, m.height = 80, 24
+	return m
+}
+
+func TestModeCycling(t *testing.T) {
+	m := testModel()
+	want := []Mode{ModeDetailed, ModeColor, ModeStructure, ModeASCII}
+	for _, w := range want {
+		m, _ = send(t, m, keyPress("m"))
+		if m.mode != w {
+			t.Fatalf("mode = %v, want %v", m.mode, w)
+		}
+	}
+}
+
+func TestFilterCycling(t *testing.T) {
+	m := testModel()
+	for i := 1; i <= 7; i++ {
+		m, _ = send(t, m, keyPress("f"))
+		if want := Filter(i % 7); m.filter != want {
+			t.Fatalf("after %d presses filter = %v, want %v", i, m.filter, want)
+		}
+	}
+}
+
+func TestHelpToggle(t *testing.T) {
+	m := testModel()
+	m, _ = send(t, m, keyPress("?"))
+	if !m.showHelp {
+		t.Fatal("help should be visible after '?'")
+	}
+	m, _ = send(t, m, keyPress("?"))
+	if m.showHelp {
+		t.Fatal("help should be hidden after second '?'")
+	}
+}
+
+func TestRecordStartStop(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	m := testModel()
+	r := newFakeReader(drawBall)
+	m.reader = r
+
+	m, cmd := send(t, m, keyPress("r"))
+	if m.rec == nil || cmd != nil {
+		t.Fatalf("rec = %v, cmd = %v after first 'r'", m.rec, cmd)
+	}
+	rec := m.rec
+
+	for i := 0; i < 3; i++ {
+		m, _ = send(t, m, frameMsg(readFrame(t, r)))
+	}
+	if rec.added != 3 {
+		t.Fatalf("queued %d frames, want 3", rec.added)
+	}
+
+	m, cmd = send(t, m, keyPress("r"))
+	if m.rec != nil {
+		t.Fatal("still recording after second 'r'")
+	}
+	if cmd == nil {
+		t.Fatal("stopping a recording should return a save command")
+	}
+	msg, ok := cmd().(statusMsg)
+	if !ok || !strings.HasPrefix(string(msg), "Saved GIF") {
+		t.Fatalf("save command returned %#v", msg)
+	}
+}
+
+func TestRecordingUsesRenderedFrames(t *testing.T) {
+	frame := readFrame(t, newFakeReader(drawColorBars))
+
+	ascii := renderRecFrame(recFrame{img: frame, mode: ModeASCII, width: 80, height: 24})
+	if ascii.Bounds() == frame.Bounds() {
+		t.Errorf("ASCII mode should record the rendered text image, got raw frame size %v", ascii.Bounds())
+	}
+
+	color := renderRecFrame(recFrame{img: frame, mode: ModeColor, width: 80, height: 24})
+	if color.Bounds() != frame.Bounds() {
+		t.Errorf("color mode should record the filtered frame, got %v", color.Bounds())
+	}
+}
+
+func TestRecordingStopsAtLimit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	m := testModel()
+	m.cfg.Recording = RecordingConfig{MaxSeconds: 60}
+	m, _ = send(t, m, keyPress("r"))
+	m.rec.start = time.Now().Add(-time.Minute)
+
+	m, cmd := send(t, m, frameMsg(readFrame(t, newFakeReader(drawBall))))
+	if m.rec != nil {
+		t.Fatal("recording should stop once it hits max_seconds")
+	}
+	if !strings.Contains(m.statusText, "time limit") {
+		t.Errorf("statusText = %q", m.statusText)
+	}
+	if cmd == nil {
+		t.Fatal("expected the read loop and a save command")
+	}
+}
+
+func TestQuitSavesRecording(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	m := testModel()
+	m, _ = send(t, m, keyPress("r"))
+	m, _ = send(t, m, frameMsg(readFrame(t, newFakeReader(drawBall))))
+	rec := m.rec
+
+	_, cmd := send(t, m, keyPress("q"))
+	if cmd == nil {
+		t.Fatal("quit should return a command")
+	}
+	// Closing the queue lets the encoder finish the file.
+	select {
+	case <-rec.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("quitting didn't close the recording")
+	}
+	data, err := os.ReadFile(rec.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gif.DecodeAll(bytes.NewReader(data)); err != nil {
+		t.Errorf("GIF saved on quit doesn't decode: %v", err)
+	}
+}
+
+func TestCameraSwitch(t *testing.T) {
+	m := testModel()
+	m.devices = []videoSource{
+		{kind: sourceNetwork, id: "http://a", label: "A", net: NetCamConfig{URL: "http://a"}},
+		{kind: sourceNetwork, id: "http://b", label: "B", net: NetCamConfig{URL: "http://b"}},
+	}
+	m.currentDev, m.activeKey = 0, m.devices[0].key()
+
+	m, cmd := send(t, m, keyPress("c"))
+	if m.currentDev != 1 {
+		t.Fatalf("currentDev = %d, want 1", m.currentDev)
+	}
+	if m.statusText != "Switching to B" {
+		t.Errorf("statusText = %q", m.statusText)
+	}
+
+	ready, ok := cmd().(cameraReadyMsg)
+	if !ok {
+		t.Fatalf("switch command didn't return cameraReadyMsg")
+	}
+	defer closeReader(ready.reader)
+
+	m, _ = send(t, m, keyPress("c"))
+	if m.currentDev != 0 {
+		t.Fatalf("currentDev = %d after wrapping, want 0", m.currentDev)
+	}
+}
+
+func TestCameraSwitchSingleDevice(t *testing.T) {
+	m := testModel()
+	m.devices = []videoSource{{kind: sourceCamera, id: "video0", label: "video0"}}
+	m.currentDev = 0
+
+	m, cmd := send(t, m, keyPress("c"))
+	if cmd != nil || m.currentDev != 0 {
+		t.Fatalf("switching with one device should be a no-op")
+	}
+	if m.statusText != "No other cameras found" {
+		t.Errorf("statusText = %q", m.statusText)
+	}
+}
+
+func TestCameraReadyClosesOldReader(t *testing.T) {
+	m := testModel()
+	old := newFakeReader(drawBall)
+	m.reader = old
+
+	m, cmd := send(t, m, cameraReadyMsg{reader: newFakeReader(drawColorBars), driverID: "test"})
+	if !old.closed {
+		t.Error("previous reader was not closed")
+	}
+	if cmd == nil || !strings.Contains(m.statusText, "test") {
+		t.Errorf("statusText = %q, cmd = %v", m.statusText, cmd)
+	}
+}
+
+func TestInputEndedQuits(t *testing.T) {
+	m := testModel()
+	m.input = "clip.y4m"
+	r := newFakeReader(drawBall)
+	m.reader = r
+
+	_, cmd := send(t, m, inputEndedMsg{})
+	if cmd == nil {
+		t.Fatal("input end should quit")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Error("input end without a recording should quit directly")
+	}
+	if !r.closed {
+		t.Error("reader not closed at end of input")
+	}
+}
+
+func TestViewRendersFrame(t *testing.T) {
+	m := testModel()
+	m, _ = send(t, m, frameMsg(readFrame(t, newFakeReader(drawBall))))
+	view := m.View()
+	if !strings.Contains(view, "ATLAS CAM") || !strings.Contains(view, ModeASCII.String()) {
+		t.Errorf("view is missing title or status:\n%s", view)
+	}
+}
+
+func TestCameraSwitchFromFileInput(t *testing.T) {
+	m := testModel()
+	m.devices = []videoSource{{kind: sourceNetwork, id: "http://a", label: "A", net: NetCamConfig{URL: "http://a"}}}
+
+	// Nothing from the list is open yet, so 'c' goes to the first entry.
+	m, cmd := send(t, m, keyPress("c"))
+	if m.currentDev != 0 || cmd == nil {
+		t.Fatalf("currentDev = %d, cmd = %v", m.currentDev, cmd)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// --- Network Cameras ---
+//
+// IP cams and "IP Webcam" style phone apps serve multipart/x-mixed-replace
+// MJPEG over HTTP. The body is parsed with the same JPEG splitter as MJPEG
+// files, which copes with the many cameras that get their boundaries wrong.
+
+const (
+	netCamDefaultTimeout = 10 * time.Second
+	netCamMinBackoff     = 500 * time.Millisecond
+	netCamMaxBackoff     = 30 * time.Second
+)
+
+var errNetCamClosed = errors.New("network camera closed")
+
+// netCamTransport is shared by every network camera. Timeouts are each
+// camera's own, so they're applied per request rather than here.
+var netCamTransport = &http.Transport{
+	Proxy:           http.ProxyFromEnvironment,
+	DialContext:     (&net.Dialer{KeepAlive: 30 * time.Second}).DialContext,
+	IdleConnTimeout: 90 * time.Second,
+}
+
+type netCamReader struct {
+	cfg     NetCamConfig
+	client  *http.Client
+	timeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	resp     *http.Response
+	stopResp context.CancelFunc // the request's own context
+	br       *bufio.Reader
+	idle     *time.Timer
+	buf      bytes.Buffer
+	backoff  time.Duration
+	retry    bool // the last Read failed, wait before the next attempt
+}
+
+// netCamRetry is what Read returns after a failed attempt, so the viewer
+// can say what's going on. The next Read waits out the backoff and tries
+// again.
+type netCamRetry struct {
+	err  error
+	wait time.Duration
+}
+
+func (e *netCamRetry) Error() string {
+	return fmt.Sprintf("%v (retrying in %s)", e.err, e.wait.Round(100*time.Millisecond))
+}
+
+func (e *netCamRetry) Unwrap() error { return e.err }
+
+// netCamRetryMsg puts a failed attempt in the status line while the reader
+// carries on.
+type netCamRetryMsg struct{ err *netCamRetry }
+
+func newNetCamReader(cfg NetCamConfig) *netCamReader {
+	timeout := netCamDefaultTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &netCamReader{
+		cfg:     cfg,
+		timeout: timeout,
+		ctx:     ctx,
+		cancel:  cancel,
+		// No overall client timeout, the body is an endless stream. Stalls
+		// are caught by the per-frame idle timer instead.
+		client: &http.Client{Transport: netCamTransport},
+	}
+}
+
+// Read returns the next frame, reconnecting with exponential backoff when
+// the stream drops. Each failed attempt comes back as a *netCamRetry; it
+// only gives up on Close or on errors that retrying won't fix (bad
+// credentials, not an MJPEG stream).
+func (r *netCamReader) Read() (image.Image, func(), error) {
+	if r.retry {
+		r.wait()
+		r.retry = false
+	}
+	if r.ctx.Err() != nil {
+		return nil, nil, errNetCamClosed
+	}
+
+	if r.br == nil {
+		if err := r.connect(); err != nil {
+			var fatal *netCamError
+			if errors.As(err, &fatal) && fatal.fatal {
+				return nil, nil, err
+			}
+			return nil, nil, r.failed(err)
+		}
+	}
+
+	img, err := r.readFrame()
+	if err != nil {
+		r.disconnect()
+		return nil, nil, r.failed(err)
+	}
+	r.backoff = 0
+	return img, func() {}, nil
+}
+
+// failed notes that the next Read has to wait first, and says how long.
+func (r *netCamReader) failed(err error) error {
+	if r.ctx.Err() != nil {
+		return errNetCamClosed
+	}
+	r.retry = true
+	return &netCamRetry{err: err, wait: max(r.backoff, netCamMinBackoff)}
+}
+
+type netCamError struct {
+	msg   string
+	fatal bool
+}
+
+func (e *netCamError) Error() string { return e.msg }
+
+func (r *netCamReader) connect() error {
+	// The timeout covers getting the headers back; after that the body
+	// is watched by the idle timer.
+	ctx, cancel := context.WithCancel(r.ctx)
+	timer := time.AfterFunc(r.timeout, cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.cfg.URL, nil)
+	if err != nil {
+		cancel()
+		return &netCamError{msg: err.Error(), fatal: true}
+	}
+	if r.cfg.Username != "" || r.cfg.Password != "" {
+		req.SetBasicAuth(r.cfg.Username, r.cfg.Password)
+	}
+
+	resp, err := r.client.Do(req)
+	if !timer.Stop() {
+		// Too slow, whether or not Do got to notice.
+		if err == nil {
+			resp.Body.Close()
+		}
+		err = fmt.Errorf("%s: no response in %s", r.cfg.URL, r.timeout)
+	}
+	if err != nil {
+		cancel()
+		return err
+	}
+	r.resp, r.stopResp = resp, cancel
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		r.disconnect()
+		return &netCamError{msg: fmt.Sprintf("%s: %s", r.cfg.URL, resp.Status), fatal: true}
+	case resp.StatusCode != http.StatusOK:
+		r.disconnect()
+		return &netCamError{msg: fmt.Sprintf("%s: %s", r.cfg.URL, resp.Status)}
+	}
+
+	ct := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(ct, "multipart/") && !strings.HasPrefix(ct, "image/jpeg") {
+		r.disconnect()
+		return &netCamError{msg: fmt.Sprintf("%s: unexpected content type %q", r.cfg.URL, ct), fatal: true}
+	}
+
+	r.br = bufio.NewReaderSize(resp.Body, 1<<16)
+	r.idle = time.AfterFunc(r.timeout, func() { resp.Body.Close() })
+	return nil
+}
+
+// readFrame returns the next decodable frame. A corrupt JPEG just gets
+// skipped, only transport errors drop the connection.
+func (r *netCamReader) readFrame() (image.Image, error) {
+	for {
+		r.idle.Reset(r.timeout)
+		data, err := readJPEGFrame(r.br, &r.buf)
+		if err != nil {
+			return nil, err
+		}
+		if img, err := jpeg.Decode(bytes.NewReader(data)); err == nil {
+			return img, nil
+		}
+	}
+}
+
+func (r *netCamReader) disconnect() {
+	if r.idle != nil {
+		r.idle.Stop()
+	}
+	if r.resp != nil {
+		r.resp.Body.Close()
+	}
+	if r.stopResp != nil {
+		r.stopResp()
+	}
+	r.resp, r.stopResp, r.br, r.idle = nil, nil, nil, nil
+}
+
+// wait sleeps for the current backoff (or until Close), then doubles it.
+func (r *netCamReader) wait() {
+	if r.backoff == 0 {
+		r.backoff = netCamMinBackoff
+	}
+	select {
+	case <-time.After(r.backoff):
+	case <-r.ctx.Done():
+	}
+	r.backoff = min(r.backoff*2, netCamMaxBackoff)
+}
+
+// Close is safe to call from another goroutine while Read is blocked:
+// cancelling the request context aborts the body read, and Read cleans up.
+func (r *netCamReader) Close() error {
+	r.cancel()
+	r.client.CloseIdleConnections()
+	return nil
+}
+
+// netCamLabel is what the camera list shows for a configured camera.
+func netCamLabel(cfg NetCamConfig) string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	if u, err := url.Parse(cfg.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return cfg.URL
+}
+
+func isNetCamURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// mjpegServer serves `frames` JPEGs per connection as multipart MJPEG, then
+// hangs up, the way a flaky camera would.
+func mjpegServer(t *testing.T, frames int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var conns atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conns.Add(1)
+		if user, pass, _ := r.BasicAuth(); user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+		for i := 0; i < frames; i++ {
+			data := jpegBytes(t, 16+i, 8)
+			fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(data))
+			w.Write(data)
+			w.Write([]byte("\r\n"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+// readNetFrame reads the next frame, counting the retries on the way.
+func readNetFrame(t *testing.T, r *netCamReader, retries *int) image.Image {
+	t.Helper()
+	for {
+		img, _, err := r.Read()
+		var retry *netCamRetry
+		if errors.As(err, &retry) {
+			*retries++
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+}
+
+func TestNetCamReadsAndReconnects(t *testing.T) {
+	srv, conns := mjpegServer(t, 2)
+	r := newNetCamReader(NetCamConfig{URL: srv.URL, Username: "admin", Password: "secret"})
+	defer r.Close()
+
+	// Four frames from a server that drops after two means one reconnect,
+	// and that's reported.
+	retries := 0
+	for i := 0; i < 4; i++ {
+		if w := readNetFrame(t, r, &retries).Bounds().Dx(); w != 16+i%2 {
+			t.Errorf("frame %d width = %d, want %d", i, w, 16+i%2)
+		}
+	}
+	if n := conns.Load(); n != 2 || retries != 1 {
+		t.Errorf("server saw %d connections and %d retries were reported, want 2 and 1", n, retries)
+	}
+}
+
+func TestNetCamRetryStatus(t *testing.T) {
+	srv, _ := mjpegServer(t, 1)
+	m := testModel()
+	m.reader = newNetCamReader(NetCamConfig{URL: srv.URL, Username: "admin", Password: "secret"})
+	defer closeReader(m.reader)
+	m.sourceLabel = "porch"
+
+	// The first read gets the one frame, the second finds the stream gone.
+	m, _ = send(t, m, readFrameCmd(m.reader, m.readerGen)())
+	m, cmd := send(t, m, readFrameCmd(m.reader, m.readerGen)())
+	if !strings.HasPrefix(m.statusText, "Reconnecting to porch: ") || cmd == nil {
+		t.Fatalf("status %q after the stream dropped", m.statusText)
+	}
+	m, _ = send(t, m, cmd())
+	if m.statusText != "Reconnected to porch" {
+		t.Errorf("status %q after the next frame", m.statusText)
+	}
+}
+
+func TestNetCamBadCredentials(t *testing.T) {
+	srv, _ := mjpegServer(t, 1)
+	r := newNetCamReader(NetCamConfig{URL: srv.URL, Username: "admin", Password: "wrong"})
+	defer r.Close()
+
+	if _, _, err := r.Read(); err == nil || !bytes.Contains([]byte(err.Error()), []byte("401")) {
+		t.Errorf("Read with bad credentials = %v, want 401 error", err)
+	}
+}
+
+func TestNetCamClose(t *testing.T) {
+	srv, _ := mjpegServer(t, 1)
+	r := newNetCamReader(NetCamConfig{URL: srv.URL, Username: "admin", Password: "secret"})
+	readFrame(t, r)
+	r.Close()
+
+	if _, _, err := r.Read(); err != errNetCamClosed {
+		t.Errorf("Read after Close = %v, want errNetCamClosed", err)
+	}
+}
+
+func TestNetCamInputURL(t *testing.T) {
+	srv, _ := mjpegServer(t, 1)
+	u := strings.Replace(srv.URL, "http://", "http://admin:secret@", 1)
+	ready, ok := openInputCmd(u, inputOptions{})().(cameraReadyMsg)
+	if !ok {
+		t.Fatal("--input with a URL didn't open a camera")
+	}
+	defer closeReady(ready)
+
+	if _, ok := ready.reader.(*netCamReader); !ok || ready.source != "net:"+u {
+		t.Errorf("opened %T with key %q", ready.reader, ready.source)
+	}
+	if host := strings.TrimPrefix(srv.URL, "http://"); ready.driverID != host {
+		t.Errorf("label = %q, want %q", ready.driverID, host)
+	}
+	if w := readFrame(t, ready.reader).Bounds().Dx(); w != 16 {
+		t.Errorf("frame width = %d, want 16", w)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Output Files ---
+//
+// Where captures go and what they're called. The directory defaults to
+// AtlasCam in the user's pictures folder (XDG_PICTURES_DIR on Linux), and
+// names come from templates like "atlas_cam_{date}_{time}". Every file from
+// one capture shares the base name; if any of them would overwrite
+// something, the name gets a _2, _3, ... suffix (or, with {seq} in the
+// template, the next free sequence number).
+
+const (
+	defaultPhotoName = "atlas_cam_{date}_{time}"
+	defaultClipName  = "atlas_cam_clip_{date}_{time}"
+)
+
+// photoExts are the files a snapshot can write.
+var photoExts = []string{".jpg", ".txt", ".frame.jpg", ".raw.png", ".ans", ".html", ".svg", ".json"}
+
+// captureInfo is what name templates can refer to.
+type captureInfo struct {
+	at     time.Time
+	mode   Mode
+	filter Filter
+	device string
+}
+
+var nameToken = regexp.MustCompile(`\{([a-z]+)\}`)
+
+var nameTokens = map[string]func(captureInfo, int) string{
+	"date":   func(c captureInfo, _ int) string { return c.at.Format("2006-01-02") },
+	"time":   func(c captureInfo, _ int) string { return c.at.Format("15-04-05") },
+	"unix":   func(c captureInfo, _ int) string { return strconv.FormatInt(c.at.Unix(), 10) },
+	"mode":   func(c captureInfo, _ int) string { return modeSlug(c.mode) },
+	"filter": func(c captureInfo, _ int) string { return filterSlug(c.filter) },
+	"device": func(c captureInfo, _ int) string { return fileSafe(c.device) },
+	"seq":    func(_ captureInfo, seq int) string { return fmt.Sprintf("%04d", seq) },
+}
+
+// checkNameTemplate rejects unknown tokens and anything that would put the
+// file outside the output directory.
+func checkNameTemplate(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	if strings.ContainsAny(tmpl, `/\`) {
+		return fmt.Errorf("name template %q: no path separators, set (dir) instead", tmpl)
+	}
+	for _, m := range nameToken.FindAllStringSubmatch(tmpl, -1) {
+		if _, ok := nameTokens[m[1]]; !ok {
+			return fmt.Errorf("name template %q: unknown token {%s}", tmpl, m[1])
+		}
+	}
+	return nil
+}
+
+func expandName(tmpl string, info captureInfo, seq int) string {
+	return nameToken.ReplaceAllStringFunc(tmpl, func(tok string) string {
+		if f, ok := nameTokens[tok[1:len(tok)-1]]; ok {
+			return f(info, seq)
+		}
+		return tok
+	})
+}
+
+func modeSlug(m Mode) string {
+	switch m {
+	case ModeDetailed:
+		return "detailed"
+	case ModeColor:
+		return "color"
+	case ModeStructure:
+		return "structure"
+	default:
+		return "ascii"
+	}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fileSafe turns s into something that works in a file name everywhere.
+func fileSafe(s string) string {
+	s = strings.Trim(unsafeFileChars.ReplaceAllString(s, "-"), "-.")
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// captureNamer hands out base names. Saves run concurrently, so names it
+// has given out count as taken even before their files exist, until the
+// saver releases them.
+type captureNamer struct {
+	mu       sync.Mutex
+	seq      int
+	reserved map[string]bool
+}
+
+var captureNames = &captureNamer{reserved: make(map[string]bool)}
+
+// reserve returns a free base path (without extension) in dir. A name is
+// free if none of base+ext exist for exts.
+func (n *captureNamer) reserve(dir, tmpl string, info captureInfo, exts []string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	taken := func(base string) bool {
+		if n.reserved[base] {
+			return true
+		}
+		for _, ext := range exts {
+			if _, err := os.Lstat(base + ext); !errors.Is(err, os.ErrNotExist) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var base string
+	if strings.Contains(tmpl, "{seq}") {
+		for {
+			n.seq++
+			if base = filepath.Join(dir, expandName(tmpl, info, n.seq)); !taken(base) {
+				break
+			}
+		}
+	} else {
+		name := expandName(tmpl, info, 0)
+		base = filepath.Join(dir, name)
+		for i := 2; taken(base); i++ {
+			base = filepath.Join(dir, fmt.Sprintf("%s_%d", name, i))
+		}
+	}
+	n.reserved[base] = true
+	return base
+}
+
+// release forgets a reserved name once its files exist (or won't), after
+// which they're what keeps it taken.
+func (n *captureNamer) release(base string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.reserved, base)
+}
+
+// --- Directories ---
+
+// captureDir is where photos and recordings go, created if needed.
+func captureDir(cfg OutputConfig) (string, error) {
+	dir := expandPath(cfg.Dir)
+	if dir == "" {
+		dir = filepath.Join(picturesDir(), "AtlasCam")
+	}
+	return dir, os.MkdirAll(dir, 0755)
+}
+
+// picturesDir follows the XDG user dirs setting where there is one.
+func picturesDir() string {
+	home, _ := os.UserHomeDir()
+	if dir := os.Getenv("XDG_PICTURES_DIR"); dir != "" {
+		return expandPath(dir)
+	}
+	if config, err := os.UserConfigDir(); err == nil {
+		if dir := xdgUserDir(filepath.Join(config, "user-dirs.dirs"), "XDG_PICTURES_DIR", home); dir != "" {
+			return dir
+		}
+	}
+	return filepath.Join(home, "Pictures")
+}
+
+// xdgUserDir looks key up in a user-dirs.dirs file, lines like
+//
+//	XDG_PICTURES_DIR="$HOME/Pictures"
+func xdgUserDir(path, key, home string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if !ok || k != key {
+			continue
+		}
+		v = strings.Trim(v, `"`)
+		v = strings.Replace(v, "$HOME", home, 1)
+		if !filepath.IsAbs(v) {
+			return ""
+		}
+		return v
+	}
+	return ""
+}
+
+// expandPath expands a leading ~ and environment variables.
+func expandPath(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		home, _ := os.UserHomeDir()
+		p = home + p[1:]
+	}
+	return os.ExpandEnv(p)
+}
+
+// photoPath reserves a base name (no extension) for a snapshot.
+func photoPath(cfg OutputConfig, info captureInfo) (string, error) {
+	dir, err := captureDir(cfg)
+	if err != nil {
+		return "", err
+	}
+	return captureNames.reserve(dir, orDefault(cfg.PhotoName, defaultPhotoName), info, photoExts), nil
+}
+
+// recordingPath picks the file name for a new recording.
+func recordingPath(cfg OutputConfig, format recordingFormat, info captureInfo) (string, error) {
+	dir, err := captureDir(cfg)
+	if err != nil {
+		return "", err
+	}
+	ext := format.extension()
+	return captureNames.reserve(dir, orDefault(cfg.ClipName, defaultClipName), info, []string{ext, ".json"}) + ext, nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testCapture = captureInfo{
+	at:     time.Date(2024, 5, 17, 9, 8, 7, 0, time.Local),
+	mode:   ModeDetailed,
+	filter: FilterRed,
+	device: "HD Webcam C920 (usb-0000:00:14.0)",
+}
+
+func TestExpandName(t *testing.T) {
+	for tmpl, want := range map[string]string{
+		defaultPhotoName:             "atlas_cam_2024-05-17_09-08-07",
+		"{mode}-{filter}-{seq}":      "detailed-red-tint-0042",
+		"{device}_{unix}":            "HD-Webcam-C920-usb-0000-00-14.0_" + strconv.FormatInt(testCapture.at.Unix(), 10),
+		"literal {braces} untouched": "literal {braces} untouched",
+	} {
+		if got := expandName(tmpl, testCapture, 42); got != want {
+			t.Errorf("expandName(%q) = %q, want %q", tmpl, got, want)
+		}
+	}
+}
+
+func TestCheckNameTemplate(t *testing.T) {
+	for _, ok := range []string{"", defaultClipName, "{device}-{seq}"} {
+		if err := checkNameTemplate(ok); err != nil {
+			t.Errorf("checkNameTemplate(%q) = %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"{hostname}", "clips/{date}", `..\{time}`} {
+		if err := checkNameTemplate(bad); err == nil {
+			t.Errorf("checkNameTemplate(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestReserveAvoidsCollisions(t *testing.T) {
+	dir := t.TempDir()
+	n := &captureNamer{reserved: make(map[string]bool)}
+
+	// Same second twice: the second capture gets a suffix.
+	first := n.reserve(dir, defaultPhotoName, testCapture, photoExts)
+	second := n.reserve(dir, defaultPhotoName, testCapture, photoExts)
+	if first == second || second != first+"_2" {
+		t.Errorf("names %q and %q, want a _2 suffix", first, second)
+	}
+
+	// Once saved, the files keep the name taken, not the reservation.
+	os.WriteFile(first+".jpg", nil, 0644)
+	n.release(first)
+	n.release(second)
+	if len(n.reserved) != 0 {
+		t.Errorf("still reserved: %v", n.reserved)
+	}
+	if third := n.reserve(dir, defaultPhotoName, testCapture, photoExts); third != first+"_2" {
+		t.Errorf("after release got %q, want %q", third, first+"_2")
+	}
+
+	// A file from an earlier run counts, whatever its extension.
+	os.WriteFile(filepath.Join(dir, "old_2.svg"), nil, 0644)
+	n2 := &captureNamer{reserved: make(map[string]bool)}
+	os.WriteFile(filepath.Join(dir, "old.txt"), nil, 0644)
+	if got := n2.reserve(dir, "old", testCapture, photoExts); got != filepath.Join(dir, "old_3") {
+		t.Errorf("reserve = %q, want old_3", got)
+	}
+
+	// With {seq}, the counter skips over what's already there.
+	os.WriteFile(filepath.Join(dir, "clip_0001.gif"), nil, 0644)
+	for _, want := range []string{"clip_0002", "clip_0003"} {
+		if got := n.reserve(dir, "clip_{seq}", testCapture, []string{".gif"}); got != filepath.Join(dir, want) {
+			t.Errorf("reserve = %q, want %s", got, want)
+		}
+	}
+}
+
+func TestCaptureDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	t.Setenv("XDG_PICTURES_DIR", "")
+	if dir, _ := captureDir(OutputConfig{}); dir != filepath.Join(home, "Pictures", "AtlasCam") {
+		t.Errorf("default dir = %q", dir)
+	}
+
+	os.MkdirAll(filepath.Join(home, ".config"), 0755)
+	dirs := "# written by xdg-user-dirs-update\nXDG_PICTURES_DIR=\"$HOME/Bilder\"\n"
+	os.WriteFile(filepath.Join(home, ".config", "user-dirs.dirs"), []byte(dirs), 0644)
+	if dir, _ := captureDir(OutputConfig{}); dir != filepath.Join(home, "Bilder", "AtlasCam") {
+		t.Errorf("user-dirs dir = %q", dir)
+	}
+
+	t.Setenv("XDG_PICTURES_DIR", filepath.Join(home, "pics"))
+	if dir, _ := captureDir(OutputConfig{}); dir != filepath.Join(home, "pics", "AtlasCam") {
+		t.Errorf("XDG_PICTURES_DIR dir = %q", dir)
+	}
+
+	dir, err := captureDir(OutputConfig{Dir: "~/cam/out"})
+	if err != nil || dir != filepath.Join(home, "cam", "out") {
+		t.Errorf("configured dir = %q, %v", dir, err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("dir wasn't created: %v", err)
+	}
+}
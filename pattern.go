@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// --- Test Patterns ---
+//
+// Generated sources for demos and reproducible testing, selected with
+// --input pattern:<name>. Append "+counter" to stamp the frame number on
+// top, e.g. pattern:bars+counter. Frame n always looks the same no matter how
+// fast it is read, so output only depends on how many frames were pulled.
+
+const (
+	patternWidth  = 640
+	patternHeight = 480
+)
+
+type patternFunc func(img *image.RGBA, n int)
+
+var patterns = map[string]patternFunc{
+	"bars":      drawColorBars,
+	"gradient":  drawGradient,
+	"zoneplate": drawZonePlate,
+	"ball":      drawBall,
+	"counter":   func(img *image.RGBA, n int) { fillRect(img, img.Bounds(), color.RGBA{40, 40, 40, 255}) },
+}
+
+func patternNames() []string {
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isPatternInput(s string) bool {
+	return strings.HasPrefix(s, "pattern:")
+}
+
+type patternReader struct {
+	draw     patternFunc
+	counter  bool
+	width    int
+	height   int
+	n        int
+	interval time.Duration
+	pace     pacer
+}
+
+func newPatternReader(spec string, opts inputOptions) (*patternReader, error) {
+	name, overlay := strings.CutSuffix(strings.TrimPrefix(spec, "pattern:"), "+counter")
+	draw, ok := patterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown pattern %q (have: %s)", name, strings.Join(patternNames(), ", "))
+	}
+
+	r := &patternReader{
+		draw:    draw,
+		counter: overlay || name == "counter",
+		width:   patternWidth,
+		height:  patternHeight,
+	}
+	r.interval = opts.interval()
+	return r, nil
+}
+
+func (r *patternReader) Read() (image.Image, func(), error) {
+	img := image.NewRGBA(image.Rect(0, 0, r.width, r.height))
+	r.draw(img, r.n)
+	if r.counter {
+		drawFrameCounter(img, r.n)
+	}
+	r.n++
+	r.pace.wait(r.interval)
+	return img, func() {}, nil
+}
+
+// --- Generators ---
+
+// drawColorBars draws SMPTE EG 1 style bars: seven 75% bars, the reversed
+// castellations, and the -I/white/+Q/PLUGE row.
+func drawColorBars(img *image.RGBA, n int) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	top := []color.RGBA{
+		{192, 192, 192, 255}, {192, 192, 0, 255}, {0, 192, 192, 255}, {0, 192, 0, 255},
+		{192, 0, 192, 255}, {192, 0, 0, 255}, {0, 0, 192, 255},
+	}
+	mid := []color.RGBA{
+		{0, 0, 192, 255}, {19, 19, 19, 255}, {192, 0, 192, 255}, {19, 19, 19, 255},
+		{0, 192, 192, 255}, {19, 19, 19, 255}, {192, 192, 192, 255},
+	}
+
+	y1 := h * 67 / 100
+	y2 := h * 75 / 100
+	for i := range top {
+		x0, x1 := w*i/7, w*(i+1)/7
+		fillRect(img, image.Rect(x0, 0, x1, y1), top[i])
+		fillRect(img, image.Rect(x0, y1, x1, y2), mid[i])
+	}
+
+	// Bottom row widths are in 1/28ths of the frame (a bar is 4/28).
+	bottom := []struct {
+		c     color.RGBA
+		width int
+	}{
+		{color.RGBA{0, 33, 76, 255}, 5},
+		{color.RGBA{255, 255, 255, 255}, 5},
+		{color.RGBA{50, 0, 106, 255}, 5},
+		{color.RGBA{19, 19, 19, 255}, 5},
+		{color.RGBA{9, 9, 9, 255}, 1}, // PLUGE: below black,
+		{color.RGBA{19, 19, 19, 255}, 2},
+		{color.RGBA{29, 29, 29, 255}, 1}, // ...and just above it
+		{color.RGBA{19, 19, 19, 255}, 4},
+	}
+	x := 0
+	for _, b := range bottom {
+		x1 := x + b.width
+		fillRect(img, image.Rect(w*x/28, y2, w*x1/28, h), b.c)
+		x = x1
+	}
+}
+
+// drawGradient draws a scrolling grey ramp over a scrolling hue sweep. Both
+// are triangle waves, so there's no hard wrap-around edge.
+func drawGradient(img *image.RGBA, n int) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			t := triangle(float64(x)/float64(w) + float64(n)/240)
+			var c color.RGBA
+			if y < h/2 {
+				v := uint8(math.Round(t * 255))
+				c = color.RGBA{v, v, v, 255}
+			} else {
+				c = hueToRGB(t)
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// drawZonePlate draws a circular zone plate whose frequency rises to Nyquist
+// at the frame edge, with the phase rolling over time. Good for spotting
+// aliasing in the downscale.
+func drawZonePlate(img *image.RGBA, n int) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	cx, cy := float64(w)/2, float64(h)/2
+	k := math.Pi / float64(w)
+	phase := float64(n) * 0.2
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := float64(x)-cx, float64(y)-cy
+			v := 0.5 + 0.5*math.Cos(k*(dx*dx+dy*dy)+phase)
+			g := uint8(math.Round(v * 255))
+			img.SetRGBA(x, y, color.RGBA{g, g, g, 255})
+		}
+	}
+}
+
+func drawBall(img *image.RGBA, n int) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	fillRect(img, img.Bounds(), color.RGBA{16, 16, 32, 255})
+
+	grid := color.RGBA{48, 48, 80, 255}
+	for x := 0; x < w; x += 40 {
+		fillRect(img, image.Rect(x, 0, x+1, h), grid)
+	}
+	for y := 0; y < h; y += 40 {
+		fillRect(img, image.Rect(0, y, w, y+1), grid)
+	}
+
+	const r = 40
+	// Position is a triangle wave of the frame number, i.e. bouncing off
+	// the walls at a constant 7/5 px per frame.
+	bx := r + int(triangle(float64(n*7)/float64(2*(w-2*r)))*float64(w-2*r))
+	by := r + int(triangle(float64(n*5)/float64(2*(h-2*r)))*float64(h-2*r))
+	for y := by - r; y <= by+r; y++ {
+		for x := bx - r; x <= bx+r; x++ {
+			dx, dy := x-bx, y-by
+			if dx*dx+dy*dy <= r*r {
+				// Cheap shading so edge detection has something to find
+				shade := 1 - 0.5*float64(dx+dy+2*r)/float64(4*r)
+				img.SetRGBA(x, y, color.RGBA{uint8(255 * shade), uint8(182 * shade), uint8(66 * shade), 255})
+			}
+		}
+	}
+}
+
+// drawFrameCounter stamps the frame number, scaled up 4x so it survives
+// being rendered as ASCII.
+func drawFrameCounter(img *image.RGBA, n int) {
+	const scale = 4
+	text := fmt.Sprintf("%06d", n)
+
+	small := image.NewRGBA(image.Rect(0, 0, len(text)*7+4, 17))
+	fillRect(small, small.Bounds(), color.RGBA{0, 0, 0, 255})
+	d := &font.Drawer{
+		Dst:  small,
+		Src:  image.White,
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(2, 13),
+	}
+	d.DrawString(text)
+
+	b := small.Bounds()
+	dst := image.Rect(8, 8, 8+b.Dx()*scale, 8+b.Dy()*scale)
+	xdraw.NearestNeighbor.Scale(img, dst, small, b, xdraw.Src, nil)
+}
+
+// --- Helpers ---
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	r = r.Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// triangle maps t to a 0..1..0 wave with period 1.
+func triangle(t float64) float64 {
+	t -= math.Floor(t)
+	if t < 0.5 {
+		return t * 2
+	}
+	return 2 - t*2
+}
+
+// hueToRGB returns a fully saturated color for hue h in 0..1.
+func hueToRGB(h float64) color.RGBA {
+	h = (h - math.Floor(h)) * 6
+	x := 1 - math.Abs(math.Mod(h, 2)-1)
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = 1, x
+	case 1:
+		r, g = x, 1
+	case 2:
+		g, b = 1, x
+	case 3:
+		g, b = x, 1
+	case 4:
+		r, b = x, 1
+	default:
+		r, b = 1, x
+	}
+	return color.RGBA{uint8(r * 255), uint8(g * 255), uint8(b * 255), 255}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestPatternsDeterministic(t *testing.T) {
+	for _, name := range patternNames() {
+		a, err := newPatternReader("pattern:"+name+"+counter", inputOptions{fast: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := newPatternReader("pattern:"+name+"+counter", inputOptions{fast: true})
+		for i := 0; i < 3; i++ {
+			if err := sameImage(readFrame(t, a), readFrame(t, b)); err != nil {
+				t.Fatalf("%s frame %d: %v", name, i, err)
+			}
+		}
+	}
+
+	if _, err := newPatternReader("pattern:nope", inputOptions{}); err == nil {
+		t.Error("expected an error for an unknown pattern")
+	}
+}
+
+// Frame n is the same however fast it's read and whatever came before it.
+func TestPatternFramesOnlyDependOnTheirNumber(t *testing.T) {
+	paced, _ := newPatternReader("pattern:ball+counter", inputOptions{})
+	fast, _ := newPatternReader("pattern:ball+counter", inputOptions{fast: true})
+	for i := 0; i < 3; i++ {
+		want := image.NewRGBA(image.Rect(0, 0, patternWidth, patternHeight))
+		drawBall(want, i)
+		drawFrameCounter(want, i)
+		if err := sameImage(readFrame(t, paced), want); err != nil {
+			t.Errorf("paced frame %d: %v", i, err)
+		}
+		if err := sameImage(readFrame(t, fast), want); err != nil {
+			t.Errorf("fast frame %d: %v", i, err)
+		}
+	}
+}
+
+func TestPatternsMove(t *testing.T) {
+	for _, name := range []string{"ball", "zoneplate", "counter"} {
+		r, _ := newPatternReader("pattern:"+name, inputOptions{fast: true})
+		if sameImage(readFrame(t, r), readFrame(t, r)) == nil {
+			t.Errorf("%s: frames 0 and 1 are the same", name)
+		}
+	}
+}
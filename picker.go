@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --- Picker ---
+//
+// A small modal list drawn over the feed. It only tracks the cursor; what a
+// choice means is up to whoever opened it (see pickerKind).
+
+type pickerKind int
+
+const (
+	pickerCameraMode pickerKind = iota
+	pickerDevice
+	pickerExport // from the gallery
+)
+
+type picker struct {
+	kind   pickerKind
+	title  string
+	items  []string
+	active int // index of the entry currently in use, -1 if none
+	cursor int
+	// payload is what the entries stand for, parallel to items.
+	payload []any
+	// hint documents any extra keys the opener handles itself.
+	hint string
+}
+
+type pickerKeyMap struct {
+	Up     key.Binding
+	Down   key.Binding
+	Choose key.Binding
+	Close  key.Binding
+}
+
+var pickerKeys = pickerKeyMap{
+	Up:     key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
+	Down:   key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
+	Choose: key.NewBinding(key.WithKeys("enter", " "), key.WithHelp("enter", "select")),
+	Close:  key.NewBinding(key.WithKeys("esc", "q"), key.WithHelp("esc", "close")),
+}
+
+var (
+	pickerStyle       = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(amber).Padding(0, 1)
+	pickerCursorStyle = lipgloss.NewStyle().Foreground(onyx).Background(amber)
+	pickerActiveStyle = lipgloss.NewStyle().Foreground(amber)
+)
+
+func newPicker(kind pickerKind, title string, items []string, payload []any, active int) *picker {
+	cursor := active
+	if cursor < 0 || cursor >= len(items) {
+		cursor = 0
+	}
+	return &picker{kind: kind, title: title, items: items, payload: payload, active: active, cursor: cursor}
+}
+
+// setItems swaps the entries in place (e.g. after a rescan), keeping the
+// cursor where it was as far as possible.
+func (p *picker) setItems(items []string, payload []any, active int) {
+	p.items, p.payload, p.active = items, payload, active
+	p.cursor = max(0, min(p.cursor, len(items)-1))
+}
+
+// update handles a key and reports whether the picker should close and, if
+// an entry was chosen, its index (-1 when dismissed).
+func (p *picker) update(msg tea.KeyMsg) (done bool, chosen int) {
+	switch {
+	case key.Matches(msg, pickerKeys.Up):
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case key.Matches(msg, pickerKeys.Down):
+		if p.cursor < len(p.items)-1 {
+			p.cursor++
+		}
+	case key.Matches(msg, pickerKeys.Choose):
+		if len(p.items) > 0 {
+			return true, p.cursor
+		}
+	case key.Matches(msg, pickerKeys.Close):
+		return true, -1
+	}
+	return false, -1
+}
+
+// view renders at most height rows, scrolling to keep the cursor visible.
+func (p *picker) view(height int) string {
+	rows := height - 6 // border, title, hint
+	if rows < 1 {
+		rows = 1
+	}
+	start := 0
+	if p.cursor >= rows {
+		start = p.cursor - rows + 1
+	}
+	end := min(start+rows, len(p.items))
+
+	var sb strings.Builder
+	sb.WriteString(titleStyle.UnsetMarginBottom().Render(p.title))
+	sb.WriteByte('\n')
+	if len(p.items) == 0 {
+		sb.WriteString(statusStyle.Render("(nothing found)"))
+	}
+	for i := start; i < end; i++ {
+		mark := "  "
+		if i == p.active {
+			mark = "● "
+		}
+		line := mark + p.items[i]
+		switch {
+		case i == p.cursor:
+			line = pickerCursorStyle.Render(line)
+		case i == p.active:
+			line = pickerActiveStyle.Render(line)
+		}
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	hint := "↑/↓ move • enter select • esc close"
+	if p.hint != "" {
+		hint += " • " + p.hint
+	}
+	sb.WriteString(statusStyle.Render(hint))
+	return pickerStyle.Render(sb.String())
+}
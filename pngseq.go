@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// --- PNG Sequence Recording ---
+//
+// One numbered PNG per frame in a directory of its own, for editing or
+// feeding to ffmpeg. Timing goes in frames.ffconcat next to them, which
+// ffmpeg's concat demuxer reads directly:
+//
+//	ffmpeg -f concat -i clip/frames.ffconcat -vsync vfr clip.mp4
+
+type pngSequenceSink struct {
+	dir    string
+	n      int64
+	frames int
+	last   string
+	list   *os.File
+	enc    png.Encoder
+}
+
+func newPNGSequenceSink(dir string) (*pngSequenceSink, error) {
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	list, err := os.Create(filepath.Join(dir, "frames.ffconcat"))
+	if err != nil {
+		return nil, err
+	}
+	s := &pngSequenceSink{dir: dir, list: list, enc: png.Encoder{CompressionLevel: png.BestSpeed}}
+	return s, s.writeList("ffconcat version 1.0\n")
+}
+
+func (s *pngSequenceSink) writeFrame(img image.Image, delay int) error {
+	name := fmt.Sprintf("frame_%06d.png", s.frames+1)
+	f, err := os.Create(filepath.Join(s.dir, name))
+	if err != nil {
+		return err
+	}
+	cw := &countingWriter{w: f, n: &s.n}
+	err = s.enc.Encode(cw, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	s.frames++
+	s.last = name
+	return s.writeList(fmt.Sprintf("file '%s'\nduration %.2f\n", name, float64(delay)/100))
+}
+
+func (s *pngSequenceSink) writeList(text string) error {
+	n, err := s.list.WriteString(text)
+	s.n += int64(n)
+	return err
+}
+
+func (s *pngSequenceSink) size() int64 {
+	return s.n
+}
+
+func (s *pngSequenceSink) close() error {
+	var err error
+	if s.last != "" {
+		// The concat demuxer ignores the last entry's duration unless the
+		// file is listed once more.
+		err = s.writeList(fmt.Sprintf("file '%s'\n", s.last))
+	}
+	if cerr := s.list.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *pngSequenceSink) summary() string {
+	return ""
+}
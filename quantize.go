@@ -0,0 +1,315 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// --- Color Quantization ---
+//
+// GIF frames get at most 256 colors, one of which is kept free for the
+// transparent index that delta frames use (see delta.go). Frames that
+// already fit (the ASCII modes render to plain two-color text images) keep
+// their exact colors; anything richer gets a median-cut palette, optionally
+// Floyd–Steinberg dithered. With a global palette the first median-cut
+// palette is reused for the rest of the clip, which saves a color table per
+// frame and stops colors from flickering between frames, at some cost in
+// accuracy later on. An exact palette is only reused while the frames still
+// fit in it; it was never meant to stand in for colors it hasn't seen.
+
+const (
+	maxPaletteColors  = 255
+	maxPaletteSamples = 1 << 16
+)
+
+type quantizer struct {
+	global bool
+	dither bool
+	pal    *paletteMap // the global palette, once built
+}
+
+func newQuantizer(cfg RecordingConfig) *quantizer {
+	return &quantizer{global: cfg.Palette == "global", dither: cfg.Dither}
+}
+
+// quantize maps img onto at most maxPaletteColors colors, moved to the
+// origin.
+func (q *quantizer) quantize(img image.Image) *image.Paletted {
+	src := toRGBA(img)
+
+	pm := q.pal
+	if pm != nil && pm.isExact() && !pm.covers(src) {
+		pm = nil
+	}
+	if pm == nil {
+		if pal, ok := distinctColors(src, maxPaletteColors); ok {
+			pm = newPaletteMap(pal, true)
+		} else {
+			pm = newPaletteMap(medianCut(src, maxPaletteColors), false)
+		}
+		if q.global {
+			q.pal = pm
+		}
+	}
+
+	dst := image.NewPaletted(image.Rect(0, 0, src.Rect.Dx(), src.Rect.Dy()), pm.pal)
+	if q.dither && !pm.isExact() {
+		pm.ditherInto(dst, src)
+	} else {
+		pm.mapInto(dst, src)
+	}
+	return dst
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(b)
+	draw.Draw(rgba, b, img, b.Min, draw.Src)
+	return rgba
+}
+
+func rgbKey(r, g, b uint8) uint32 {
+	return uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+}
+
+// distinctColors returns the colors in img in order of appearance, or false
+// if there are more than max of them.
+func distinctColors(img *image.RGBA, max int) (color.Palette, bool) {
+	seen := make(map[uint32]bool)
+	var pal color.Palette
+	last := uint32(1 << 24) // not a color
+	b := img.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, y):]
+		for x := 0; x < b.Dx(); x++ {
+			p := row[x*4 : x*4+3]
+			k := rgbKey(p[0], p[1], p[2])
+			if k == last || seen[k] {
+				last = k
+				continue
+			}
+			if len(pal) == max {
+				return nil, false
+			}
+			seen[k] = true
+			last = k
+			pal = append(pal, color.RGBA{p[0], p[1], p[2], 255})
+		}
+	}
+	if len(pal) == 0 {
+		pal = color.Palette{color.Black}
+	}
+	return pal, true
+}
+
+// --- Median Cut ---
+
+type rgb [3]uint8
+
+type colorBox []rgb
+
+// widest returns the channel with the largest spread and that spread.
+func (b colorBox) widest() (axis, spread int) {
+	lo, hi := rgb{255, 255, 255}, rgb{}
+	for _, c := range b {
+		for i := range c {
+			lo[i] = min(lo[i], c[i])
+			hi[i] = max(hi[i], c[i])
+		}
+	}
+	for i := range lo {
+		if s := int(hi[i]) - int(lo[i]); s > spread {
+			axis, spread = i, s
+		}
+	}
+	return axis, spread
+}
+
+func (b colorBox) average() color.RGBA {
+	var sum [3]int
+	for _, c := range b {
+		for i := range c {
+			sum[i] += int(c[i])
+		}
+	}
+	n := len(b)
+	return color.RGBA{uint8((sum[0] + n/2) / n), uint8((sum[1] + n/2) / n), uint8((sum[2] + n/2) / n), 255}
+}
+
+// medianCut builds an n-color palette: start with one box holding every
+// (sampled) pixel and keep halving the box with the widest channel spread at
+// its median until there are n boxes. Each box's average is a color.
+func medianCut(img *image.RGBA, n int) color.Palette {
+	b := img.Rect
+	step := 1
+	for (b.Dx()/step)*(b.Dy()/step) > maxPaletteSamples {
+		step++
+	}
+	var px colorBox
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			p := img.Pix[img.PixOffset(x, y):]
+			px = append(px, rgb{p[0], p[1], p[2]})
+		}
+	}
+	if len(px) == 0 {
+		return color.Palette{color.Black}
+	}
+
+	boxes := []colorBox{px}
+	for len(boxes) < n {
+		pick, axis, best := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if a, s := box.widest(); s > best {
+				pick, axis, best = i, a, s
+			}
+		}
+		if pick < 0 {
+			break // every box is a single color
+		}
+		box := boxes[pick]
+		sort.Slice(box, func(i, j int) bool { return box[i][axis] < box[j][axis] })
+		mid := len(box) / 2
+		boxes[pick] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	pal := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		pal[i] = box.average()
+	}
+	return pal
+}
+
+// --- Mapping ---
+
+// paletteMap finds the closest palette entry for a color. Lookups go
+// through a 15-bit (5 bits per channel) cache, since nearest-color search
+// over 256 entries per pixel is far too slow for video.
+type paletteMap struct {
+	pal   color.Palette
+	rgb   []rgb
+	exact map[uint32]uint8 // for palettes holding every color in the frame
+	lut   []int16
+}
+
+func newPaletteMap(pal color.Palette, exact bool) *paletteMap {
+	pm := &paletteMap{pal: pal, rgb: make([]rgb, len(pal)), lut: make([]int16, 1<<15)}
+	for i := range pm.lut {
+		pm.lut[i] = -1
+	}
+	if exact {
+		pm.exact = make(map[uint32]uint8, len(pal))
+	}
+	for i, c := range pal {
+		r, g, b, _ := c.RGBA()
+		pm.rgb[i] = rgb{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)}
+		if exact {
+			pm.exact[rgbKey(pm.rgb[i][0], pm.rgb[i][1], pm.rgb[i][2])] = uint8(i)
+		}
+	}
+	return pm
+}
+
+func (pm *paletteMap) isExact() bool {
+	return pm.exact != nil
+}
+
+// covers reports whether every color in img is in an exact palette.
+func (pm *paletteMap) covers(img *image.RGBA) bool {
+	b := img.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, y):]
+		for x := 0; x < b.Dx(); x++ {
+			if _, ok := pm.exact[rgbKey(row[x*4], row[x*4+1], row[x*4+2])]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (pm *paletteMap) index(r, g, b uint8) uint8 {
+	if pm.exact != nil {
+		if i, ok := pm.exact[rgbKey(r, g, b)]; ok {
+			return i
+		}
+	}
+	k := int(r>>3)<<10 | int(g>>3)<<5 | int(b>>3)
+	if i := pm.lut[k]; i >= 0 {
+		return uint8(i)
+	}
+	// Search from the middle of the cache cell so the result doesn't depend
+	// on which color happened to hit it first.
+	c := rgb{r&^7 | 4, g&^7 | 4, b&^7 | 4}
+	best, bestDist := 0, 1<<30
+	for i, p := range pm.rgb {
+		dr, dg, db := int(c[0])-int(p[0]), int(c[1])-int(p[1]), int(c[2])-int(p[2])
+		if d := dr*dr + dg*dg + db*db; d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	pm.lut[k] = int16(best)
+	return uint8(best)
+}
+
+func (pm *paletteMap) mapInto(dst *image.Paletted, src *image.RGBA) {
+	b := src.Rect
+	for y := 0; y < b.Dy(); y++ {
+		row := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		out := dst.Pix[y*dst.Stride:]
+		for x := 0; x < b.Dx(); x++ {
+			out[x] = pm.index(row[x*4], row[x*4+1], row[x*4+2])
+		}
+	}
+}
+
+// ditherInto maps with Floyd–Steinberg error diffusion: each pixel's
+// rounding error is pushed onto its unvisited neighbours (7/16 right, 3/16
+// down-left, 5/16 down, 1/16 down-right).
+func (pm *paletteMap) ditherInto(dst *image.Paletted, src *image.RGBA) {
+	b := src.Rect
+	w := b.Dx()
+	// Error rows, padded by one pixel on each side, in 1/16ths.
+	cur := make([][3]int, w+2)
+	next := make([][3]int, w+2)
+	for y := 0; y < b.Dy(); y++ {
+		row := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		out := dst.Pix[y*dst.Stride:]
+		for x := 0; x < w; x++ {
+			var v [3]uint8
+			for c := 0; c < 3; c++ {
+				v[c] = clampUint8(int(row[x*4+c]) + cur[x+1][c]/16)
+			}
+			i := pm.index(v[0], v[1], v[2])
+			out[x] = i
+			for c := 0; c < 3; c++ {
+				e := int(v[c]) - int(pm.rgb[i][c])
+				cur[x+2][c] += e * 7
+				next[x][c] += e * 3
+				next[x+1][c] += e * 5
+				next[x+2][c] += e
+			}
+		}
+		cur, next = next, cur
+		clear(next)
+	}
+}
+
+func clampUint8(v int) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"math"
+	"testing"
+)
+
+func patternFrame(draw patternFunc, n int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 160, 120))
+	draw(img, n)
+	return img
+}
+
+// meanError is the average per-channel distance between img and p.
+func meanError(img *image.RGBA, p *image.Paletted) float64 {
+	var sum float64
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			r, g, bl, _ := p.At(x, y).RGBA()
+			sum += math.Abs(float64(c.R)-float64(r>>8)) + math.Abs(float64(c.G)-float64(g>>8)) + math.Abs(float64(c.B)-float64(bl>>8))
+		}
+	}
+	return sum / float64(3*b.Dx()*b.Dy())
+}
+
+func TestQuantizeKeepsExactColors(t *testing.T) {
+	img := patternFrame(drawColorBars, 0)
+	p := newQuantizer(RecordingConfig{}).quantize(img)
+	if err := sameImage(p, img); err != nil {
+		t.Errorf("color bars fit in 256 colors but changed: %v", err)
+	}
+}
+
+func TestQuantizeASCIIIsTwoColors(t *testing.T) {
+	frame := readFrame(t, newFakeReader(drawBall))
+	img := renderRecFrame(recFrame{img: frame, mode: ModeASCII, width: 40, height: 20})
+	p := newQuantizer(RecordingConfig{Dither: true}).quantize(img)
+	if len(p.Palette) != 2 {
+		t.Errorf("ASCII frame got a %d-color palette, want 2", len(p.Palette))
+	}
+	if err := sameImage(p, img); err != nil {
+		t.Errorf("ASCII frame changed: %v", err)
+	}
+}
+
+func TestMedianCutBeatsFixedPalette(t *testing.T) {
+	img := patternFrame(drawGradient, 7)
+	if _, ok := distinctColors(img, maxPaletteColors); ok {
+		t.Fatal("gradient should have more colors than fit in a palette")
+	}
+
+	p := newQuantizer(RecordingConfig{}).quantize(img)
+	if len(p.Palette) != maxPaletteColors {
+		t.Errorf("palette has %d colors, want %d", len(p.Palette), maxPaletteColors)
+	}
+	if e := meanError(img, p); e > 4 {
+		t.Errorf("mean error %.2f, want <= 4", e)
+	}
+
+	// Dithering trades per-pixel error for smoother areas; it shouldn't be
+	// wildly off either.
+	d := newQuantizer(RecordingConfig{Dither: true}).quantize(img)
+	if e := meanError(img, d); e > 8 {
+		t.Errorf("dithered mean error %.2f, want <= 8", e)
+	}
+	if bytes.Equal(d.Pix, p.Pix) {
+		t.Error("dithering changed nothing")
+	}
+}
+
+func TestMedianCutSmallPalette(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	for x, c := range []color.RGBA{{0, 0, 0, 255}, {10, 0, 0, 255}, {250, 250, 250, 255}, {240, 250, 250, 255}} {
+		img.SetRGBA(x, 0, c)
+	}
+	pal := medianCut(img, 2)
+	if len(pal) != 2 {
+		t.Fatalf("got %d colors, want 2", len(pal))
+	}
+	want := []color.RGBA{{5, 0, 0, 255}, {245, 250, 250, 255}}
+	for i, c := range pal {
+		if c != want[i] {
+			t.Errorf("pal[%d] = %v, want %v", i, c, want[i])
+		}
+	}
+}
+
+func TestGlobalPaletteIsShared(t *testing.T) {
+	q := newQuantizer(RecordingConfig{Palette: "global"})
+	a := q.quantize(patternFrame(drawGradient, 0))
+	b := q.quantize(patternFrame(drawGradient, 30))
+	if &a.Palette[0] != &b.Palette[0] {
+		t.Error("global mode built a new palette for the second frame")
+	}
+
+	// A first frame with few colors doesn't get to set the palette for
+	// everything after it.
+	q = newQuantizer(RecordingConfig{Palette: "global"})
+	plain := image.NewRGBA(image.Rect(0, 0, 160, 120))
+	draw.Draw(plain, plain.Rect, image.NewUniform(color.Black), image.Point{}, draw.Src)
+	q.quantize(plain)
+	rich := patternFrame(drawGradient, 30)
+	if e := meanError(rich, q.quantize(rich)); e > 8 {
+		t.Errorf("gradient after a plain frame is off by %.1f per channel", e)
+	}
+	c := q.quantize(patternFrame(drawGradient, 60))
+	if &c.Palette[0] != &q.quantize(plain).Palette[0] {
+		t.Error("the median-cut palette wasn't kept once it was built")
+	}
+
+	encode := func(frames ...*image.Paletted) *bytes.Buffer {
+		var buf bytes.Buffer
+		gw := newGIFWriter(&buf)
+		for _, f := range frames {
+			gw.writeFrame(f, 4, -1)
+		}
+		gw.close()
+		return &buf
+	}
+	fq := newQuantizer(RecordingConfig{})
+	own := fq.quantize(patternFrame(drawGradient, 30))
+	if shared, separate := encode(a, b).Len(), encode(a, own).Len(); separate-shared < 3*256 {
+		t.Errorf("shared palette saved %d bytes, want at least a color table", separate-shared)
+	}
+
+	buf := encode(a, b)
+	g, err := gif.DecodeAll(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 2 {
+		t.Errorf("decoded %d frames, want 2", len(g.Image))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --- Reconnect ---
+//
+// USB cameras drop out: a loose cable, a hub resetting, the laptop waking up.
+// Read errors from a camera are treated as transient by default and the
+// camera is reopened with backoff (re-scanning first, since it may come back
+// under a new ID). Only errors that retrying can't fix, or running out of
+// attempts, end up on the error screen.
+
+const (
+	reconnectMinDelay    = 500 * time.Millisecond
+	reconnectMaxDelay    = 8 * time.Second
+	maxReconnectAttempts = 10 // about a minute with the delays above
+)
+
+// errCameraStopped is what a camera that ends its stream looks like. Files
+// end, cameras shouldn't.
+var errCameraStopped = errors.New("camera stopped sending frames")
+
+// isFatalReadError reports whether err is one that reopening won't fix.
+func isFatalReadError(err error) bool {
+	var ne *netCamError
+	if errors.As(err, &ne) {
+		return ne.fatal
+	}
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EBUSY)
+}
+
+// reconnectDelay is the wait before the given attempt (counting from 1).
+func reconnectDelay(attempt int) time.Duration {
+	d := reconnectMinDelay
+	for i := 1; i < attempt && d < reconnectMaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, reconnectMaxDelay)
+}
+
+// reconnectTickMsg fires when it's time for the next attempt; gen is the
+// reader generation it was scheduled for.
+type reconnectTickMsg struct{ gen int }
+
+// reconnectMsg is the result of an attempt.
+type reconnectMsg struct {
+	gen     int
+	devices []videoSource
+	ready   *cameraReadyMsg
+	err     error
+}
+
+func reconnectTickCmd(attempt, gen int) tea.Cmd {
+	return tea.Tick(reconnectDelay(attempt), func(time.Time) tea.Msg {
+		return reconnectTickMsg{gen}
+	})
+}
+
+// reconnectCmd re-scans and reopens the source with the given key, or the
+// best available camera if key is empty. name is only for messages.
+func reconnectCmd(cfg Config, key, name string, gen int) tea.Cmd {
+	return func() tea.Msg {
+		res := reconnectMsg{gen: gen, devices: rescanDevices(cfg)}
+
+		open := initCameraCmd(cfg.Camera)
+		if key != "" {
+			i := findSource(res.devices, key)
+			switch {
+			case i >= 0:
+				open = res.devices[i].openCmd(cfg.Camera)
+			case strings.HasPrefix(key, "net:"):
+				// A URL from --input, which no scan is going to list.
+				open = openNetCamCmd(NetCamConfig{URL: strings.TrimPrefix(key, "net:")})
+			default:
+				res.err = fmt.Errorf("%s is not connected", name)
+				return res
+			}
+		}
+
+		switch msg := open().(type) {
+		case cameraReadyMsg:
+			res.ready = &msg
+		case errorMsg:
+			res.err = msg
+		}
+		return res
+	}
+}
+
+// closeReady releases a source that was opened but is no longer wanted.
+func closeReady(msg cameraReadyMsg) {
+	if msg.stream != nil {
+		for _, t := range msg.stream.GetTracks() {
+			t.Close()
+		}
+	}
+	if msg.reader != nil {
+		closeReader(msg.reader)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestIsFatalReadError(t *testing.T) {
+	tests := []struct {
+		err   error
+		fatal bool
+	}{
+		{errCameraStopped, false},
+		{syscall.ENODEV, false},
+		{errors.New("read /dev/video0: input/output error"), false},
+		{&netCamError{msg: "503"}, false},
+		{&netCamError{msg: "401", fatal: true}, true},
+		{fs.ErrPermission, true},
+		{syscall.EBUSY, true},
+	}
+	for _, tt := range tests {
+		if got := isFatalReadError(tt.err); got != tt.fatal {
+			t.Errorf("isFatalReadError(%v) = %v, want %v", tt.err, got, tt.fatal)
+		}
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	want := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second}
+	for i, w := range want {
+		if got := reconnectDelay(i + 1); got != w {
+			t.Errorf("reconnectDelay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestTransientErrorReconnects(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	m := testModel()
+	m, _ = send(t, m, cameraReadyMsg{reader: newFakeReader(drawBall), driverID: "video0;video0", source: "cam:video0;video0"})
+	m, _ = send(t, m, keyPress("r"))
+	m, _ = send(t, m, readMsg{gen: m.readerGen, msg: frameMsg(readFrame(t, newFakeReader(drawBall)))})
+
+	r := m.reader.(*fakeReader)
+	m, cmd := send(t, m, readMsg{gen: m.readerGen, msg: errorMsg(syscall.ENODEV)})
+	if m.err != nil {
+		t.Fatalf("transient error went to the error screen: %v", m.err)
+	}
+	if cmd == nil || m.reconnects != 1 || !strings.Contains(m.statusText, "Reconnecting to video0;video0") {
+		t.Errorf("reconnects = %d, statusText = %q, cmd = %v", m.reconnects, m.statusText, cmd)
+	}
+	if !r.closed || m.reader != nil {
+		t.Error("dead reader was not released")
+	}
+	if m.rec == nil || m.rec.added != 1 {
+		t.Errorf("recording = %v, want it kept", m.rec)
+	}
+
+	// Still gone on the next attempt: back off and try again.
+	m, _ = send(t, m, reconnectMsg{gen: m.readerGen, err: errors.New("video0;video0 is not connected")})
+	if m.reconnects != 2 || m.err != nil {
+		t.Errorf("reconnects = %d, err = %v", m.reconnects, m.err)
+	}
+
+	// Back: frames flow again, into the same recording.
+	ready := cameraReadyMsg{reader: newFakeReader(drawBall), driverID: "video0;video0", source: "cam:video0;video0"}
+	m, cmd = send(t, m, reconnectMsg{gen: m.readerGen, ready: &ready})
+	if cmd == nil || m.reconnects != 0 || m.reader == nil {
+		t.Fatalf("reconnects = %d, reader = %v, cmd = %v", m.reconnects, m.reader, cmd)
+	}
+	m, _ = send(t, m, cmd())
+	if m.rec == nil || m.rec.added != 2 {
+		t.Errorf("recording = %v after reconnect, want 2 frames", m.rec)
+	}
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	m := testModel()
+	m, _ = send(t, m, cameraReadyMsg{reader: newFakeReader(drawBall), driverID: "cam", source: "cam:cam"})
+	m, _ = send(t, m, readMsg{gen: m.readerGen, msg: errorMsg(errCameraStopped)})
+	for m.reconnects > 0 {
+		m, _ = send(t, m, reconnectMsg{gen: m.readerGen, err: errNoCamera})
+	}
+	if m.err != errNoCamera {
+		t.Fatalf("err = %v, want %v after %d attempts", m.err, errNoCamera, maxReconnectAttempts)
+	}
+	if view := m.View(); !strings.Contains(view, "enter retry") || !strings.Contains(view, "d devices") {
+		t.Errorf("error screen doesn't offer a way out:\n%s", view)
+	}
+
+	m, cmd := send(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.err != nil || m.reconnects != 1 || cmd == nil {
+		t.Errorf("retry: err = %v, reconnects = %d, cmd = %v", m.err, m.reconnects, cmd)
+	}
+}
+
+func TestFatalErrorSkipsReconnect(t *testing.T) {
+	m := testModel()
+	m, _ = send(t, m, cameraReadyMsg{reader: newFakeReader(drawBall), driverID: "porch", source: "net:http://porch/video"})
+	fatal := &netCamError{msg: "401 Unauthorized", fatal: true}
+	m, cmd := send(t, m, readMsg{gen: m.readerGen, msg: errorMsg(fatal)})
+	if m.err == nil || m.reconnects != 0 || cmd != nil {
+		t.Errorf("err = %v, reconnects = %d, cmd = %v", m.err, m.reconnects, cmd)
+	}
+}
+
+func TestFileInputErrorIsFatal(t *testing.T) {
+	m := testModel()
+	m.input = "clip.y4m"
+	m, _ = send(t, m, cameraReadyMsg{reader: newFakeReader(drawBall), driverID: "clip.y4m"})
+	m, _ = send(t, m, readMsg{gen: m.readerGen, msg: errorMsg(errors.New("y4m: bad frame header"))})
+	if m.err == nil || m.reconnects != 0 {
+		t.Errorf("err = %v, reconnects = %d", m.err, m.reconnects)
+	}
+}
+
+func TestStaleReconnectIsDropped(t *testing.T) {
+	m := testModel()
+	m, _ = send(t, m, cameraReadyMsg{reader: newFakeReader(drawBall), driverID: "cam", source: "cam:cam"})
+	m, _ = send(t, m, readMsg{gen: m.readerGen, msg: errorMsg(errCameraStopped)})
+	gen := m.readerGen
+
+	// The user picks another source before the attempt comes back.
+	m.devices = []videoSource{{kind: sourceNetwork, id: "http://b/video", label: "b", net: NetCamConfig{URL: "http://b/video"}}}
+	m, _ = send(t, m, keyPress("c"))
+	if m.reconnects != 0 {
+		t.Fatalf("switching should cancel reconnecting, reconnects = %d", m.reconnects)
+	}
+
+	late := newFakeReader(drawBall)
+	_, cmd := send(t, m, reconnectMsg{gen: gen, ready: &cameraReadyMsg{reader: late}})
+	if cmd != nil || !late.closed {
+		t.Errorf("late reconnect should be closed and ignored, cmd = %v closed = %v", cmd, late.closed)
+	}
+}
+
+func TestAdHocURLReconnects(t *testing.T) {
+	srv, _ := mjpegServer(t, 1)
+	u := strings.Replace(srv.URL, "http://", "http://admin:secret@", 1)
+	m := testModel()
+	m.input = u
+	m, _ = send(t, m, openInputCmd(u, inputOptions{})())
+
+	// Not in the config, but still the same camera to go back to.
+	m, cmd := send(t, m, readMsg{gen: m.readerGen, msg: errorMsg(errCameraStopped)})
+	if m.reconnects != 1 || cmd == nil {
+		t.Fatalf("reconnects = %d, cmd = %v", m.reconnects, cmd)
+	}
+	res := reconnectCmd(m.cfg, m.activeKey, m.sourceName(), m.readerGen)().(reconnectMsg)
+	if res.err != nil || res.ready == nil {
+		t.Fatalf("reconnecting to %s: %v", u, res.err)
+	}
+	m, _ = send(t, m, res)
+	if m.reconnects != 0 || m.reader == nil || m.activeKey != "net:"+u {
+		t.Errorf("reconnects = %d, reader = %v, key = %q", m.reconnects, m.reader, m.activeKey)
+	}
+
+	// And from the error screen.
+	m, _ = send(t, m, errorMsg(errNoCamera))
+	m, cmd = send(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if res, ok := cmd().(reconnectMsg); !ok || res.ready == nil {
+		t.Errorf("retry gave %v", res.err)
+	} else {
+		closeReady(*res.ready)
+	}
+	closeReader(m.reader)
+}
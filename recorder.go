@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --- Recording ---
+//
+// Frames go through a small queue to an encoder goroutine that renders them
+// and appends them to the file on disk as they arrive, so memory stays flat
+// no matter how long the recording runs. If the encoder falls behind, frames
+// are dropped rather than stalling the UI.
+
+const recQueueSize = 8
+
+type recordingFormat int
+
+const (
+	recordGIF recordingFormat = iota
+	recordAPNG
+	recordPNGSequence
+	recordAVI
+	recordAsciicast
+	recordHTML
+)
+
+var recordingFormats = []recordingFormat{recordGIF, recordAPNG, recordPNGSequence, recordAVI, recordAsciicast, recordHTML}
+
+func (f recordingFormat) String() string {
+	switch f {
+	case recordAPNG:
+		return "APNG"
+	case recordPNGSequence:
+		return "PNG sequence"
+	case recordAVI:
+		return "AVI"
+	case recordAsciicast:
+		return "asciicast"
+	case recordHTML:
+		return "HTML player"
+	default:
+		return "GIF"
+	}
+}
+
+// configName is how the format is spelled in config.piml.
+func (f recordingFormat) configName() string {
+	switch f {
+	case recordAPNG:
+		return "apng"
+	case recordPNGSequence:
+		return "png"
+	case recordAVI:
+		return "avi"
+	case recordAsciicast:
+		return "cast"
+	case recordHTML:
+		return "html"
+	default:
+		return "gif"
+	}
+}
+
+// extension is added to the recording's name. PNG sequences are a
+// directory, so they get none.
+func (f recordingFormat) extension() string {
+	switch f {
+	case recordAPNG:
+		return ".png"
+	case recordPNGSequence:
+		return ""
+	case recordAVI:
+		return ".avi"
+	case recordAsciicast:
+		return ".cast"
+	case recordHTML:
+		return ".html"
+	default:
+		return ".gif"
+	}
+}
+
+func parseRecordingFormat(s string) (recordingFormat, error) {
+	if s == "" {
+		return recordGIF, nil
+	}
+	for _, f := range recordingFormats {
+		if strings.EqualFold(s, f.configName()) {
+			return f, nil
+		}
+	}
+	return recordGIF, fmt.Errorf("unknown recording format %q (have: gif, apng, png, avi, cast, html)", s)
+}
+
+// recordingSink is a recording format's encoder. It is also either a
+// frameSink or a textSink. Delays are in 1/100 s.
+type recordingSink interface {
+	size() int64
+	close() error
+	// summary adds format specific notes to the "Saved" message.
+	summary() string
+}
+
+// frameSink takes frames rendered to images.
+type frameSink interface {
+	recordingSink
+	writeFrame(img image.Image, delay int) error
+}
+
+// textSink takes the rendered text itself, escape sequences and all.
+type textSink interface {
+	recordingSink
+	writeText(text string, delay int) error
+}
+
+func newRecordingSink(format recordingFormat, path string, cfg RecordingConfig) (recordingSink, error) {
+	switch format {
+	case recordAPNG:
+		return newAPNGSink(path)
+	case recordPNGSequence:
+		return newPNGSequenceSink(path)
+	case recordAVI:
+		return newAVISink(path, cfg.FPS)
+	case recordAsciicast:
+		return newAsciicastSink(path)
+	case recordHTML:
+		return newHTMLPlayerSink(path)
+	default:
+		return newGIFSink(path, cfg)
+	}
+}
+
+// recFrame is a camera frame plus the view settings it was captured with.
+// Rendering happens on the encoder goroutine.
+type recFrame struct {
+	img           image.Image
+	at            time.Time // capture time
+	mode          Mode
+	filter        Filter
+	width, height int
+}
+
+type recorder struct {
+	path    string
+	format  recordingFormat
+	cfg     RecordingConfig
+	start   time.Time
+	queue   chan recFrame
+	done    chan struct{}
+	added   int // frames queued, UI side
+	dropped int // frames the queue had no room for, UI side
+	first   time.Time
+	last    time.Time
+	meta    *captureMeta // written next to the recording on stop, if set
+	hooks   []HookConfig // run once it's saved
+	report  func(hookResult)
+
+	// Written by the encoder.
+	sink    recordingSink
+	written atomic.Int64
+	frames  atomic.Int64
+	err     error // only read after done
+}
+
+func startRecording(path string, format recordingFormat, cfg RecordingConfig) (*recorder, error) {
+	sink, err := newRecordingSink(format, path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{
+		path:   path,
+		format: format,
+		sink:   sink,
+		cfg:    cfg,
+		start:  time.Now(),
+		queue:  make(chan recFrame, recQueueSize),
+		done:   make(chan struct{}),
+	}
+	go r.encode()
+	return r, nil
+}
+
+func (r *recorder) encode() {
+	defer close(r.done)
+
+	tl := timeline{fps: r.cfg.FPS}
+	write := func(fr recFrame, delay int) {
+		if r.err != nil {
+			return
+		}
+		var err error
+		switch sink := r.sink.(type) {
+		case textSink:
+			err = sink.writeText(renderRecText(fr), delay)
+		case frameSink:
+			var img image.Image
+			if r.cfg.RawFrames {
+				img = applyFilter(fr.img, fr.filter)
+			} else {
+				img = renderRecFrame(fr)
+			}
+			err = sink.writeFrame(img, delay)
+		}
+		if err != nil {
+			r.err = err
+			return
+		}
+		r.frames.Add(1)
+		r.written.Store(r.sink.size())
+	}
+
+	var pending *recFrame
+	for fr := range r.queue {
+		if pending == nil {
+			tl.start = fr.at
+		} else if d := tl.delayUntil(fr.at); d > 0 {
+			write(*pending, d)
+		}
+		pending = &fr
+	}
+	if pending != nil {
+		write(*pending, tl.lastDelay())
+	}
+	if err := r.sink.close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	r.written.Store(r.sink.size())
+}
+
+// add queues a frame, or drops it if the encoder is behind.
+func (r *recorder) add(f recFrame) {
+	if r.first.IsZero() {
+		r.first = f.at
+	}
+	r.last = f.at
+	select {
+	case r.queue <- f:
+		r.added++
+	default:
+		r.dropped++
+	}
+}
+
+// fps is the rate frames are actually arriving at, dropped ones included.
+func (r *recorder) fps() float64 {
+	n := r.added + r.dropped
+	span := r.last.Sub(r.first).Seconds()
+	if n < 2 || span <= 0 {
+		return 0
+	}
+	return float64(n-1) / span
+}
+
+// size is how big the file is so far.
+func (r *recorder) size() int64 {
+	return r.written.Load()
+}
+
+// limitReached names the configured limit the recording has hit, if any.
+func (r *recorder) limitReached() string {
+	if r.cfg.MaxSeconds > 0 && time.Since(r.start) >= time.Duration(r.cfg.MaxSeconds)*time.Second {
+		return "time limit"
+	}
+	if r.cfg.MaxSizeMB > 0 && r.size() >= int64(r.cfg.MaxSizeMB)<<20 {
+		return "size limit"
+	}
+	return ""
+}
+
+// stop ends the recording. The returned command waits for the encoder to
+// catch up and reports the result.
+func (r *recorder) stop() tea.Cmd {
+	close(r.queue)
+	dropped := r.dropped
+	return func() tea.Msg {
+		<-r.done
+		name := filepath.Base(r.path)
+		if r.err != nil {
+			return statusMsg(fmt.Sprintf("Recording failed: %v", r.err))
+		}
+		frames := r.frames.Load()
+		if frames == 0 {
+			os.RemoveAll(r.path)
+			return statusMsg("Nothing recorded")
+		}
+		msg := fmt.Sprintf("Saved %s: %s (%s, %d frames", r.format, name, formatSize(r.size()), frames)
+		sidecar := r.sidecarPath()
+		if err := r.writeMeta(int(frames)); err != nil {
+			msg += ", no sidecar: " + err.Error()
+			sidecar = ""
+		}
+		if r.meta == nil {
+			sidecar = ""
+		}
+		captureHooks.start(r.hooks, savedCapture{kind: "recording", files: []string{r.path}, sidecar: sidecar}, r.report)
+		if dropped > 0 {
+			msg += fmt.Sprintf(", %d dropped", dropped)
+		}
+		if notes := r.sink.summary(); notes != "" {
+			msg += ", " + notes
+		}
+		return statusMsg(msg + ")")
+	}
+}
+
+// writeMeta saves the recording's sidecar.
+func (r *recorder) writeMeta(frames int) error {
+	if r.meta == nil {
+		return nil
+	}
+	ended := r.last
+	r.meta.Ended = &ended
+	r.meta.Frames = frames
+	r.meta.Files = []string{filepath.Base(r.path)}
+	return r.meta.write(r.sidecarPath())
+}
+
+// sidecarPath is the recording's name with its extension swapped for .json.
+func (r *recorder) sidecarPath() string {
+	return strings.TrimSuffix(r.path, r.format.extension()) + ".json"
+}
+
+// renderRecFrame turns a camera frame into what ends up in the recording:
+// the rendered text for the ASCII modes, the filtered frame otherwise.
+func renderRecFrame(f recFrame) image.Image {
+	if f.mode == ModeColor {
+		return applyFilter(f.img, f.filter)
+	}
+	return textToImage(renderRecText(f))
+}
+
+// renderRecText renders a camera frame the way the view does, minus the
+// header, footer and centering. The color mode comes out as ANSI blocks.
+func renderRecText(f recFrame) string {
+	return renderArt(applyFilter(f.img, f.filter), f.mode, f.width, max(f.height-4, 1), false)
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
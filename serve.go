@@ -0,0 +1,516 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// --- Frame Hub ---
+//
+// One capture, many viewers. The hub reads the source on its own and keeps
+// the latest frame; viewers wait for a newer one and render it at their own
+// size, so a slow viewer skips frames instead of holding anyone up. Viewers
+// asking for the same size, mode and filter share one render per frame.
+// When a camera drops out, the hub reopens it the way the viewer does (see
+// reconnect.go) and viewers just see the frames stop for a bit.
+
+type frameHub struct {
+	source string // shown to viewers
+
+	mu      sync.Mutex
+	frame   image.Image
+	seq     int                   // frames so far
+	renders map[viewParams]string // of the current frame
+	err     error                 // why the source ended, once it has
+	changed chan struct{}         // closed on the next frame or the end
+	done    chan struct{}         // closed when the source ends
+	closeFn func()
+	closed  bool
+
+	// reopen opens the source again after it fails, nil for sources that
+	// can't be (files and stdin).
+	reopen func() (cameraReadyMsg, error)
+}
+
+// openFrameHub opens the source the way the viewer does at startup and
+// starts reading it.
+func openFrameHub(cfg Config, src sourceFlags) (*frameHub, error) {
+	switch msg := openSourceCmd(cfg, listSources(cfg), src.input, src.opts)().(type) {
+	case cameraReadyMsg:
+		h := newFrameHub(msg.driverID, func() { closeReady(msg) })
+		if msg.source != "" || src.input == "" {
+			h.reopen = func() (cameraReadyMsg, error) {
+				res := reconnectCmd(cfg, msg.source, h.source, 0)().(reconnectMsg)
+				if res.ready == nil {
+					return cameraReadyMsg{}, cmp.Or(res.err, errNoCamera)
+				}
+				return *res.ready, nil
+			}
+		}
+		go h.run(msg.reader)
+		return h, nil
+	case errorMsg:
+		return nil, msg
+	default:
+		return nil, fmt.Errorf("opening the camera: unexpected %T", msg)
+	}
+}
+
+func newFrameHub(source string, closeFn func()) *frameHub {
+	if source == "" {
+		source = "camera"
+	}
+	return &frameHub{
+		source:  source,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+		closeFn: closeFn,
+	}
+}
+
+func (h *frameHub) run(r VideoReader) {
+	for {
+		frame, release, err := r.Read()
+		var retry *netCamRetry
+		if errors.As(err, &retry) {
+			continue // it reconnects on its own
+		}
+		if errors.Is(err, io.EOF) {
+			err = errors.New("the input ended")
+			if h.reopen != nil {
+				err = errCameraStopped
+			}
+		}
+		if err != nil {
+			if r, err = h.reconnect(err); err != nil {
+				h.publish(nil, err)
+				return
+			}
+			continue
+		}
+		// The reader reuses its buffers, and viewers hang on to frames.
+		b := frame.Bounds()
+		clone := image.NewRGBA(b)
+		draw.Draw(clone, b, frame, b.Min, draw.Src)
+		release()
+		h.publish(clone, nil)
+	}
+}
+
+// reconnect reopens the source after err, with the viewer's backoff and
+// attempt limit. It gives up straight away on errors that reopening won't
+// fix, sources that can't be reopened and a hub that's been closed.
+func (h *frameHub) reconnect(err error) (VideoReader, error) {
+	if h.reopen == nil || isFatalReadError(err) {
+		return nil, err
+	}
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil, err
+	}
+	closeFn := h.closeFn
+	h.closeFn = nil
+	h.mu.Unlock()
+	if closeFn != nil {
+		closeFn()
+	}
+
+	for attempt := 1; attempt <= maxReconnectAttempts; attempt++ {
+		log.Printf("%s: %v, reconnecting (attempt %d/%d)", h.source, err, attempt, maxReconnectAttempts)
+		time.Sleep(reconnectDelay(attempt))
+		msg, rerr := h.reopen()
+		if rerr != nil {
+			if err = rerr; isFatalReadError(err) {
+				break
+			}
+			continue
+		}
+		h.mu.Lock()
+		if h.closed {
+			h.mu.Unlock()
+			closeReady(msg)
+			return nil, err
+		}
+		h.closeFn = func() { closeReady(msg) }
+		h.mu.Unlock()
+		log.Printf("%s is back", h.source)
+		return msg.reader, nil
+	}
+	return nil, err
+}
+
+func (h *frameHub) publish(frame image.Image, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.err = err
+		close(h.done)
+	} else {
+		h.frame = frame
+		h.seq++
+		h.renders = make(map[viewParams]string)
+	}
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// next waits for a frame newer than seq, and returns it with its number.
+func (h *frameHub) next(ctx context.Context, seq int) (image.Image, int, error) {
+	for {
+		h.mu.Lock()
+		frame, n, err, changed := h.frame, h.seq, h.err, h.changed
+		h.mu.Unlock()
+		switch {
+		case err != nil:
+			return nil, n, err
+		case n > seq:
+			return frame, n, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, n, ctx.Err()
+		}
+	}
+}
+
+// render draws frame seq for p, or returns the copy another viewer had
+// drawn already.
+func (h *frameHub) render(p viewParams, frame image.Image, seq int) string {
+	h.mu.Lock()
+	text, ok := h.renders[p]
+	current := h.seq == seq
+	h.mu.Unlock()
+	if ok && current {
+		return text
+	}
+	text = renderArt(applyFilter(frame, p.filter), p.mode, p.cols, p.rows, false)
+	h.mu.Lock()
+	if h.seq == seq {
+		h.renders[p] = text
+	}
+	h.mu.Unlock()
+	return text
+}
+
+// each calls fn with every new frame rendered for p, at most fps times a
+// second if fps is set, until ctx is done, the source ends or fn fails.
+func (h *frameHub) each(ctx context.Context, p viewParams, fps float64, fn func(text string) error) error {
+	seq := 0
+	for {
+		frame, n, err := h.next(ctx, seq)
+		if err != nil {
+			return err
+		}
+		seq = n
+		start := time.Now()
+		if err := fn(h.render(p, frame, n)); err != nil {
+			return err
+		}
+		if fps > 0 {
+			select {
+			case <-time.After(time.Until(start.Add(time.Duration(float64(time.Second) / fps)))):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// ended is why the source stopped, or nil while it's going.
+func (h *frameHub) ended() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+func (h *frameHub) close() {
+	h.mu.Lock()
+	closeFn := h.closeFn
+	h.closeFn, h.closed = nil, true
+	h.mu.Unlock()
+	if closeFn != nil {
+		closeFn()
+	}
+}
+
+// --- Serve ---
+//
+// `atlas.cam serve` streams the feed over HTTP. curl gets
+// the art as one endless response, each frame a full redraw after a
+// cursor-home escape, exactly like an asciicast recording. Browsers get a
+// small page that sizes the text to the window and receives frames as
+// server-sent events. Both take their size, mode, filter and frame rate
+// from the query string:
+//
+//	curl "localhost:8080/?cols=$(tput cols)&rows=$(tput lines)&mode=color"
+//
+// There's no authentication, so it only listens on localhost unless
+// --listen says otherwise.
+
+const (
+	defaultServeCols = 80
+	defaultServeRows = 24
+	maxServeCols     = 500
+	maxServeRows     = 250
+)
+
+// viewParams is how one viewer wants the feed drawn.
+type viewParams struct {
+	cols, rows int
+	mode       Mode
+	filter     Filter
+}
+
+// parseViewParams reads a viewer's settings from the query string, and
+// the frame rate they want (0 for every frame).
+func parseViewParams(q url.Values) (viewParams, float64, error) {
+	p := viewParams{cols: defaultServeCols, rows: defaultServeRows}
+	var fps float64
+	var err error
+	// Sizes past the limit are cut down to it rather than refused, since
+	// the page asks for whatever fits the window.
+	num := func(key string, limit int) (int, error) {
+		n, err := strconv.Atoi(q.Get(key))
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("%s should be a positive number", key)
+		}
+		return min(n, limit), nil
+	}
+	if q.Has("cols") {
+		if p.cols, err = num("cols", maxServeCols); err != nil {
+			return p, 0, err
+		}
+	}
+	if q.Has("rows") {
+		if p.rows, err = num("rows", maxServeRows); err != nil {
+			return p, 0, err
+		}
+	}
+	if q.Has("mode") {
+		if p.mode, err = parseMode(q.Get("mode")); err != nil {
+			return p, 0, err
+		}
+	}
+	if q.Has("filter") {
+		if p.filter, err = parseFilter(q.Get("filter")); err != nil {
+			return p, 0, err
+		}
+	}
+	if q.Has("fps") {
+		if fps, err = strconv.ParseFloat(q.Get("fps"), 64); err != nil || fps < 0 {
+			return p, 0, errors.New("fps should be a positive number")
+		}
+	}
+	return p, fps, nil
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Usage = usage
+	var src sourceFlags
+	src.register(fs)
+	listen := fs.String("listen", "localhost:8080", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("serve takes no arguments, got %q", fs.Arg(0))
+	}
+	cfg, err := src.load()
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	hub, err := openFrameHub(cfg, src)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	defer hub.close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// No read or write timeout: streams run for as long as viewers watch,
+	// and a read deadline would end them too. Slow or idle clients still
+	// can't hang on to a connection without sending a request.
+	srv := &http.Server{
+		Handler:           newServeMux(hub),
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+	fmt.Printf("Serving %s at http://%s/ (curl it, or open it in a browser). Ctrl+C stops.\n", hub.source, ln.Addr())
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+		err = nil
+	case <-hub.done:
+		err = hub.ended()
+	}
+	// Streams end with ctx (or the source), so this doesn't wait long.
+	stop()
+	shutdown, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdown)
+	return err
+}
+
+func newServeMux(hub *frameHub) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		if acceptsHTML(r) {
+			servePage(w, hub)
+			return
+		}
+		serveTerminal(w, r, hub)
+	})
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		serveEvents(w, r, hub)
+	})
+	return mux
+}
+
+// acceptsHTML tells browsers from curl and friends, which send */*.
+func acceptsHTML(r *http.Request) bool {
+	for _, part := range r.Header.Values("Accept") {
+		if bytes.Contains([]byte(part), []byte("text/html")) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveTerminal streams full redraws for a terminal to show as they come.
+func serveTerminal(w http.ResponseWriter, r *http.Request, hub *frameHub) {
+	p, fps, err := parseViewParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	rc := http.NewResponseController(w)
+
+	log.Printf("%s watching in a terminal (%dx%d, %s)", r.RemoteAddr, p.cols, p.rows, modeSlug(p.mode))
+	first := true
+	err = hub.each(r.Context(), p, fps, func(text string) error {
+		if _, err := io.WriteString(w, terminalFrame(text, first)); err != nil {
+			return err
+		}
+		first = false
+		return rc.Flush()
+	})
+	if r.Context().Err() == nil && err != nil {
+		fmt.Fprintf(w, "\x1b[0m\r\n%s\r\n", err)
+	}
+	log.Printf("%s left", r.RemoteAddr)
+}
+
+// serveEvents sends each frame as HTML, one server-sent event at a time,
+// and an "end" event if the source ends.
+func serveEvents(w http.ResponseWriter, r *http.Request, hub *frameHub) {
+	p, fps, err := parseViewParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	rc := http.NewResponseController(w)
+
+	log.Printf("%s watching in a browser (%dx%d, %s)", r.RemoteAddr, p.cols, p.rows, modeSlug(p.mode))
+	err = hub.each(r.Context(), p, fps, func(text string) error {
+		data, _ := json.Marshal(htmlPre(text))
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	if r.Context().Err() == nil && err != nil {
+		data, _ := json.Marshal(err.Error())
+		fmt.Fprintf(w, "event: end\ndata: %s\n\n", data)
+	}
+	log.Printf("%s left", r.RemoteAddr)
+}
+
+const servePageCSS = `html, body { height: 100%; overflow: hidden; }
+#status { position: fixed; bottom: 0; right: 0; padding: 0.5em 1em; font: 13px sans-serif; color: #888; }
+`
+
+// servePageJS fits the grid to the window (unless the page's URL sets
+// cols and rows) and reconnects at the new size when it changes.
+const servePageJS = `(() => {
+  const screen = document.getElementById("screen");
+  const status = document.getElementById("status");
+  const params = new URLSearchParams(location.search);
+  const fixed = params.has("cols") && params.has("rows");
+  let source = null, resized = null;
+
+  function fit() {
+    const probe = document.createElement("span");
+    probe.textContent = "M".repeat(100);
+    screen.replaceChildren(probe);
+    const cell = probe.getBoundingClientRect();
+    const style = getComputedStyle(screen);
+    const pad = 2 * parseFloat(style.paddingLeft);
+    params.set("cols", Math.max(1, Math.floor((innerWidth - pad) / (cell.width / 100))));
+    params.set("rows", Math.max(1, Math.floor((innerHeight - pad) / cell.height)));
+  }
+
+  function connect() {
+    if (source) source.close();
+    if (!fixed) fit();
+    source = new EventSource("events?" + params);
+    source.onmessage = (e) => { screen.innerHTML = JSON.parse(e.data); status.textContent = ""; };
+    source.onerror = () => { status.textContent = "Reconnecting..."; };
+    source.addEventListener("end", (e) => {
+      source.close();
+      status.textContent = "Stream ended: " + JSON.parse(e.data);
+    });
+  }
+
+  addEventListener("resize", () => {
+    clearTimeout(resized);
+    resized = setTimeout(connect, 300);
+  });
+  connect();
+})();
+`
+
+func servePage(w http.ResponseWriter, hub *frameHub) {
+	var b bytes.Buffer
+	writeHTMLHead(&b, "Atlas Cam: "+hub.source, servePageCSS)
+	b.WriteString("<pre class=\"atlas\" id=\"screen\"></pre>\n<div id=\"status\">Connecting...</div>\n")
+	b.WriteString("<script>\n" + servePageJS + "</script>\n</body>\n</html>\n")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(b.Bytes())
+}
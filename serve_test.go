@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pacedReader is a fakeReader that takes its time, like a camera, and
+// ends after limit frames if limit is set, or once stop is closed.
+type pacedReader struct {
+	*fakeReader
+	limit int
+	stop  chan struct{}
+}
+
+func (r *pacedReader) Read() (image.Image, func(), error) {
+	if r.limit > 0 && r.n >= r.limit {
+		return nil, nil, io.EOF
+	}
+	select {
+	case <-time.After(5 * time.Millisecond):
+	case <-r.stop:
+		return nil, nil, io.EOF
+	}
+	return r.fakeReader.Read()
+}
+
+// newTestHub shares a pacedReader, stopped when the test ends.
+func newTestHub(t *testing.T, limit int) *frameHub {
+	t.Helper()
+	hub := newFrameHub("", nil)
+	stop := make(chan struct{})
+	go hub.run(&pacedReader{fakeReader: newFakeReader(drawBall), limit: limit, stop: stop})
+	t.Cleanup(func() { close(stop) })
+	return hub
+}
+
+func startTestHub(t *testing.T, limit int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(newServeMux(newTestHub(t, limit)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestParseViewParams(t *testing.T) {
+	p, fps, err := parseViewParams(url.Values{})
+	if err != nil || p.cols != 80 || p.rows != 24 || p.mode != ModeASCII || fps != 0 {
+		t.Errorf("defaults = %+v, fps %v, %v", p, fps, err)
+	}
+	q, _ := url.ParseQuery("cols=120&rows=40&mode=Color&filter=invert&fps=5")
+	p, fps, err = parseViewParams(q)
+	if err != nil || p.cols != 120 || p.rows != 40 || p.mode != ModeColor || p.filter != FilterInvert || fps != 5 {
+		t.Errorf("parsed %+v, fps %v, %v", p, fps, err)
+	}
+	// Too big is cut down to size, since the page asks for what fits.
+	q, _ = url.ParseQuery("cols=100000&rows=100000")
+	if p, _, err = parseViewParams(q); err != nil || p.cols != maxServeCols || p.rows != maxServeRows {
+		t.Errorf("oversized = %+v, %v", p, err)
+	}
+	for _, bad := range []string{"cols=0", "rows=x", "mode=neon", "filter=blur", "fps=-1"} {
+		q, _ := url.ParseQuery(bad)
+		if _, _, err := parseViewParams(q); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+// failingReader fails once it's handed out n frames.
+type failingReader struct {
+	*fakeReader
+	n int
+}
+
+func (r *failingReader) Read() (image.Image, func(), error) {
+	if r.fakeReader.n >= r.n {
+		return nil, nil, errors.New("device unplugged")
+	}
+	return r.fakeReader.Read()
+}
+
+func TestHubReconnects(t *testing.T) {
+	hub := newFrameHub("", nil)
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	reopened := 0
+	hub.reopen = func() (cameraReadyMsg, error) {
+		reopened++
+		return cameraReadyMsg{reader: &pacedReader{fakeReader: newFakeReader(drawBall), stop: stop}}, nil
+	}
+	go hub.run(&failingReader{fakeReader: newFakeReader(drawBall), n: 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// Frames keep coming past the failure, from the reopened source.
+	if _, _, err := hub.next(ctx, 5); err != nil {
+		t.Fatalf("after the failure: %v", err)
+	}
+	if reopened != 1 {
+		t.Errorf("reopened %d times, want 1", reopened)
+	}
+}
+
+// readFrames reads n terminal frames from a curl-style stream.
+func readFrames(t *testing.T, body io.Reader, n int) []string {
+	t.Helper()
+	var frames []string
+	buf := make([]byte, 64*1024)
+	var all string
+	for len(frames) < n {
+		k, err := body.Read(buf)
+		all += string(buf[:k])
+		if err != nil {
+			t.Fatalf("after %d frames: %v", len(frames), err)
+		}
+		// Frames end with erase-below; anything after it is the next one.
+		for {
+			i := strings.Index(all, castEraseBelow)
+			if i < 0 {
+				break
+			}
+			frames = append(frames, all[:i+len(castEraseBelow)])
+			all = all[i+len(castEraseBelow):]
+		}
+	}
+	return frames
+}
+
+func TestServeTerminal(t *testing.T) {
+	srv := startTestHub(t, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two viewers at different sizes watch the same capture.
+	get := func(query string) *http.Response {
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/?"+query, nil)
+		req.Header.Set("Accept", "*/*")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Fatalf("content type %q", ct)
+		}
+		return resp
+	}
+	small, big := get("cols=20&rows=6"), get("cols=60&rows=20&mode=detailed")
+	defer small.Body.Close()
+	defer big.Body.Close()
+
+	for _, v := range []struct {
+		resp       *http.Response
+		cols, rows int
+	}{{small, 20, 6}, {big, 60, 20}} {
+		frames := readFrames(t, v.resp.Body, 2)
+		if !strings.HasPrefix(frames[0], castClear+castHome) {
+			t.Errorf("first frame starts %q, want a clear", frames[0][:8])
+		}
+		if !strings.HasPrefix(frames[1], castHome) || strings.Contains(frames[1], castClear) {
+			t.Errorf("second frame starts %q, want only a cursor home", frames[1][:8])
+		}
+		lines := strings.Split(strings.TrimPrefix(frames[1], castHome), "\r\n")
+		if len(lines) > v.rows {
+			t.Errorf("%d lines for %d rows", len(lines), v.rows)
+		}
+		width := 0
+		for _, l := range lines {
+			width = max(width, len(strings.TrimSuffix(strings.TrimSuffix(l, castEraseBelow), castEraseLine)))
+		}
+		if width > v.cols || width < v.cols/2 {
+			t.Errorf("%d columns wide for %d cols", width, v.cols)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/?cols=nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad cols: status %d", resp.StatusCode)
+	}
+}
+
+func TestServeBrowser(t *testing.T) {
+	srv := startTestHub(t, 20)
+
+	req, _ := http.NewRequest("GET", srv.URL+"/", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), `id="screen"`) || !strings.Contains(string(page), "EventSource") {
+		t.Errorf("page doesn't look like the viewer:\n%s", page)
+	}
+
+	resp, err = http.Get(srv.URL + "/events?cols=30&rows=10&mode=color")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+
+	// Frames as HTML, then the end when the input runs out.
+	var frames []string
+	var event, end string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			var s string
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &s); err != nil {
+				t.Fatalf("data isn't a JSON string: %v", err)
+			}
+			if event == "end" {
+				end = s
+			} else {
+				frames = append(frames, s)
+			}
+		case line == "":
+			event = ""
+		}
+	}
+	if len(frames) == 0 || len(frames) > 20 {
+		t.Fatalf("got %d frames, want 1 to 20", len(frames))
+	}
+	if !strings.Contains(frames[0], `<span style="color:#`) {
+		t.Errorf("color frame has no colored spans: %.200s", frames[0])
+	}
+	if end != "the input ended" {
+		t.Errorf("end event says %q", end)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --- Snapshots ---
+//
+// A snapshot is one camera frame saved every way we know: a JPEG of the
+// art drawn as text, the art as .txt, and a JSON sidecar saying how it was
+// made. The art can also go out as .ans, .html and .svg, and the untouched
+// camera frame as a lossless .raw.png, so the capture can be rendered again
+// in any mode later. Color mode always keeps the frame, as .frame.jpg if
+// there's no .raw.png, since it's the mode people take photos in. The TUI
+// and `atlas.cam convert` both go through writeSnapshot.
+
+type snapshot struct {
+	frame  image.Image // as captured, before the filter
+	mode   Mode
+	filter Filter
+	info   captureInfo
+}
+
+// writeSnapshot saves s under base (a path without extension) and returns
+// the extensions it wrote.
+func writeSnapshot(base string, s snapshot, cfg Config) ([]string, error) {
+	name := filepath.Base(base)
+	cols := cfg.Render.Columns
+	if cols <= 0 {
+		cols = defaultRenderColumns
+	}
+	rows := 4 * cols // tall enough that only the width limits the layout
+
+	art := renderArt(applyFilter(s.frame, s.filter), s.mode, cols, rows, false)
+	// Draw the text at the configured resolution
+	r, err := newTextRenderer(cfg.Render, cols, strings.Count(art, "\n"))
+	if err != nil {
+		return nil, err
+	}
+	photo := r.render(art)
+	keepFrame := s.mode == ModeColor && !cfg.Snapshot.SaveRaw
+
+	meta := newCaptureMeta("photo", s.info, s.frame.Bounds().Size())
+	meta.Mode, meta.Filter = modeSlug(s.mode), filterSlug(s.filter)
+	meta.setArt(s.mode, art)
+	switch {
+	case cfg.Snapshot.SaveRaw:
+		meta.Original = name + ".raw.png"
+	case keepFrame:
+		meta.Original = name + ".frame.jpg"
+	}
+
+	var saved []string
+	write := func(ext string, data []byte) error {
+		if err := os.WriteFile(base+ext, data, 0644); err != nil {
+			return err
+		}
+		saved = append(saved, ext)
+		return nil
+	}
+
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, photo, nil); err != nil {
+		return nil, err
+	}
+	if err := write(".jpg", jpegWithComment(jpg.Bytes(), meta.comment())); err != nil {
+		return nil, err
+	}
+	if s.mode != ModeColor {
+		if err := write(".txt", []byte(art)); err != nil {
+			return nil, err
+		}
+	}
+	if keepFrame {
+		var frame bytes.Buffer
+		if err := jpeg.Encode(&frame, s.frame, nil); err != nil {
+			return nil, err
+		}
+		if err := write(".frame.jpg", frame.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Snapshot.SaveRaw {
+		var raw bytes.Buffer
+		if err := png.Encode(&raw, s.frame); err != nil {
+			return nil, err
+		}
+		if err := write(".raw.png", raw.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	// The render as ANSI art, colors and all
+	if cfg.Snapshot.ANSI {
+		colors, _ := parseANSIColors(cfg.Snapshot.ANSIColors) // checked in main
+		if err := write(".ans", ansFile(art, colors, sauce{title: name, author: cfg.Snapshot.Author})); err != nil {
+			return nil, err
+		}
+	}
+
+	// HTML and SVG keep both the text and its colors
+	if cfg.Snapshot.HTML {
+		if err := write(".html", htmlPage(art, name)); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Snapshot.SVG {
+		if err := write(".svg", svgImage(art)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ext := range saved {
+		meta.Files = append(meta.Files, name+ext)
+	}
+	if err := meta.write(base + ".json"); err != nil {
+		return nil, err
+	}
+	return append(saved, ".json"), nil
+}
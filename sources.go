@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/driver/camera"
+)
+
+// --- Sources ---
+//
+// Everything the 'c' key and the device picker can switch between: local
+// cameras found by mediadevices, followed by the network cameras from the
+// config. The list is re-enumerated when the picker opens (and periodically,
+// if rescan_seconds is set) so cameras plugged in after launch show up, and
+// unplugged ones go away.
+
+type sourceKind int
+
+const (
+	sourceCamera sourceKind = iota
+	sourceNetwork
+)
+
+type videoSource struct {
+	kind  sourceKind
+	id    string // mediadevices device ID, or the stream URL
+	label string // stable device label (e.g. "video0;video0"), or display name
+	name  string // human readable model name, if the driver knows it
+	net   NetCamConfig
+}
+
+// key identifies a source across re-enumerations. mediadevices hands out
+// fresh IDs on every scan, but labels stay put.
+func (s videoSource) key() string {
+	if s.kind == sourceNetwork {
+		return "net:" + s.id
+	}
+	return "cam:" + s.label
+}
+
+// title is the short name shown in lists and the status line.
+func (s videoSource) title() string {
+	if s.name != "" {
+		return s.name
+	}
+	return s.label
+}
+
+// detail is the identifier shown next to the title in the device picker.
+func (s videoSource) detail() string {
+	if s.kind == sourceNetwork {
+		return s.id
+	}
+	return s.label
+}
+
+func (s videoSource) matches(query string) bool {
+	q := strings.ToLower(query)
+	for _, f := range []string{s.label, s.name, s.id} {
+		if f != "" && strings.Contains(strings.ToLower(f), q) {
+			return true
+		}
+	}
+	return false
+}
+
+func listSources(cfg Config) []videoSource {
+	var sources []videoSource
+	for _, d := range cameraDrivers("") {
+		info := d.Info()
+		name, _, _ := strings.Cut(info.Name, camera.LabelSeparator)
+		sources = append(sources, videoSource{kind: sourceCamera, id: d.ID(), label: info.Label, name: strings.TrimSpace(name)})
+	}
+	// The driver manager is a map, so sort for a stable order.
+	sort.Slice(sources, func(i, j int) bool { return sources[i].label < sources[j].label })
+
+	for _, nc := range cfg.NetworkCameras {
+		if nc.URL == "" {
+			continue
+		}
+		sources = append(sources, videoSource{kind: sourceNetwork, id: nc.URL, label: netCamLabel(nc), net: nc})
+	}
+	return sources
+}
+
+func findSource(sources []videoSource, key string) int {
+	for i, s := range sources {
+		if s.key() == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// openCmd opens the source. want only applies to local cameras, network
+// streams come in whatever shape the camera sends.
+func (s videoSource) openCmd(want CameraConfig) tea.Cmd {
+	switch s.kind {
+	case sourceNetwork:
+		return openNetCamCmd(s.net)
+	default:
+		return switchCameraCmd(s.id, want)
+	}
+}
+
+func openNetCamCmd(cfg NetCamConfig) tea.Cmd {
+	return func() tea.Msg {
+		// Connecting happens lazily on the first Read, so a camera that is
+		// still booting just shows up late instead of failing here.
+		return cameraReadyMsg{
+			reader:   newNetCamReader(cfg),
+			driverID: netCamLabel(cfg),
+			source:   videoSource{kind: sourceNetwork, id: cfg.URL}.key(),
+		}
+	}
+}
+
+// --- Re-enumeration ---
+
+type devicesMsg []videoSource
+type rescanTickMsg struct{}
+
+// rescanDevicesCmd re-runs camera discovery, unless a scan is already
+// running, in which case that one's result will do.
+func rescanDevicesCmd(cfg Config) tea.Cmd {
+	return func() tea.Msg {
+		if !scanMu.TryLock() {
+			return nil
+		}
+		defer scanMu.Unlock()
+		return devicesMsg(scanDevices(cfg))
+	}
+}
+
+// scanMu keeps scans from overlapping; the ticker, the picker and
+// reconnects can all ask for one.
+var scanMu sync.Mutex
+
+func rescanDevices(cfg Config) []videoSource {
+	scanMu.Lock()
+	defer scanMu.Unlock()
+	return scanDevices(cfg)
+}
+
+// scanDevices drops the drivers from the manager first, since only the Linux
+// backend clears them itself. A stream that is already open keeps working
+// on its old driver, see cameraDrivers.
+func scanDevices(cfg Config) []videoSource {
+	manager := driver.GetManager()
+	for _, d := range manager.Query(cameraFilter) {
+		manager.Delete(d.ID())
+	}
+	camera.Initialize()
+	return listSources(cfg)
+}
+
+func rescanTickCmd(seconds int) tea.Cmd {
+	if seconds <= 0 {
+		return nil
+	}
+	return tea.Tick(time.Duration(seconds)*time.Second, func(time.Time) tea.Msg {
+		return rescanTickMsg{}
+	})
+}
+
+// devicePickerItems formats sources as aligned "title  detail" rows.
+func devicePickerItems(sources []videoSource) ([]string, []any) {
+	width := 0
+	for _, s := range sources {
+		width = max(width, len(s.title()))
+	}
+	items := make([]string, len(sources))
+	payload := make([]any, len(sources))
+	for i, s := range sources {
+		tag := "cam"
+		if s.kind == sourceNetwork {
+			tag = "net"
+		}
+		items[i] = fmt.Sprintf("[%s] %-*s  %s", tag, width, s.title(), s.detail())
+		payload[i] = s
+	}
+	return items, payload
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+func TestSourceKeysSurviveRescan(t *testing.T) {
+	before := videoSource{kind: sourceCamera, id: "uuid-1", label: "video0;video0"}
+	after := videoSource{kind: sourceCamera, id: "uuid-2", label: "video0;video0"}
+	if before.key() != after.key() {
+		t.Errorf("key changed across scans: %q vs %q", before.key(), after.key())
+	}
+}
+
+func TestSourceMatches(t *testing.T) {
+	s := videoSource{kind: sourceCamera, id: "uuid", label: "video2;video2", name: "HD Pro Webcam C920"}
+	for _, q := range []string{"video2", "c920", "HD Pro"} {
+		if !s.matches(q) {
+			t.Errorf("%q should match %+v", q, s)
+		}
+	}
+	if s.matches("video3") {
+		t.Error("video3 should not match video2")
+	}
+}
+
+func TestListSourcesIncludesNetworkCameras(t *testing.T) {
+	cfg := Config{NetworkCameras: []NetCamConfig{
+		{Name: "Kitchen", URL: "http://10.0.0.2/video"},
+		{Name: "No URL"},
+		{URL: "http://10.0.0.3:8080/video"},
+	}}
+	var net []videoSource
+	for _, s := range listSources(cfg) {
+		if s.kind == sourceNetwork {
+			net = append(net, s)
+		}
+	}
+	if len(net) != 2 {
+		t.Fatalf("got %d network sources, want 2", len(net))
+	}
+	if net[0].title() != "Kitchen" || net[1].title() != "10.0.0.3:8080" {
+		t.Errorf("titles = %q, %q", net[0].title(), net[1].title())
+	}
+}
+
+func TestDevicePicker(t *testing.T) {
+	m := testModel()
+	m.devices = []videoSource{
+		{kind: sourceCamera, id: "uuid-1", label: "video0;video0", name: "Built-in"},
+		{kind: sourceNetwork, id: "http://b/video", label: "Porch", net: NetCamConfig{URL: "http://b/video"}},
+	}
+	m.currentDev, m.activeKey, m.activeID = 0, m.devices[0].key(), "uuid-1"
+
+	m, cmd := send(t, m, keyPress("d"))
+	if m.picker == nil || m.picker.kind != pickerDevice || cmd == nil {
+		t.Fatal("'d' should open the device picker and start a rescan")
+	}
+	if m.picker.active != 0 {
+		t.Errorf("active = %d, want 0", m.picker.active)
+	}
+	view := m.picker.view(20)
+	for _, want := range []string{"Built-in", "video0;video0", "Porch", "http://b/video"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("picker view is missing %q:\n%s", want, view)
+		}
+	}
+
+	// A scan comes back: the camera got a new ID, and a new one appeared.
+	m, _ = send(t, m, devicesMsg{
+		{kind: sourceCamera, id: "uuid-9", label: "video0;video0", name: "Built-in"},
+		{kind: sourceCamera, id: "uuid-7", label: "video4;video4", name: "USB Cam"},
+		m.devices[1],
+	})
+	if m.currentDev != 0 || m.activeID != "uuid-9" {
+		t.Errorf("after rescan currentDev = %d, activeID = %q", m.currentDev, m.activeID)
+	}
+	if len(m.picker.items) != 3 {
+		t.Errorf("picker has %d items after rescan, want 3", len(m.picker.items))
+	}
+
+	m, _ = send(t, m, keyPress("j"))
+	m, _ = send(t, m, keyPress("j"))
+	m, cmd = send(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.picker != nil || cmd == nil || m.currentDev != 2 {
+		t.Fatalf("picker = %v, cmd = %v, currentDev = %d", m.picker, cmd, m.currentDev)
+	}
+	if m.statusText != "Switching to Porch" {
+		t.Errorf("statusText = %q", m.statusText)
+	}
+	ready := cmd().(cameraReadyMsg)
+	defer closeReader(ready.reader)
+	if ready.source != m.devices[2].key() {
+		t.Errorf("opened source %q, want %q", ready.source, m.devices[2].key())
+	}
+}
+
+func TestUnpluggedDeviceIsDropped(t *testing.T) {
+	m := testModel()
+	m.devices = []videoSource{{kind: sourceCamera, id: "uuid-1", label: "video0;video0"}}
+	m.currentDev, m.activeKey = 0, m.devices[0].key()
+
+	m, _ = send(t, m, devicesMsg{})
+	if m.currentDev != -1 || len(m.devices) != 0 {
+		t.Errorf("currentDev = %d, devices = %v", m.currentDev, m.devices)
+	}
+}
+
+// fakeCamera is a driver that opens but never streams.
+type fakeCamera struct{}
+
+func (fakeCamera) Open() error              { return nil }
+func (fakeCamera) Close() error             { return nil }
+func (fakeCamera) Properties() []prop.Media { return nil }
+func (fakeCamera) VideoRecord(prop.Media) (video.Reader, error) {
+	return nil, errors.New("fake camera")
+}
+
+// registerFakeCamera adds a driver for label, as a scan would.
+func registerFakeCamera(t *testing.T, label string) driver.Driver {
+	t.Helper()
+	manager := driver.GetManager()
+	manager.Register(fakeCamera{}, driver.Info{Label: label, DeviceType: driver.Camera})
+	for _, d := range manager.Query(cameraFilter) {
+		if d.Info().Label == label && d.Status() == driver.StateClosed {
+			t.Cleanup(func() { manager.Delete(d.ID()) })
+			return d
+		}
+	}
+	t.Fatal("fake camera didn't register")
+	return nil
+}
+
+func TestOpenDriverSurvivesRescan(t *testing.T) {
+	const label = "fake0;fake0"
+	streaming := registerFakeCamera(t, label)
+	streaming.Open()
+	holdDriver(streaming)
+
+	// The scan replaces the driver with a new one for the same camera.
+	driver.GetManager().Delete(streaming.ID())
+	fresh := registerFakeCamera(t, label)
+
+	if ds := cameraDrivers(""); len(ds) != 1 || ds[0] != streaming {
+		t.Fatalf("while streaming, drivers = %v, want the open one", ds)
+	}
+	if ds := cameraDrivers(streaming.ID()); len(ds) != 1 || ds[0] != streaming {
+		t.Errorf("looking up the open driver found %v", ds)
+	}
+
+	// Once it's closed (say to switch modes) its ID leads to the new one.
+	streaming.Close()
+	if ds := cameraDrivers(streaming.ID()); len(ds) != 1 || ds[0] != fresh {
+		t.Errorf("after closing, drivers = %v, want the rescanned one", ds)
+	}
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/crypto/ssh"
+)
+
+// --- SSH Server ---
+//
+// `atlas.cam ssh-serve` runs the viewer for anyone who can ssh in. The
+// camera is opened once and shared through a frameHub (see serve.go); each
+// session gets its own Bubble Tea program at its own terminal size, with
+// its own mode and filter. Keys come from an OpenSSH style authorized_keys
+// file, and each key can view or control:
+//
+//	access="control" ssh-ed25519 AAAA... alice@laptop
+//	ssh-ed25519 AAAA... bob@desk
+//
+// Viewers can change how the feed is drawn and copy frames to their own
+// clipboard. Control also saves photos and recordings on the server and
+// opens the gallery. Switching cameras stays with whoever started it.
+
+const (
+	accessView    = "view"
+	accessControl = "control"
+)
+
+func parseAccess(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case accessView:
+		return accessView, nil
+	case accessControl:
+		return accessControl, nil
+	}
+	return "", fmt.Errorf("access is %q, want view or control", s)
+}
+
+// authorizedKey is what one key in authorized_keys is allowed.
+type authorizedKey struct {
+	access  string
+	comment string
+}
+
+// loadAuthorizedKeys reads path, keyed by the marshaled public key. Keys
+// without an access option get def. Lines that aren't keys are skipped,
+// like sshd does.
+func loadAuthorizedKeys(path, def string) (map[string]authorizedKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]authorizedKey)
+	for len(data) > 0 {
+		pub, comment, options, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			break // no more keys
+		}
+		data = rest
+		k := authorizedKey{access: def, comment: comment}
+		for _, opt := range options {
+			name, value, _ := strings.Cut(opt, "=")
+			if !strings.EqualFold(name, "access") {
+				continue
+			}
+			if k.access, err = parseAccess(strings.Trim(value, `"`)); err != nil {
+				return nil, fmt.Errorf("%s: key %s: %w", path, ssh.FingerprintSHA256(pub), err)
+			}
+		}
+		if k.comment == "" {
+			k.comment = ssh.FingerprintSHA256(pub)
+		}
+		keys[string(pub.Marshal())] = k
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys in %s", path)
+	}
+	return keys, nil
+}
+
+// loadHostKey reads the server's key, making one the first time.
+func loadHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(priv, "atlas.cam host key")
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(block)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Created a host key in %s\n", path)
+	} else if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(data)
+}
+
+type sshServer struct {
+	hub      *frameHub
+	cfg      Config
+	config   *ssh.ServerConfig
+	keysPath string
+	access   string // for keys without their own
+
+	sessions sync.WaitGroup
+}
+
+func newSSHServer(hub *frameHub, cfg Config, hostKey ssh.Signer, keysPath, access string) *sshServer {
+	s := &sshServer{hub: hub, cfg: cfg, keysPath: keysPath, access: access}
+	s.config = &ssh.ServerConfig{PublicKeyCallback: s.checkKey}
+	s.config.AddHostKey(hostKey)
+	return s
+}
+
+// checkKey looks the key up in authorized_keys, read again every time so
+// keys can be added and removed without a restart.
+func (s *sshServer) checkKey(conn ssh.ConnMetadata, pub ssh.PublicKey) (*ssh.Permissions, error) {
+	keys, err := loadAuthorizedKeys(s.keysPath, s.access)
+	if err != nil {
+		log.Printf("can't check %s's key: %v", conn.User(), err)
+		return nil, err
+	}
+	k, ok := keys[string(pub.Marshal())]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %s", ssh.FingerprintSHA256(pub))
+	}
+	return &ssh.Permissions{Extensions: map[string]string{"access": k.access, "key": k.comment}}, nil
+}
+
+// serve handles connections on ln until ctx is done, then waits for the
+// sessions to wrap up.
+func (s *sshServer) serve(ctx context.Context, ln net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+	var err error
+	for {
+		var conn net.Conn
+		conn, err = ln.Accept()
+		if err != nil {
+			break
+		}
+		s.sessions.Add(1)
+		go func() {
+			defer s.sessions.Done()
+			s.handleConn(ctx, conn)
+		}()
+	}
+	s.sessions.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (s *sshServer) handleConn(ctx context.Context, conn net.Conn) {
+	// Don't let a half-open connection sit in the handshake forever.
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	sc, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		log.Printf("%s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	defer sc.Close()
+	go ssh.DiscardRequests(reqs)
+
+	// Sessions end with the connection, or the server.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { sc.Close() })
+	defer stop()
+
+	who := fmt.Sprintf("%s (%s) from %s", sc.User(), sc.Permissions.Extensions["key"], sc.RemoteAddr())
+	access := sc.Permissions.Extensions["access"]
+	log.Printf("%s connected, can %s", who, access)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only sessions here")
+			continue
+		}
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		s.sessions.Add(1)
+		go func() {
+			defer s.sessions.Done()
+			s.handleSession(ctx, sc, ch, reqs, access == accessControl)
+		}()
+	}
+	log.Printf("%s left", who)
+}
+
+// ptyRequest and windowChange are the payloads of those requests, RFC 4254
+// section 6.2 and 6.7.
+type ptyRequest struct {
+	Term              string
+	Columns, Rows     uint32
+	WidthPx, HeightPx uint32
+	Modes             string
+}
+
+type windowChange struct {
+	Columns, Rows     uint32
+	WidthPx, HeightPx uint32
+}
+
+func (s *sshServer) handleSession(ctx context.Context, sc *ssh.ServerConn, ch ssh.Channel, reqs <-chan *ssh.Request, control bool) {
+	defer ch.Close()
+	sess := &sshSession{hub: s.hub, control: control}
+	if host, port, err := net.SplitHostPort(sc.RemoteAddr().String()); err == nil {
+		lhost, lport, _ := net.SplitHostPort(sc.LocalAddr().String())
+		sess.env = append(sess.env, fmt.Sprintf("SSH_CONNECTION=%s %s %s %s", host, port, lhost, lport))
+	}
+
+	var (
+		pty  *ptyRequest
+		p    *tea.Program
+		done = make(chan struct{})
+	)
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			var pr ptyRequest
+			ok := ssh.Unmarshal(req.Payload, &pr) == nil && p == nil
+			if ok {
+				pty = &pr
+				sess.env = append(sess.env, "TERM="+pr.Term)
+			}
+			req.Reply(ok, nil)
+
+		case "env":
+			// Only before the shell, the model reads it from then on.
+			var kv struct{ Name, Value string }
+			ok := ssh.Unmarshal(req.Payload, &kv) == nil && p == nil
+			if ok {
+				sess.env = append(sess.env, kv.Name+"="+kv.Value)
+			}
+			req.Reply(ok, nil)
+
+		case "window-change":
+			var wc windowChange
+			switch {
+			case ssh.Unmarshal(req.Payload, &wc) != nil:
+			case p != nil:
+				p.Send(tea.WindowSizeMsg{Width: int(wc.Columns), Height: int(wc.Rows)})
+			case pty != nil:
+				pty.Columns, pty.Rows = wc.Columns, wc.Rows
+			}
+
+		case "shell":
+			if p != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			if pty == nil {
+				fmt.Fprint(ch, "atlas.cam needs a terminal, try ssh -t\r\n")
+				sendExitStatus(ch, 1)
+				go ssh.DiscardRequests(reqs)
+				return
+			}
+			m := sessionModel(s.cfg, sess, int(pty.Columns), int(pty.Rows))
+			p = tea.NewProgram(m,
+				tea.WithInput(ch), tea.WithOutput(ch), tea.WithEnvironment(sess.env),
+				tea.WithContext(ctx), tea.WithoutSignalHandler(), tea.WithAltScreen())
+			sess.send = p.Send
+			go s.runSession(p, ch, done)
+
+		default: // exec, subsystems, agent and X11 forwarding...
+			req.Reply(false, nil)
+		}
+	}
+	// The client closed the channel (or the program did, and is done).
+	if p != nil {
+		p.Kill()
+		<-done
+	}
+}
+
+func (s *sshServer) runSession(p *tea.Program, ch ssh.Channel, done chan struct{}) {
+	defer close(done)
+	final, err := p.Run()
+	// Killed mid-recording by a dropped connection? Finish the file.
+	if m, ok := final.(model); ok && m.rec != nil {
+		m.rec.stop()()
+	}
+	status := 0
+	if err != nil && !errors.Is(err, tea.ErrProgramKilled) {
+		log.Printf("session: %v", err)
+		status = 1
+	}
+	if err := s.hub.ended(); err != nil {
+		fmt.Fprintf(ch, "The feed stopped: %v\r\n", err)
+	}
+	sendExitStatus(ch, status)
+	ch.Close()
+}
+
+func sendExitStatus(ch ssh.Channel, status int) {
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+}
+
+// sshSession is what the model needs to know when it runs over SSH.
+type sshSession struct {
+	hub     *frameHub
+	control bool
+	env     []string      // from the client, plus SSH_CONNECTION
+	send    func(tea.Msg) // to the session's program, for hook results
+}
+
+// getenv looks name up in the session's environment. The first one wins,
+// so a client can't unset SSH_CONNECTION and get us running xclip.
+func (s *sshSession) getenv(name string) string {
+	for _, kv := range s.env {
+		if k, v, _ := strings.Cut(kv, "="); k == name {
+			return v
+		}
+	}
+	return ""
+}
+
+// readyCmd hands the model a reader on the shared capture, as if it had
+// opened a camera.
+func (s *sshSession) readyCmd() tea.Cmd {
+	return func() tea.Msg {
+		return cameraReadyMsg{reader: s.hub.reader(), driverID: s.hub.source}
+	}
+}
+
+// sessionModel is the viewer for one SSH session. Keys for things that
+// belong to the server are switched off, which hides them from the help
+// too.
+func sessionModel(cfg Config, sess *sshSession, width, height int) model {
+	m := initialModel(cfg, "", inputOptions{})
+	m.session = sess
+	m.devices = nil
+	m.width, m.height = width, height
+	m.keys = sessionKeys(sess.control)
+	return m
+}
+
+func sessionKeys(control bool) keyMap {
+	k := keys
+	off := []*key.Binding{&k.Switch, &k.Devices, &k.Format, &k.Retry}
+	if !control {
+		off = append(off, &k.Snap, &k.Record, &k.RecFormat, &k.Gallery)
+	}
+	for _, b := range off {
+		b.SetEnabled(false)
+	}
+	return k
+}
+
+// hubReader is a VideoReader over a frameHub, for a model to read from.
+type hubReader struct {
+	hub    *frameHub
+	seq    int
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (h *frameHub) reader() *hubReader {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &hubReader{hub: h, ctx: ctx, cancel: cancel}
+}
+
+// Read waits for the next frame. The hub's frames are never written to,
+// so there's nothing to release. The end of the feed reads as EOF.
+func (r *hubReader) Read() (image.Image, func(), error) {
+	frame, seq, err := r.hub.next(r.ctx, r.seq)
+	if err != nil {
+		return nil, nil, io.EOF
+	}
+	r.seq = seq
+	return frame, func() {}, nil
+}
+
+func (r *hubReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+func runSSHServe(args []string) error {
+	flags := flag.NewFlagSet("ssh-serve", flag.ContinueOnError)
+	flags.Usage = usage
+	var src sourceFlags
+	src.register(flags)
+	var listen, hostKey, keysPath, access string
+	flags.StringVar(&listen, "listen", "", "")
+	flags.StringVar(&hostKey, "host-key", "", "")
+	flags.StringVar(&keysPath, "authorized-keys", "", "")
+	flags.StringVar(&access, "access", "", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("ssh-serve takes no arguments, got %q", flags.Arg(0))
+	}
+	cfg, err := src.load()
+	if err != nil {
+		return err
+	}
+
+	// Flags win over the config, which has the defaults.
+	sc := cfg.SSH
+	for _, f := range []struct{ flag, conf *string }{{&listen, &sc.Listen}, {&hostKey, &sc.HostKey}, {&keysPath, &sc.AuthorizedKeys}, {&access, &sc.Access}} {
+		if *f.flag != "" {
+			*f.conf = *f.flag
+		}
+	}
+	if sc.Access, err = parseAccess(sc.Access); err != nil {
+		return err
+	}
+	dir := filepath.Dir(src.configPath)
+	if sc.HostKey == "" {
+		sc.HostKey = filepath.Join(dir, "ssh_host_key")
+	}
+	if sc.AuthorizedKeys == "" {
+		sc.AuthorizedKeys = filepath.Join(dir, "authorized_keys")
+	}
+	sc.HostKey, sc.AuthorizedKeys = expandPath(sc.HostKey), expandPath(sc.AuthorizedKeys)
+
+	// Better to hear about a missing or broken keys file now than from
+	// every failed login.
+	if _, err := loadAuthorizedKeys(sc.AuthorizedKeys, sc.Access); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("no authorized keys: put the public keys allowed in %s", sc.AuthorizedKeys)
+		}
+		return err
+	}
+	signer, err := loadHostKey(sc.HostKey)
+	if err != nil {
+		return fmt.Errorf("host key: %w", err)
+	}
+
+	ln, err := net.Listen("tcp", sc.Listen)
+	if err != nil {
+		return err
+	}
+	hub, err := openFrameHub(cfg, src)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	defer hub.close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := newSSHServer(hub, cfg, signer, sc.AuthorizedKeys, sc.Access)
+	served := make(chan error, 1)
+	go func() { served <- srv.serve(ctx, ln) }()
+	fmt.Printf("Serving %s over SSH on %s, host key %s. Ctrl+C stops.\n", hub.source, ln.Addr(), ssh.FingerprintSHA256(signer.PublicKey()))
+
+	select {
+	case err = <-served:
+	case <-ctx.Done():
+	case <-hub.done:
+		err = hub.ended()
+	}
+	if ctx.Err() == nil {
+		// Ends the sessions, which save any recordings they had going.
+		stop()
+		if serr := <-served; err == nil {
+			err = serr
+		}
+	}
+	if n := captureHooks.pending.Load(); n > 0 {
+		fmt.Printf("Waiting for %d hook(s) to finish...\n", n)
+	}
+	captureHooks.wait()
+	return err
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestKey(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func authorizedLine(options string, k ssh.Signer, comment string) string {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k.PublicKey()))) + " " + comment
+	if options != "" {
+		line = options + " " + line
+	}
+	return line + "\n"
+}
+
+func TestLoadAuthorizedKeys(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	os.WriteFile(path, []byte("# the team\n\n"+
+		authorizedLine(`access="control",no-agent-forwarding`, alice, "alice")+
+		"not a key\n"+
+		authorizedLine("", bob, "bob")+
+		authorizedLine("access=view", carol, "carol")), 0600)
+
+	keys, err := loadAuthorizedKeys(path, accessControl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[ssh.Signer]authorizedKey{
+		alice: {accessControl, "alice"},
+		bob:   {accessControl, "bob"}, // the default
+		carol: {accessView, "carol"},
+	}
+	if len(keys) != len(want) {
+		t.Errorf("%d keys, want %d", len(keys), len(want))
+	}
+	for k, w := range want {
+		if got := keys[string(k.PublicKey().Marshal())]; got != w {
+			t.Errorf("%s: %+v, want %+v", w.comment, got, w)
+		}
+	}
+
+	os.WriteFile(path, []byte(authorizedLine(`access="admin"`, alice, "alice")), 0600)
+	if _, err := loadAuthorizedKeys(path, accessView); err == nil {
+		t.Error("took an unknown access")
+	}
+	os.WriteFile(path, []byte("# nobody yet\n"), 0600)
+	if _, err := loadAuthorizedKeys(path, accessView); err == nil {
+		t.Error("no keys isn't an error")
+	}
+}
+
+func TestLoadHostKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "ssh_host_key")
+	first, err := loadHostKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("host key file: %v, %v", info, err)
+	}
+	again, err := loadHostKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.PublicKey().Marshal(), again.PublicKey().Marshal()) {
+		t.Error("made a new host key instead of loading the saved one")
+	}
+}
+
+// syncBuffer collects a session's output while the test looks at it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// startTestSSH serves a test hub to the keys given, saving captures to dir.
+func startTestSSH(t *testing.T, dir string, lines ...string) string {
+	t.Helper()
+	keysPath := filepath.Join(t.TempDir(), "authorized_keys")
+	os.WriteFile(keysPath, []byte(strings.Join(lines, "")), 0600)
+	cfg := defaultConfig()
+	cfg.Output.Dir = dir
+	cfg.Render.Columns = 20
+
+	srv := newSSHServer(newTestHub(t, 0), cfg, newTestKey(t), keysPath, accessView)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- srv.serve(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	})
+	return ln.Addr().String()
+}
+
+// sshShell logs in with k and starts the viewer in a 60x20 terminal.
+func sshShell(t *testing.T, addr string, k ssh.Signer) (*ssh.Session, io.Writer, *syncBuffer) {
+	t.Helper()
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "tester",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(k)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(syncBuffer)
+	sess.Stdout = out
+	in, _ := sess.StdinPipe()
+	if err := sess.RequestPty("xterm-256color", 20, 60, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	return sess, in, out
+}
+
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !ok(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestSSHUnknownKey(t *testing.T) {
+	addr := startTestSSH(t, t.TempDir(), authorizedLine("", newTestKey(t), "someone"))
+	_, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "tester",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(newTestKey(t))},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err == nil {
+		t.Fatal("logged in with a key that isn't authorized")
+	}
+}
+
+func TestSSHSessions(t *testing.T) {
+	dir := t.TempDir()
+	viewer, controller := newTestKey(t), newTestKey(t)
+	addr := startTestSSH(t, dir,
+		authorizedLine("", viewer, "viewer"),
+		authorizedLine(`access="control"`, controller, "controller"))
+
+	// Both watch at once, each in their own mode.
+	vs, vin, vout := sshShell(t, addr, viewer)
+	cs, cin, cout := sshShell(t, addr, controller)
+	waitFor(t, "the viewer's first frame", func() bool { return strings.Contains(vout.String(), "Camera Ready") })
+	waitFor(t, "the controller's first frame", func() bool { return strings.Contains(cout.String(), "Camera Ready") })
+	// One key at a time, or they arrive as a single "mm".
+	io.WriteString(cin, "m")
+	waitFor(t, "detailed mode", func() bool { return strings.Contains(cout.String(), ModeDetailed.String()) })
+	io.WriteString(cin, "m")
+	waitFor(t, "color mode", func() bool { return strings.Contains(cout.String(), "\x1b[38;2;") })
+	if strings.Contains(vout.String(), ModeColor.String()) {
+		t.Error("the controller's mode changed the viewer's")
+	}
+
+	// The viewer can't save anything; the controller can.
+	io.WriteString(vin, " ")
+	io.WriteString(cin, " ")
+	waitFor(t, "the photo", func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		return len(files) == 1
+	})
+	if strings.Contains(vout.String(), "Saved") {
+		t.Error("the viewer saved a photo")
+	}
+	io.WriteString(vin, "?")
+	io.WriteString(cin, "?")
+	waitFor(t, "the help", func() bool {
+		return strings.Contains(vout.String(), "cycle filter") && strings.Contains(cout.String(), "cycle filter")
+	})
+	if strings.Contains(vout.String(), "save photo") || !strings.Contains(cout.String(), "save photo") {
+		t.Error("help should show saving to the controller only")
+	}
+	if strings.Contains(cout.String(), "next camera") {
+		t.Error("help offers switching the server's camera")
+	}
+
+	for _, s := range []struct {
+		sess *ssh.Session
+		in   io.Writer
+	}{{vs, vin}, {cs, cin}} {
+		io.WriteString(s.in, "q")
+		if err := s.sess.Wait(); err != nil {
+			t.Errorf("session ended with %v", err)
+		}
+	}
+}
+
+func TestSSHNeedsPty(t *testing.T) {
+	k := newTestKey(t)
+	addr := startTestSSH(t, t.TempDir(), authorizedLine("", k, "k"))
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "tester",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(k)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	sess, _ := client.NewSession()
+	var out bytes.Buffer
+	sess.Stdout = &out
+	if err := sess.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	err = sess.Wait()
+	if err == nil || !strings.Contains(out.String(), "needs a terminal") {
+		t.Errorf("without a pty: %q, %v", out.String(), err)
+	}
+}
+
+func TestSessionHookResultsGoToTheSession(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run through sh here")
+	}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	cfg := defaultConfig()
+	cfg.Output.Dir = t.TempDir()
+	cfg.Render.Columns = 20
+	cfg.Hooks = []HookConfig{{Name: "upload", Run: "echo sent"}}
+
+	got := make(chan tea.Msg, 1)
+	sess := &sshSession{control: true, send: func(msg tea.Msg) { got <- msg }}
+	m := sessionModel(cfg, sess, 60, 20)
+	m, _ = send(t, m, cameraReadyMsg{reader: newFakeReader(drawBall)})
+	m, _ = send(t, m, readMsg{gen: m.readerGen, msg: frameMsg(readFrame(t, newFakeReader(drawBall)))})
+	_, cmd := send(t, m, keyPress(" "))
+	cmd()
+	defer captureHooks.wait()
+
+	select {
+	case msg := <-got:
+		m, _ = send(t, m, msg)
+		if !strings.Contains(m.statusText, "Hook upload done") {
+			t.Errorf("status = %q", m.statusText)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the session never heard from its hook")
+	}
+	select {
+	case res := <-captureHooks.results:
+		t.Errorf("%s reported to the local viewer", res.name)
+	default:
+	}
+}
+
+func TestSessionErrorHint(t *testing.T) {
+	m := sessionModel(defaultConfig(), &sshSession{control: true}, 60, 20)
+	m, _ = send(t, m, errorMsg(errCameraStopped))
+	view := m.View()
+	if !strings.Contains(view, "q quit") || strings.Contains(view, "enter retry") || strings.Contains(view, "d devices") {
+		t.Errorf("error screen offers keys the session doesn't have:\n%s", view)
+	}
+}
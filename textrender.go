@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// --- Text Rendering ---
+//
+// Turns rendered art back into a picture. Recordings use the small built-in
+// bitmap font, since they run at video rates. Snapshots are laid out at a
+// fixed column count and drawn with a scalable font sized to fill the
+// configured output width, so the saved image doesn't depend on how big
+// the terminal happened to be.
+//
+// Every character sits on a fixed grid, whatever the font's own advances,
+// and takes its color from the SGR escapes in the text (so the color
+// mode's blocks come out in color). Full blocks are filled rather than
+// drawn, which leaves no seams between rows.
+
+const (
+	defaultRenderWidth   = 1920
+	defaultRenderColumns = 120
+)
+
+type textRenderer struct {
+	face   font.Face
+	cell   fixed.Point26_6 // advance and line height
+	ascent fixed.Int26_6
+	size   image.Point // output size, 0 to fit the text
+	fg, bg color.RGBA
+}
+
+// textToImage draws text white on black in the 7x13 bitmap font.
+func textToImage(text string) image.Image {
+	r := &textRenderer{
+		face:   basicfont.Face7x13,
+		cell:   fixed.P(7, 13),
+		ascent: fixed.I(11),
+		fg:     color.RGBA{255, 255, 255, 255},
+		bg:     color.RGBA{0, 0, 0, 255},
+	}
+	return r.render(text)
+}
+
+// newTextRenderer sizes cfg's font so a cols x rows grid fills the
+// configured output size.
+func newTextRenderer(cfg RenderConfig, cols, rows int) (*textRenderer, error) {
+	fg, bg, err := cfg.colors()
+	if err != nil {
+		return nil, err
+	}
+	f, err := loadFont(cfg.Font)
+	if err != nil {
+		return nil, err
+	}
+	cols, rows = max(cols, 1), max(rows, 1)
+	width := cfg.Width
+	if width <= 0 {
+		width = defaultRenderWidth
+	}
+
+	// Metrics scale linearly with size, so measure once at 100px and scale.
+	const probe = 100
+	adv, lineH, err := fontMetrics(f, probe)
+	if err != nil {
+		return nil, err
+	}
+	size := probe * float64(width) / (float64(cols) * adv)
+	if cfg.Height > 0 {
+		size = min(size, probe*float64(cfg.Height)/(float64(rows)*lineH))
+	}
+
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil, err
+	}
+	m := face.Metrics()
+	r := &textRenderer{
+		face:   face,
+		cell:   fixed.Point26_6{X: fixed.Int26_6(math.Round(size * adv / probe * 64)), Y: m.Ascent + m.Descent},
+		ascent: m.Ascent,
+		size:   image.Pt(width, cfg.Height),
+		fg:     fg,
+		bg:     bg,
+	}
+	return r, nil
+}
+
+// loadFont reads a TrueType or OpenType font, or returns Go Mono for "".
+func loadFont(path string) (*opentype.Font, error) {
+	data := gomono.TTF
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("font %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// fontMetrics returns the width of "M" and the line height at size px.
+func fontMetrics(f *opentype.Font, size float64) (adv, lineH float64, err error) {
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer face.Close()
+	a, ok := face.GlyphAdvance('M')
+	if !ok || a <= 0 {
+		a = fixed.Int26_6(size * 0.6 * 64)
+	}
+	m := face.Metrics()
+	return float64(a) / 64, float64(m.Ascent+m.Descent) / 64, nil
+}
+
+func (r *textRenderer) render(text string) *image.RGBA {
+	lines := styledLines(text)
+	cols := 0
+	for _, runs := range lines {
+		n := 0
+		for _, run := range runs {
+			n += utf8.RuneCountInString(run.text)
+		}
+		cols = max(cols, n)
+	}
+
+	gridW := (r.cell.X * fixed.Int26_6(cols)).Ceil()
+	gridH := (r.cell.Y * fixed.Int26_6(len(lines))).Ceil()
+	size := r.size
+	if size.X <= 0 {
+		size.X = gridW
+	}
+	if size.Y <= 0 {
+		size.Y = gridH
+	}
+	img := image.NewRGBA(image.Rect(0, 0, max(size.X, 1), max(size.Y, 1)))
+	draw.Draw(img, img.Rect, &image.Uniform{r.bg}, image.Point{}, draw.Src)
+
+	// Center the grid in the output.
+	origin := fixed.P((size.X-gridW)/2, (size.Y-gridH)/2)
+	d := &font.Drawer{Dst: img, Face: r.face}
+	for y, runs := range lines {
+		col := 0
+		top := origin.Y + r.cell.Y*fixed.Int26_6(y)
+		for _, run := range runs {
+			fg := r.fg
+			if run.fg != nil {
+				fg = *run.fg
+			}
+			d.Src = &image.Uniform{fg}
+			for _, ch := range run.text {
+				x := origin.X + r.cell.X*fixed.Int26_6(col)
+				col++
+				switch {
+				case ch == ' ':
+				case ch == '█':
+					cell := image.Rect(x.Round(), top.Round(), (x + r.cell.X).Round(), (top + r.cell.Y).Round())
+					draw.Draw(img, cell, d.Src, image.Point{}, draw.Src)
+				default:
+					d.Dot = fixed.Point26_6{X: x, Y: top + r.ascent}
+					d.DrawString(string(ch))
+				}
+			}
+		}
+	}
+	return img
+}
+
+// --- Render Config ---
+
+func (c RenderConfig) colors() (fg, bg color.RGBA, err error) {
+	if fg, err = parseHexColor(c.Foreground); err != nil {
+		return
+	}
+	bg, err = parseHexColor(c.Background)
+	return
+}
+
+// validate checks the colors and that the font loads.
+func (c RenderConfig) validate() error {
+	if _, _, err := c.colors(); err != nil {
+		return err
+	}
+	_, err := loadFont(c.Font)
+	return err
+}
+
+// parseHexColor reads #rgb or #rrggbb.
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	var r, g, b uint8
+	var err error
+	switch len(hex) {
+	case 3:
+		_, err = fmt.Sscanf(hex, "%1x%1x%1x", &r, &g, &b)
+		r, g, b = r*17, g*17, b*17
+	case 6:
+		_, err = fmt.Sscanf(hex, "%2x%2x%2x", &r, &g, &b)
+	default:
+		err = fmt.Errorf("want #rgb or #rrggbb")
+	}
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("bad color %q: %v", s, err)
+	}
+	return color.RGBA{r, g, b, 255}, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTextRendererSize(t *testing.T) {
+	frame := readFrame(t, newFakeReader(drawBall))
+	txt := imageToAscii(frame, 80, 320, asciiStandard, false)
+	rows := strings.Count(txt, "\n")
+
+	cfg := defaultConfig().Render
+	cfg.Width = 1280
+	r, err := newTextRenderer(cfg, 80, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := r.render(txt)
+	if img.Bounds().Dx() != 1280 {
+		t.Errorf("width = %d, want 1280", img.Bounds().Dx())
+	}
+	// 80 columns at 1280px is 16px per cell; the grid fills the width.
+	if got := r.cell.X.Round(); got != 16 {
+		t.Errorf("cell width = %d, want 16", got)
+	}
+
+	// Same text, twice the pixels: the layout doesn't change, only scale.
+	cfg.Width = 2560
+	r2, err := newTextRenderer(cfg, 80, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := r2.render(txt)
+	if big.Bounds().Dx() != 2560 || abs(big.Bounds().Dy()-2*img.Bounds().Dy()) > 1 {
+		t.Errorf("2x render is %v, want about twice %v", big.Bounds(), img.Bounds())
+	}
+
+	// A fixed height letterboxes the grid.
+	cfg.Width, cfg.Height = 1280, 1280
+	r3, err := newTextRenderer(cfg, 80, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := r3.render(txt).Bounds(); b.Dx() != 1280 || b.Dy() != 1280 {
+		t.Errorf("fixed size render is %v, want 1280x1280", b)
+	}
+}
+
+func TestTextRendererColors(t *testing.T) {
+	cfg := defaultConfig().Render
+	cfg.Width, cfg.Foreground, cfg.Background = 400, "#0f0", "#102030"
+	r, err := newTextRenderer(cfg, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := r.render("\x1b[38;2;255;0;0m█\x1b[0m█  \n")
+
+	cell := r.cell.X.Round()
+	mid := r.cell.Y.Round() / 2
+	for _, c := range []struct {
+		x    int
+		want color.RGBA
+	}{
+		{cell / 2, color.RGBA{255, 0, 0, 255}},         // colored block
+		{cell + cell/2, color.RGBA{0, 255, 0, 255}},    // theme foreground
+		{2*cell + cell/2, color.RGBA{16, 32, 48, 255}}, // background
+	} {
+		if got := img.RGBAAt(c.x, mid); got != c.want {
+			t.Errorf("pixel at x=%d = %v, want %v", c.x, got, c.want)
+		}
+	}
+}
+
+func TestLoadFont(t *testing.T) {
+	if _, err := loadFont(""); err != nil {
+		t.Fatalf("built-in font: %v", err)
+	}
+	bad := filepath.Join(t.TempDir(), "bad.ttf")
+	os.WriteFile(bad, []byte("not a font"), 0644)
+	if _, err := loadFont(bad); err == nil {
+		t.Error("loadFont accepted garbage")
+	}
+	cfg := defaultConfig().Render
+	cfg.Font = filepath.Join(t.TempDir(), "missing.ttf")
+	if err := cfg.validate(); err == nil {
+		t.Error("validate accepted a missing font")
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	for in, want := range map[string]color.RGBA{
+		"#ffb642": {255, 182, 66, 255},
+		"abc":     {170, 187, 204, 255},
+	} {
+		if got, err := parseHexColor(in); err != nil || got != want {
+			t.Errorf("parseHexColor(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "#12345", "#gggggg"} {
+		if _, err := parseHexColor(in); err == nil {
+			t.Errorf("parseHexColor(%q) succeeded", in)
+		}
+	}
+}
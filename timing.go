@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// --- Frame Timing ---
+//
+// GIF delays are in hundredths of a second and a frame's delay is only known
+// once the next frame shows up, so the encoder holds one frame back. Delays
+// come from the running total rather than frame to frame, so rounding never
+// accumulates into drift. Frames closer together than minFrameDelay are
+// skipped: most viewers would stretch them to 100ms otherwise.
+//
+// With a target fps, timestamps snap to that frame grid first. Frames that
+// land in the same slot collapse to one, and a frame covering several slots
+// just gets a longer delay instead of being written out repeatedly.
+
+const (
+	minFrameDelay     = 2 // 1/100 s
+	defaultFrameDelay = 4
+)
+
+type timeline struct {
+	start   time.Time
+	fps     float64
+	emitted int // 1/100 s of delay handed out so far
+	frames  int
+}
+
+// delayUntil returns the delay for the pending frame given that the next one
+// was captured at t, or 0 if the pending frame should be skipped.
+func (tl *timeline) delayUntil(t time.Time) int {
+	end := t.Sub(tl.start).Seconds()
+	if tl.fps > 0 {
+		end = math.Round(end*tl.fps) / tl.fps
+	}
+	cs := int(math.Round(end * 100))
+	d := cs - tl.emitted
+	if d < minFrameDelay {
+		return 0
+	}
+	tl.emitted = cs
+	tl.frames++
+	return d
+}
+
+// lastDelay is the delay for the final frame, which has no successor: one
+// target frame, or the clip's average so far.
+func (tl *timeline) lastDelay() int {
+	switch {
+	case tl.fps > 0:
+		return max(minFrameDelay, int(math.Round(100/tl.fps)))
+	case tl.frames > 0:
+		return max(minFrameDelay, (tl.emitted+tl.frames/2)/tl.frames)
+	default:
+		return defaultFrameDelay
+	}
+}
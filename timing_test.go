@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image/gif"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// delays runs capture offsets (in ms) through a timeline, returning the
+// delays of the frames that were kept, including the last one.
+func delays(fps float64, ms ...int) []int {
+	start := time.Unix(0, 0)
+	tl := timeline{start: start, fps: fps}
+	var out []int
+	for _, t := range ms[1:] {
+		if d := tl.delayUntil(start.Add(time.Duration(t) * time.Millisecond)); d > 0 {
+			out = append(out, d)
+		}
+	}
+	return append(out, tl.lastDelay())
+}
+
+func TestTimelineDelays(t *testing.T) {
+	tests := []struct {
+		name string
+		fps  float64
+		ms   []int
+		want []int
+	}{
+		// 30fps doesn't divide into 1/100 s; the total stays exact.
+		{"30fps", 0, []int{0, 33, 67, 100, 133, 167, 200}, []int{3, 4, 3, 3, 4, 3, 3}},
+		{"jittery", 0, []int{0, 50, 60, 200}, []int{5, 15, 10}},
+		{"stall", 0, []int{0, 40, 1040, 1080}, []int{4, 100, 4, 36}},
+		{"too fast", 0, []int{0, 5, 10, 15, 20}, []int{2, 2}},
+		{"resample 10fps", 10, []int{0, 33, 67, 100, 133, 167, 200, 233}, []int{10, 10, 10}},
+		{"resample stall", 10, []int{0, 100, 530}, []int{10, 40, 10}},
+		{"single frame", 0, []int{0}, []int{defaultFrameDelay}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := delays(tt.fps, tt.ms...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("delays = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecorderUsesCaptureTimes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timed.gif")
+	rec, err := startRecording(path, recordGIF, RecordingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newFakeReader(drawBall)
+	start := time.Unix(0, 0)
+	for _, ms := range []int{0, 100, 150, 400} {
+		at := start.Add(time.Duration(ms) * time.Millisecond)
+		rec.add(recFrame{img: readFrame(t, r), at: at, mode: ModeColor})
+	}
+	if fps := rec.fps(); fps != 7.5 {
+		t.Errorf("fps = %v, want 7.5", fps)
+	}
+	rec.stop()()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{10, 5, 25, 13}; !reflect.DeepEqual(g.Delay, want) {
+		t.Errorf("delays = %v, want %v", g.Delay, want)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- YUV4MPEG2 ---
+//
+// Spec: https://wiki.multimedia.cx/index.php/YUV4MPEG2
+// A stream header line followed by "FRAME" lines, each followed by raw
+// planar Y, Cb, Cr (and optionally alpha) samples.
+
+const y4mMagic = "YUV4MPEG2"
+
+// y4mMaxSide bounds the frame size we'll allocate for, 8K and a bit. The
+// header is the only thing saying how big frames are, so a broken or
+// hostile one shouldn't get to ask for gigabytes.
+const y4mMaxSide = 8192
+
+type y4mDecoder struct {
+	header   bool
+	width    int
+	height   int
+	interval time.Duration
+	chroma   string
+}
+
+func (d *y4mDecoder) frameInterval() time.Duration { return d.interval }
+
+func (d *y4mDecoder) decode(br *bufio.Reader) (image.Image, error) {
+	if !d.header {
+		if err := d.readHeader(br); err != nil {
+			return nil, err
+		}
+		d.header = true
+	}
+
+	line, err := br.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line == "" {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("y4m: truncated frame header: %w", err)
+	}
+	if !strings.HasPrefix(line, "FRAME") {
+		return nil, fmt.Errorf("y4m: expected FRAME, got %q", strings.TrimSpace(line))
+	}
+
+	return d.readPlanes(br)
+}
+
+func (d *y4mDecoder) readHeader(br *bufio.Reader) error {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("y4m: reading header: %w", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != y4mMagic {
+		return fmt.Errorf("y4m: bad magic")
+	}
+
+	d.chroma = "420jpeg"
+	for _, f := range fields[1:] {
+		tag, val := f[0], f[1:]
+		switch tag {
+		case 'W':
+			d.width, _ = strconv.Atoi(val)
+		case 'H':
+			d.height, _ = strconv.Atoi(val)
+		case 'F':
+			num, den, ok := strings.Cut(val, ":")
+			n, _ := strconv.Atoi(num)
+			m, _ := strconv.Atoi(den)
+			if ok && n > 0 && m > 0 {
+				d.interval = time.Duration(float64(time.Second) * float64(m) / float64(n))
+			}
+		case 'C':
+			d.chroma = val
+		}
+	}
+
+	if d.width <= 0 || d.height <= 0 {
+		return fmt.Errorf("y4m: missing frame size in header")
+	}
+	if d.width > y4mMaxSide || d.height > y4mMaxSide {
+		return fmt.Errorf("y4m: frame size %dx%d is over the %d pixel limit", d.width, d.height, y4mMaxSide)
+	}
+	return nil
+}
+
+func (d *y4mDecoder) readPlanes(br *bufio.Reader) (image.Image, error) {
+	rect := image.Rect(0, 0, d.width, d.height)
+
+	if d.chroma == "mono" {
+		img := image.NewGray(rect)
+		if _, err := io.ReadFull(br, img.Pix); err != nil {
+			return nil, fmt.Errorf("y4m: short frame: %w", err)
+		}
+		return img, nil
+	}
+
+	// Only the 8-bit tags; C420p10 and friends have 16-bit samples.
+	var ratio image.YCbCrSubsampleRatio
+	switch d.chroma {
+	case "420jpeg", "420paldv", "420mpeg2", "420":
+		ratio = image.YCbCrSubsampleRatio420
+	case "422":
+		ratio = image.YCbCrSubsampleRatio422
+	case "444", "444alpha":
+		ratio = image.YCbCrSubsampleRatio444
+	default:
+		return nil, fmt.Errorf("y4m: unsupported colorspace C%s", d.chroma)
+	}
+
+	// Go's YCbCr layout matches the y4m plane layout exactly (strides are
+	// the plane widths, chroma rounded up), so we can read straight in.
+	if d.chroma == "444alpha" {
+		img := image.NewNYCbCrA(rect, ratio)
+		for _, plane := range [][]byte{img.Y, img.Cb, img.Cr, img.A} {
+			if _, err := io.ReadFull(br, plane); err != nil {
+				return nil, fmt.Errorf("y4m: short frame: %w", err)
+			}
+		}
+		return img, nil
+	}
+
+	img := image.NewYCbCr(rect, ratio)
+	for _, plane := range [][]byte{img.Y, img.Cb, img.Cr} {
+		if _, err := io.ReadFull(br, plane); err != nil {
+			return nil, fmt.Errorf("y4m: short frame: %w", err)
+		}
+	}
+	return img, nil
+}
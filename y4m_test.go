@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"strings"
+	"testing"
+)
+
+// y4mStream builds a 420 stream whose frame i has luma value i.
+func y4mStream(w, h, frames int) []byte {
+	var b bytes.Buffer
+	b.WriteString("YUV4MPEG2 W5 H3 F25:1 Ip A1:1 C420jpeg XYSCSS=420JPEG\n")
+	cw, ch := (w+1)/2, (h+1)/2
+	for i := 0; i < frames; i++ {
+		b.WriteString("FRAME\n")
+		b.Write(bytes.Repeat([]byte{byte(i * 10)}, w*h))
+		b.Write(bytes.Repeat([]byte{128}, 2*cw*ch))
+	}
+	return b.Bytes()
+}
+
+func TestY4MInput(t *testing.T) {
+	path := writeTemp(t, "clip.y4m", y4mStream(5, 3, 2))
+	r, err := openStreamInput(path, inputOptions{fast: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := 0; i < 2; i++ {
+		img := readFrame(t, r)
+		ycc, ok := img.(*image.YCbCr)
+		if !ok {
+			t.Fatalf("frame %d is %T, want *image.YCbCr", i, img)
+		}
+		if img.Bounds() != image.Rect(0, 0, 5, 3) || ycc.Y[0] != byte(i*10) {
+			t.Errorf("frame %d: bounds %v, Y %d", i, img.Bounds(), ycc.Y[0])
+		}
+	}
+	if r.dec.frameInterval().Milliseconds() != 40 {
+		t.Errorf("frame interval = %v, want 40ms", r.dec.frameInterval())
+	}
+
+	if _, _, err := r.Read(); !errors.Is(err, io.EOF) {
+		t.Errorf("Read at end = %v, want io.EOF", err)
+	}
+}
+
+func TestY4MInputLoop(t *testing.T) {
+	path := writeTemp(t, "clip.y4m", y4mStream(5, 3, 2))
+	r, err := openStreamInput(path, inputOptions{fast: true, loop: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := 0; i < 5; i++ {
+		ycc := readFrame(t, r).(*image.YCbCr)
+		if want := byte(i % 2 * 10); ycc.Y[0] != want {
+			t.Errorf("frame %d: Y = %d, want %d", i, ycc.Y[0], want)
+		}
+	}
+}
+
+func TestY4MTruncated(t *testing.T) {
+	data := y4mStream(5, 3, 1)
+	path := writeTemp(t, "cut.y4m", data[:len(data)-4])
+	r, err := openStreamInput(path, inputOptions{fast: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, _, err := r.Read(); err == nil || errors.Is(err, io.EOF) {
+		t.Errorf("truncated frame gave %v, want a non-EOF error", err)
+	}
+}
+
+func TestY4MBadSize(t *testing.T) {
+	for _, header := range []string{"W0 H3", "W-5 H3", "W5", "W100000 H100000", "W5 H9999999999"} {
+		path := writeTemp(t, "bad.y4m", []byte("YUV4MPEG2 "+header+" F25:1\nFRAME\n"))
+		r, err := openStreamInput(path, inputOptions{fast: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := r.Read(); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("%s: got %v, want a header error", header, err)
+		}
+		r.Close()
+	}
+}
+
+func TestY4MHighBitDepth(t *testing.T) {
+	for _, chroma := range []string{"420p10", "422p12", "444p16", "mono16"} {
+		path := writeTemp(t, "deep.y4m", []byte("YUV4MPEG2 W4 H2 F25:1 C"+chroma+"\nFRAME\n"+string(make([]byte, 64))))
+		r, err := openStreamInput(path, inputOptions{fast: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = r.Read()
+		if err == nil || !strings.Contains(err.Error(), "unsupported colorspace") {
+			t.Errorf("C%s: got %v, want unsupported colorspace", chroma, err)
+		}
+		r.Close()
+	}
+}